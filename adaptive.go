@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/urfave/cli"
+
+	"github.com/hchagen/twitch-player/hls"
+	"github.com/hchagen/twitch-player/twitch"
+)
+
+var (
+	adaptiveFlag = cli.BoolFlag{
+		Name:  "adaptive",
+		Usage: "Switch quality automatically with the measured download speed",
+	}
+	minQualityFlag = cli.StringFlag{
+		Name:  "min-quality",
+		Usage: "Lowest quality to switch to in adaptive mode, e.g. 360p30",
+	}
+	maxQualityFlag = cli.StringFlag{
+		Name:  "max-quality",
+		Usage: "Highest quality to switch to in adaptive mode, e.g. 720p60",
+	}
+)
+
+// adaptiveVariants returns the video variants between the min and max
+// quality, ordered by bandwidth.
+func adaptiveVariants(uris []twitch.StreamUrl, min, max string) ([]twitch.StreamUrl, error) {
+	var variants []twitch.StreamUrl
+	for _, uri := range uris {
+		if uri.Resolution != "" && uri.Bandwidth > 0 {
+			variants = append(variants, uri)
+		}
+	}
+	sort.SliceStable(variants, func(i, j int) bool {
+		return variants[i].Bandwidth < variants[j].Bandwidth
+	})
+
+	lo, hi := 0, len(variants)-1
+	if min != "" {
+		uri, err := findStreamUrl(variants, min)
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range variants {
+			if v.Quality == uri.Quality {
+				lo = i
+			}
+		}
+	}
+	if max != "" {
+		uri, err := findStreamUrl(variants, max)
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range variants {
+			if v.Quality == uri.Quality {
+				hi = i
+			}
+		}
+	}
+	if lo > hi {
+		return nil, fmt.Errorf("--min-quality %s is above --max-quality %s", min, max)
+	}
+
+	return variants[lo : hi+1], nil
+}
+
+// newAdaptive starts at the selected quality, or the nearest bound if it is
+// outside of them.
+func newAdaptive(ctx *cli.Context, stream twitch.Stream, uri twitch.StreamUrl) (*hls.Adaptive, error) {
+	uris, err := twitchClient().GetStreamUrls(stream.Channel.Name)
+	if err != nil {
+		return nil, err
+	}
+	urls, err := adaptiveVariants(uris, ctx.String("min-quality"), ctx.String("max-quality"))
+	if err != nil {
+		return nil, err
+	}
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("No video qualities to switch between")
+	}
+
+	initial := urls[len(urls)-1].Quality
+	if uri.Bandwidth < urls[0].Bandwidth {
+		initial = urls[0].Quality
+	}
+	variants := make([]hls.Variant, len(urls))
+	for i, u := range urls {
+		variants[i] = hls.Variant{
+			Bandwidth:  u.Bandwidth,
+			Resolution: u.Resolution,
+			Name:       u.Quality,
+		}
+		if u.Quality == uri.Quality {
+			initial = u.Quality
+		}
+	}
+
+	a, err := hls.NewAdaptive(variants, initial, variantResolver(stream))
+	if err != nil {
+		return nil, err
+	}
+	a.OnSwitch = func(from, to hls.Variant, throughput float64) {
+		fmt.Fprintf(os.Stderr, "Switching from %s to %s at %dkbps\n", from.Name, to.Name, int(throughput)/1024)
+	}
+
+	return a, nil
+}
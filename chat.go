@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/urfave/cli"
+
+	"github.com/hchagen/twitch-player/chat"
+	"github.com/hchagen/twitch-player/twitch"
+)
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiDim    = "\x1b[2m"
+	ansiItalic = "\x1b[3m"
+)
+
+var defaultChatColors = []string{
+	"#FF0000", "#0000FF", "#008000", "#B22222", "#FF7F50",
+	"#9ACD32", "#FF4500", "#2E8B57", "#DAA520", "#D2691E",
+	"#5F9EA0", "#1E90FF", "#FF69B4", "#8A2BE2", "#00FF7F",
+}
+
+var chatFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "login,l",
+		Usage: "Twitch login to chat as (anonymous if empty)",
+	},
+	cli.StringFlag{
+		Name:   "oauth-token,t",
+		Usage:  "OAuth token for the chat login",
+		EnvVar: "TWITCH_OAUTH_TOKEN",
+	},
+	cli.BoolFlag{
+		Name:  "websocket,w",
+		Usage: "Connect over WebSocket rather than IRC/TLS",
+	},
+	cli.BoolFlag{
+		Name:  "ids",
+		Usage: "Show message ids (for /delete and /reply)",
+	},
+	cli.StringFlag{
+		Name:   "server",
+		Usage:  "Chat server address",
+		Hidden: true,
+	},
+}
+
+var chatCommandUsage = `Chat commands:
+  /me <text>
+  /reply <message id> <text>
+  /timeout <user> <duration> [reason]
+  /ban <user> [reason]
+  /unban <user>
+  /delete <message id>
+  /slow <seconds|off>
+  /subscribers <on|off>`
+
+var badgeLabels = map[string]string{
+	"broadcaster": "\x1b[31mbroadcaster",
+	"moderator":   "\x1b[32mmod",
+	"vip":         "\x1b[35mvip",
+	"subscriber":  "\x1b[34msub",
+	"founder":     "\x1b[34mfounder",
+	"staff":       "\x1b[33mstaff",
+	"partner":     "\x1b[35mverified",
+	"turbo":       "\x1b[35mturbo",
+	"premium":     "\x1b[36mprime",
+}
+
+func newChatClient(ctx *cli.Context) chat.Client {
+	server := ctx.String("server")
+	if server == "" {
+		server = chat.IrcServer
+		if ctx.Bool("websocket") {
+			server = chat.WebSocketServer
+		}
+	}
+
+	return chat.NewChatClient(server, ctx.String("login"), ctx.String("oauth-token"), DefaultTwitchHttpTimeout)
+}
+
+func newModerator(ctx *cli.Context) (twitch.Moderator, error) {
+	return twitch.NewModerator(appClientId, ctx.String("oauth-token"), DefaultTwitchHttpTimeout)
+}
+
+func onChat(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("Please provide a channel name")
+	}
+
+	channel := strings.TrimPrefix(ctx.Args()[0], "#")
+	client := newChatClient(ctx)
+	if err := client.Join(channel); err != nil {
+		return err
+	}
+	if err := client.Connect(); err != nil {
+		return err
+	}
+	defer client.Close()
+
+	fmt.Printf("Joined #%s chat...\n\n", channel)
+
+	lines := make(chan string)
+	if ctx.String("login") != "" && ctx.String("oauth-token") != "" {
+		fmt.Printf("Type a message and press enter to send, /help for commands\n\n")
+		go func() {
+			scanner := bufio.NewScanner(os.Stdin)
+			for scanner.Scan() {
+				lines <- scanner.Text()
+			}
+		}()
+	}
+
+	sigchan := make(chan os.Signal, 1)
+	signal.Notify(sigchan, syscall.SIGINT, syscall.SIGTERM)
+	for {
+		select {
+		case msg, ok := <-client.Messages():
+			if !ok {
+				return client.Err()
+			}
+			if line := formatChatMessage(msg, ctx.Bool("ids")); line != "" {
+				fmt.Println(line)
+			}
+		case line := <-lines:
+			if err := runChatInput(ctx, client, channel, line); err != nil {
+				fmt.Printf("Error: %s\n", err.Error())
+			}
+		case <-sigchan:
+			return nil
+		}
+	}
+}
+
+func onChatCommand(command string) func(*cli.Context) error {
+	return func(ctx *cli.Context) error {
+		if ctx.NArg() < 2 {
+			return fmt.Errorf("Please provide a channel name and arguments")
+		}
+
+		channel := strings.TrimPrefix(ctx.Args()[0], "#")
+		input := strings.Join(ctx.Args()[1:], " ")
+		if command != "" {
+			input = "/" + command + " " + input
+		}
+
+		var client chat.Client
+		if command == "" || command == "me" {
+			client = newChatClient(ctx)
+			if err := client.Connect(); err != nil {
+				return err
+			}
+			defer client.Close()
+		}
+
+		return runChatInput(ctx, client, channel, input)
+	}
+}
+
+// runChatInput sends a chat line, running it as a command if it starts with a slash.
+func runChatInput(ctx *cli.Context, client chat.Client, channel, input string) error {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return nil
+	}
+	if !strings.HasPrefix(input, "/") {
+		return client.Say(channel, input)
+	}
+
+	args := strings.Fields(input)
+	command, args := strings.ToLower(args[0][1:]), args[1:]
+	rest := func(from int) string {
+		if len(args) <= from {
+			return ""
+		}
+		return strings.Join(args[from:], " ")
+	}
+
+	switch command {
+	case "help":
+		fmt.Println(chatCommandUsage)
+		return nil
+	case "me":
+		return client.Say(channel, "\x01ACTION "+rest(0)+"\x01")
+	case "reply":
+		if len(args) < 2 {
+			return fmt.Errorf("Usage: /reply <message id> <text>")
+		}
+		return client.Reply(channel, args[0], rest(1))
+	}
+
+	mod, err := newModerator(ctx)
+	if err != nil {
+		return err
+	}
+	logins := []string{channel}
+	switch command {
+	case "timeout", "ban", "unban":
+		if len(args) == 0 {
+			return fmt.Errorf("Please provide a user name")
+		}
+		logins = append(logins, strings.TrimPrefix(args[0], "@"))
+	}
+	userIds, err := resolveUserIds(mod, logins...)
+	if err != nil {
+		return err
+	}
+	broadcasterId := userIds[0]
+
+	switch command {
+	case "timeout":
+		if len(args) < 2 {
+			return fmt.Errorf("Usage: /timeout <user> <duration> [reason]")
+		}
+		d, err := parseChatDuration(args[1])
+		if err != nil {
+			return err
+		}
+		return mod.Timeout(broadcasterId, userIds[1], d, rest(2))
+	case "ban":
+		return mod.Ban(broadcasterId, userIds[1], rest(1))
+	case "unban":
+		return mod.Unban(broadcasterId, userIds[1])
+	case "delete":
+		if len(args) < 1 {
+			return fmt.Errorf("Usage: /delete <message id>")
+		}
+		return mod.DeleteMessage(broadcasterId, args[0])
+	case "slow":
+		if len(args) < 1 {
+			return fmt.Errorf("Usage: /slow <seconds|off>")
+		}
+		if args[0] == "off" {
+			return mod.SetSlowMode(broadcasterId, 0)
+		}
+		d, err := parseChatDuration(args[0])
+		if err != nil {
+			return err
+		}
+		return mod.SetSlowMode(broadcasterId, d)
+	case "subscribers":
+		if len(args) < 1 || (args[0] != "on" && args[0] != "off") {
+			return fmt.Errorf("Usage: /subscribers <on|off>")
+		}
+		return mod.SetSubscriberMode(broadcasterId, args[0] == "on")
+	}
+
+	return fmt.Errorf("Unknown chat command /%s, see /help", command)
+}
+
+func resolveUserIds(mod twitch.Moderator, logins ...string) ([]uint64, error) {
+	users, err := mod.GetUsers(logins...)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint64, len(logins))
+	for i, login := range logins {
+		for _, u := range users {
+			if strings.EqualFold(u.Login, login) {
+				ids[i], _ = strconv.ParseUint(u.Id, 10, 64)
+			}
+		}
+		if ids[i] == 0 {
+			return nil, fmt.Errorf("No user found for %s", login)
+		}
+	}
+
+	return ids, nil
+}
+
+func parseChatDuration(s string) (time.Duration, error) {
+	if secs, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return time.Duration(secs) * time.Second, nil
+	}
+
+	return time.ParseDuration(s)
+}
+
+func formatChatMessage(msg chat.Message, showIds bool) string {
+	switch msg.Command {
+	case "PRIVMSG":
+		cm, _ := msg.ChatMessage()
+		if showIds {
+			return ansiDim + cm.Id + ansiReset + " " + formatChatLine(cm)
+		}
+		return formatChatLine(cm)
+	case "USERNOTICE":
+		line := ansiBold + "* " + msg.Tags["system-msg"] + ansiReset
+		if cm, ok := msg.ChatMessage(); ok {
+			line += "\n" + formatChatLine(cm)
+		}
+		return line
+	case "CLEARCHAT":
+		if len(msg.Params) < 2 {
+			return ansiDim + "* Chat was cleared by a moderator" + ansiReset
+		}
+		if d := msg.Tags["ban-duration"]; d != "" {
+			return fmt.Sprintf("%s* %s was timed out for %ss%s", ansiDim, msg.Trailing(), d, ansiReset)
+		}
+		return fmt.Sprintf("%s* %s was banned%s", ansiDim, msg.Trailing(), ansiReset)
+	case "NOTICE":
+		return ansiDim + "* " + msg.Trailing() + ansiReset
+	}
+
+	return ""
+}
+
+func formatChatLine(cm chat.ChatMessage) string {
+	var sb strings.Builder
+
+	if !cm.Sent.IsZero() {
+		sb.WriteString(ansiDim + cm.Sent.Local().Format("15:04") + ansiReset + " ")
+	}
+	for _, b := range cm.Badges {
+		if label, ok := badgeLabels[b.Name]; ok {
+			sb.WriteString("[" + label + ansiReset + "]")
+		}
+	}
+	if len(cm.Badges) > 0 {
+		sb.WriteByte(' ')
+	}
+
+	color := chatColor(cm)
+	sb.WriteString(ansiBold + color + cm.DisplayName + ansiReset)
+	if cm.Action {
+		sb.WriteString(" " + ansiItalic + color)
+	} else {
+		sb.WriteString(": ")
+	}
+	if cm.Bits > 0 {
+		sb.WriteString(fmt.Sprintf("%s(%d bits)%s ", ansiBold, cm.Bits, ansiReset))
+	}
+	sb.WriteString(highlightEmotes(cm.Text, cm.Emotes))
+	sb.WriteString(ansiReset)
+
+	return sb.String()
+}
+
+func chatColor(cm chat.ChatMessage) string {
+	hex := cm.Color
+	if len(hex) != 7 {
+		h := fnv.New32a()
+		h.Write([]byte(cm.User))
+		hex = defaultChatColors[h.Sum32()%uint32(len(defaultChatColors))]
+	}
+
+	rgb, err := strconv.ParseUint(hex[1:], 16, 32)
+	if err != nil {
+		return ""
+	}
+
+	return fmt.Sprintf("\x1b[38;2;%d;%d;%dm", rgb>>16&0xff, rgb>>8&0xff, rgb&0xff)
+}
+
+func highlightEmotes(text string, emotes []chat.Emote) string {
+	if len(emotes) == 0 {
+		return text
+	}
+
+	runes := []rune(text)
+	marks := make(map[int]bool)
+	for _, e := range emotes {
+		if e.Start < 0 || e.End >= len(runes) || e.Start > e.End {
+			continue
+		}
+		for i := e.Start; i <= e.End; i++ {
+			marks[i] = true
+		}
+	}
+
+	var sb strings.Builder
+	for i, r := range runes {
+		if marks[i] && !marks[i-1] {
+			sb.WriteString(ansiBold)
+		}
+		sb.WriteRune(r)
+		if marks[i] && !marks[i+1] {
+			sb.WriteString("\x1b[22m")
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,375 @@
+package chat
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	IrcServer       = "irc.chat.twitch.tv:6697"
+	WebSocketServer = "wss://irc-ws.chat.twitch.tv:443"
+
+	anonymousPass = "SCHMOOPIIE"
+
+	MaxMessageLength = 500
+
+	reconnectRetries = 5
+)
+
+var errClosed = fmt.Errorf("Chat client closed")
+
+type Client interface {
+	Connect() error
+	Join(channel string) error
+	Part(channel string) error
+
+	Say(channel, text string) error
+	Reply(channel, parentId, text string) error
+
+	Messages() <-chan Message
+	Err() error
+
+	Close() error
+}
+
+type chatClient struct {
+	server  string
+	login   string
+	token   string
+	timeout time.Duration
+	limiter *rateLimiter
+
+	mu        sync.Mutex
+	conn      transport
+	channels  map[string]bool
+	moderator map[string]bool
+	running   bool
+	err       error
+
+	messages  chan Message
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewChatClient logs in anonymously as a justinfan user when login or token is empty.
+func NewChatClient(server, login, token string, timeout time.Duration) Client {
+	if login == "" || token == "" {
+		login = fmt.Sprintf("justinfan%d", 10000+rand.Intn(89999))
+		token = ""
+	}
+
+	return &chatClient{
+		server:    server,
+		login:     strings.ToLower(login),
+		token:     token,
+		timeout:   timeout,
+		limiter:   newRateLimiter(RateLimitWindow),
+		channels:  make(map[string]bool),
+		moderator: make(map[string]bool),
+		messages:  make(chan Message, 64),
+		done:      make(chan struct{}),
+	}
+}
+
+func (c *chatClient) Messages() <-chan Message {
+	return c.messages
+}
+
+func (c *chatClient) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.err
+}
+
+func (c *chatClient) Connect() error {
+	c.mu.Lock()
+	if c.running {
+		c.mu.Unlock()
+		return fmt.Errorf("Chat already connected")
+	}
+	c.running = true
+	c.mu.Unlock()
+
+	if err := c.connect(); err != nil {
+		c.mu.Lock()
+		if c.isClosed() {
+			// Close saw us running and left the messages to run
+			close(c.messages)
+		} else {
+			c.running = false
+		}
+		c.mu.Unlock()
+		return err
+	}
+
+	go c.run()
+
+	return nil
+}
+
+func (c *chatClient) Join(channel string) error {
+	channel = normalizeChannel(channel)
+
+	c.mu.Lock()
+	c.channels[channel] = true
+	conn := c.conn
+	c.mu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+
+	return conn.WriteLine("JOIN #" + channel)
+}
+
+func (c *chatClient) Part(channel string) error {
+	channel = normalizeChannel(channel)
+
+	c.mu.Lock()
+	delete(c.channels, channel)
+	conn := c.conn
+	c.mu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+
+	return conn.WriteLine("PART #" + channel)
+}
+
+func (c *chatClient) Say(channel, text string) error {
+	return c.send(channel, "", text)
+}
+
+func (c *chatClient) Reply(channel, parentId, text string) error {
+	return c.send(channel, parentId, text)
+}
+
+func (c *chatClient) send(channel, parentId, text string) error {
+	channel = normalizeChannel(channel)
+	text = strings.TrimSpace(text)
+
+	if c.token == "" {
+		return fmt.Errorf("Cannot send: Logged in anonymously")
+	}
+	if text == "" {
+		return fmt.Errorf("Cannot send: Empty message")
+	}
+	if n := utf8.RuneCountInString(text); n > MaxMessageLength {
+		return fmt.Errorf("Cannot send: Message is %d characters, limit is %d", n, MaxMessageLength)
+	}
+	if strings.ContainsAny(text, "\r\n") {
+		return fmt.Errorf("Cannot send: Message contains line breaks")
+	}
+
+	c.mu.Lock()
+	conn := c.conn
+	limit := RateLimitUser
+	if c.moderator[channel] {
+		limit = RateLimitModerator
+	}
+	c.mu.Unlock()
+
+	if conn == nil {
+		return fmt.Errorf("Cannot send: Not connected")
+	}
+	if !c.limiter.wait(limit, c.done) {
+		return fmt.Errorf("Cannot send: Connection closed")
+	}
+
+	msg := Message{
+		Command: "PRIVMSG",
+		Params:  []string{"#" + channel, text},
+	}
+	if parentId != "" {
+		msg.Tags = map[string]string{"reply-parent-msg-id": parentId}
+	}
+
+	return conn.WriteLine(msg.String())
+}
+
+func (c *chatClient) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if c.conn != nil {
+			c.conn.WriteLine("QUIT")
+			err = c.conn.Close()
+		}
+		if !c.running {
+			close(c.messages)
+		}
+	})
+
+	return err
+}
+
+func (c *chatClient) isClosed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *chatClient) authenticate(conn transport) error {
+	pass := anonymousPass
+	if c.token != "" {
+		pass = "oauth:" + strings.TrimPrefix(c.token, "oauth:")
+	}
+
+	for _, line := range []string{
+		"CAP REQ :twitch.tv/tags twitch.tv/commands twitch.tv/membership",
+		"PASS " + pass,
+		"NICK " + c.login,
+	} {
+		if err := conn.WriteLine(line); err != nil {
+			return err
+		}
+	}
+
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			return fmt.Errorf("Logging in to chat: %s", err.Error())
+		}
+		msg, err := ParseMessage(line)
+		if err != nil {
+			continue
+		}
+		switch msg.Command {
+		case "001":
+			return nil
+		case "PING":
+			conn.WriteLine("PONG :" + msg.Trailing())
+		case "NOTICE":
+			return fmt.Errorf("Logging in to chat: %s", msg.Trailing())
+		}
+	}
+}
+
+func (c *chatClient) connect() error {
+	conn, err := dial(c.server, c.timeout)
+	if err != nil {
+		return err
+	}
+
+	if err := c.authenticate(conn); err != nil {
+		conn.Close()
+		return err
+	}
+
+	c.mu.Lock()
+	if c.isClosed() {
+		c.mu.Unlock()
+		conn.Close()
+		return errClosed
+	}
+	old := c.conn
+	c.conn = conn
+	channels := make([]string, 0, len(c.channels))
+	for channel := range c.channels {
+		channels = append(channels, channel)
+	}
+	c.mu.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+
+	for _, channel := range channels {
+		if err := conn.WriteLine("JOIN #" + channel); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *chatClient) reconnect() error {
+	var err error
+	for i := 0; i < reconnectRetries; i++ {
+		select {
+		case <-c.done:
+			return nil
+		case <-time.After(time.Duration(1<<uint(i)) * time.Second / 2):
+		}
+
+		if err = c.connect(); err == nil || err == errClosed {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Reconnecting to chat: %s", err.Error())
+}
+
+func (c *chatClient) run() {
+	defer close(c.messages)
+
+	for {
+		c.mu.Lock()
+		conn := c.conn
+		c.mu.Unlock()
+
+		line, err := conn.ReadLine()
+		if c.isClosed() {
+			return
+		}
+
+		if err == nil {
+			err = c.handle(conn, line)
+		} else {
+			err = c.reconnect()
+		}
+
+		if err != nil {
+			c.mu.Lock()
+			c.err = err
+			c.mu.Unlock()
+			return
+		}
+	}
+}
+
+func (c *chatClient) handle(conn transport, line string) error {
+	msg, err := ParseMessage(line)
+	if err != nil {
+		return nil
+	}
+
+	switch msg.Command {
+	case "PING":
+		if err := conn.WriteLine("PONG :" + msg.Trailing()); err != nil {
+			return c.reconnect()
+		}
+		return nil
+	case "RECONNECT":
+		return c.reconnect()
+	case "USERSTATE":
+		badges := msg.Tags["badges"]
+		c.mu.Lock()
+		c.moderator[msg.Channel()] = msg.Tags["mod"] == "1" || strings.Contains(badges, "broadcaster/") || strings.Contains(badges, "moderator/")
+		c.mu.Unlock()
+	}
+
+	select {
+	case c.messages <- msg:
+	case <-c.done:
+	}
+
+	return nil
+}
+
+func normalizeChannel(channel string) string {
+	return strings.ToLower(strings.TrimPrefix(channel, "#"))
+}
@@ -0,0 +1,355 @@
+package chat
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testTimeout = 5 * time.Second
+
+// fakeServer is a plain TCP IRC server that hands each accepted connection
+// to the test.
+type fakeServer struct {
+	ln    net.Listener
+	conns chan *fakeConn
+}
+
+type fakeConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &fakeServer{ln: ln, conns: make(chan *fakeConn, 4)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				close(s.conns)
+				return
+			}
+			s.conns <- &fakeConn{conn: conn, r: bufio.NewReader(conn)}
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+
+	return s
+}
+
+func (s *fakeServer) url() string {
+	return "irc://" + s.ln.Addr().String()
+}
+
+func (s *fakeServer) accept(t *testing.T) *fakeConn {
+	select {
+	case c, ok := <-s.conns:
+		if !ok {
+			t.Fatal("Server closed")
+		}
+		t.Cleanup(func() { c.conn.Close() })
+		return c
+	case <-time.After(testTimeout):
+		t.Fatal("Timed out waiting for the client to connect")
+	}
+
+	return nil
+}
+
+func (c *fakeConn) readLine(t *testing.T) string {
+	c.conn.SetReadDeadline(time.Now().Add(testTimeout))
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("Reading from client: %s", err)
+	}
+
+	return strings.TrimRight(line, "\r\n")
+}
+
+// expect skips lines until one starting with prefix.
+func (c *fakeConn) expect(t *testing.T, prefix string) string {
+	for {
+		if line := c.readLine(t); strings.HasPrefix(line, prefix) {
+			return line
+		}
+	}
+}
+
+func (c *fakeConn) send(t *testing.T, line string) {
+	if _, err := c.conn.Write([]byte(line + "\r\n")); err != nil {
+		t.Fatalf("Writing to client: %s", err)
+	}
+}
+
+// login answers the handshake and returns the PASS and NICK arguments.
+func (c *fakeConn) login(t *testing.T) (pass, nick string) {
+	if line := c.readLine(t); !strings.HasPrefix(line, "CAP REQ :") || !strings.Contains(line, "twitch.tv/tags") {
+		t.Errorf("Expected a tags capability request, got %q", line)
+	}
+	pass = strings.TrimPrefix(c.expect(t, "PASS "), "PASS ")
+	nick = strings.TrimPrefix(c.expect(t, "NICK "), "NICK ")
+	c.send(t, ":tmi.twitch.tv 001 "+nick+" :Welcome, GLHF!")
+
+	return pass, nick
+}
+
+func connect(t *testing.T, s *fakeServer, login, token string) (Client, *fakeConn) {
+	client := NewChatClient(s.url(), login, token, testTimeout)
+	t.Cleanup(func() {
+		client.Close()
+		for range client.Messages() {
+		}
+	})
+
+	errc := make(chan error, 1)
+	go func() { errc <- client.Connect() }()
+
+	conn := s.accept(t)
+	conn.login(t)
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	return client, conn
+}
+
+func receive(t *testing.T, client Client) Message {
+	select {
+	case msg, ok := <-client.Messages():
+		if !ok {
+			t.Fatalf("Messages closed: %v", client.Err())
+		}
+		return msg
+	case <-time.After(testTimeout):
+		t.Fatal("Timed out waiting for a message")
+	}
+
+	return Message{}
+}
+
+func TestLoginAnonymous(t *testing.T) {
+	s := newFakeServer(t)
+	client := NewChatClient(s.url(), "", "", testTimeout)
+	defer client.Close()
+
+	errc := make(chan error, 1)
+	go func() { errc <- client.Connect() }()
+
+	pass, nick := s.accept(t).login(t)
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if pass != anonymousPass {
+		t.Errorf("PASS is %q, want %q", pass, anonymousPass)
+	}
+	if !strings.HasPrefix(nick, "justinfan") {
+		t.Errorf("NICK is %q, want a justinfan user", nick)
+	}
+
+	if err := client.Say("channel", "hello"); err == nil {
+		t.Error("Anonymous client was allowed to send")
+	}
+}
+
+func TestLoginOAuth(t *testing.T) {
+	s := newFakeServer(t)
+	client := NewChatClient(s.url(), "SomeUser", "oauth:secret", testTimeout)
+	defer client.Close()
+
+	errc := make(chan error, 1)
+	go func() { errc <- client.Connect() }()
+
+	pass, nick := s.accept(t).login(t)
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if pass != "oauth:secret" {
+		t.Errorf("PASS is %q, want %q", pass, "oauth:secret")
+	}
+	if nick != "someuser" {
+		t.Errorf("NICK is %q, want %q", nick, "someuser")
+	}
+}
+
+func TestLoginFailed(t *testing.T) {
+	s := newFakeServer(t)
+	client := NewChatClient(s.url(), "someuser", "bad", testTimeout)
+	defer client.Close()
+
+	errc := make(chan error, 1)
+	go func() { errc <- client.Connect() }()
+
+	conn := s.accept(t)
+	conn.expect(t, "NICK ")
+	conn.send(t, ":tmi.twitch.tv NOTICE * :Login authentication failed")
+
+	err := <-errc
+	if err == nil || !strings.Contains(err.Error(), "Login authentication failed") {
+		t.Errorf("Connect returned %v, want the login notice", err)
+	}
+}
+
+func TestTags(t *testing.T) {
+	s := newFakeServer(t)
+	client, conn := connect(t, s, "", "")
+
+	if err := client.Join("#Channel"); err != nil {
+		t.Fatal(err)
+	}
+	if line := conn.expect(t, "JOIN "); line != "JOIN #channel" {
+		t.Errorf("Joined with %q, want %q", line, "JOIN #channel")
+	}
+
+	conn.send(t, `@badge-info=subscriber/8;badges=subscriber/6,bits/1000;bits=100;color=#1E90FF;`+
+		`display-name=Some\sUser;emotes=25:0-4,12-16/1902:6-10;id=abc-123;mod=0;tmi-sent-ts=1700000000000 `+
+		`:someuser!someuser@someuser.tmi.twitch.tv PRIVMSG #channel :Kappa Keepo Kappa cheer100`)
+
+	cm, ok := receive(t, client).ChatMessage()
+	if !ok {
+		t.Fatal("PRIVMSG is not a chat message")
+	}
+	if cm.Id != "abc-123" || cm.Channel != "channel" || cm.User != "someuser" {
+		t.Errorf("Got id %q, channel %q, user %q", cm.Id, cm.Channel, cm.User)
+	}
+	if cm.DisplayName != "Some User" {
+		t.Errorf("Display name is %q, want %q", cm.DisplayName, "Some User")
+	}
+	if cm.Color != "#1E90FF" {
+		t.Errorf("Color is %q, want %q", cm.Color, "#1E90FF")
+	}
+	if len(cm.Badges) != 2 || cm.Badges[0] != (Badge{"subscriber", "6"}) || cm.Badges[1] != (Badge{"bits", "1000"}) {
+		t.Errorf("Badges are %v", cm.Badges)
+	}
+	if !cm.HasBadge("bits") || cm.HasBadge("moderator") {
+		t.Errorf("HasBadge disagrees with badges %v", cm.Badges)
+	}
+	want := []Emote{{"25", 0, 4}, {"25", 12, 16}, {"1902", 6, 10}}
+	if len(cm.Emotes) != len(want) {
+		t.Fatalf("Emotes are %v, want %v", cm.Emotes, want)
+	}
+	for i := range want {
+		if cm.Emotes[i] != want[i] {
+			t.Errorf("Emote %d is %v, want %v", i, cm.Emotes[i], want[i])
+		}
+	}
+	if cm.Bits != 100 {
+		t.Errorf("Bits are %d, want 100", cm.Bits)
+	}
+	if !cm.Sent.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("Sent at %s", cm.Sent)
+	}
+	if cm.Text != "Kappa Keepo Kappa cheer100" || cm.Action {
+		t.Errorf("Text is %q, action %t", cm.Text, cm.Action)
+	}
+}
+
+func TestPing(t *testing.T) {
+	s := newFakeServer(t)
+	client, conn := connect(t, s, "", "")
+
+	conn.send(t, "PING :tmi.twitch.tv")
+	if line := conn.expect(t, "PONG "); line != "PONG :tmi.twitch.tv" {
+		t.Errorf("Replied %q, want %q", line, "PONG :tmi.twitch.tv")
+	}
+
+	conn.send(t, ":someuser!someuser@someuser.tmi.twitch.tv PRIVMSG #channel :still here")
+	if msg := receive(t, client); msg.Command != "PRIVMSG" {
+		t.Errorf("Got %s after PING, want PRIVMSG", msg.Command)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	s := newFakeServer(t)
+	client, conn := connect(t, s, "", "")
+
+	client.Join("channel")
+	conn.expect(t, "JOIN ")
+
+	conn.send(t, ":tmi.twitch.tv RECONNECT")
+
+	next := s.accept(t)
+	next.login(t)
+	if line := next.expect(t, "JOIN "); line != "JOIN #channel" {
+		t.Errorf("Rejoined with %q, want %q", line, "JOIN #channel")
+	}
+
+	next.send(t, ":someuser!someuser@someuser.tmi.twitch.tv PRIVMSG #channel :welcome back")
+	msg := receive(t, client)
+	if msg.Command != "PRIVMSG" || msg.Trailing() != "welcome back" {
+		t.Errorf("Got %q after reconnecting", msg.Raw)
+	}
+	if err := client.Err(); err != nil {
+		t.Errorf("Client failed: %s", err)
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	timeout := readTimeout
+	t.Cleanup(func() { readTimeout = timeout })
+	readTimeout = 200 * time.Millisecond
+
+	s := newFakeServer(t)
+	client, _ := connect(t, s, "", "")
+
+	next := s.accept(t)
+	next.login(t)
+
+	next.send(t, ":someuser!someuser@someuser.tmi.twitch.tv PRIVMSG #channel :hello")
+	if msg := receive(t, client); msg.Trailing() != "hello" {
+		t.Errorf("Got %q after reconnecting", msg.Raw)
+	}
+}
+
+// brokenTransport fails every write, like a connection reset by the server.
+type brokenTransport struct{}
+
+func (brokenTransport) ReadLine() (string, error)   { return "", fmt.Errorf("Connection reset") }
+func (brokenTransport) WriteLine(line string) error { return fmt.Errorf("Connection reset") }
+func (brokenTransport) Close() error                { return nil }
+
+func TestPongFailed(t *testing.T) {
+	s := newFakeServer(t)
+	client := NewChatClient(s.url(), "", "", testTimeout).(*chatClient)
+	defer client.Close()
+
+	errc := make(chan error, 1)
+	go func() { errc <- client.handle(brokenTransport{}, "PING :tmi.twitch.tv") }()
+
+	s.accept(t).login(t)
+	if err := <-errc; err != nil {
+		t.Errorf("Failed PONG ended the client: %s", err)
+	}
+}
+
+func TestClosedWhileConnecting(t *testing.T) {
+	s := newFakeServer(t)
+	client := NewChatClient(s.url(), "", "", testTimeout)
+
+	errc := make(chan error, 1)
+	go func() { errc <- client.Connect() }()
+
+	conn := s.accept(t)
+	conn.expect(t, "NICK ")
+	client.Close()
+	conn.send(t, ":tmi.twitch.tv 001 justinfan1 :Welcome, GLHF!")
+
+	if err := <-errc; err == nil {
+		t.Error("Connect succeeded after Close")
+	}
+	select {
+	case _, ok := <-client.Messages():
+		if ok {
+			t.Error("Got a message after Close")
+		}
+	case <-time.After(testTimeout):
+		t.Error("Messages were not closed")
+	}
+}
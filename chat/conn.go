@@ -0,0 +1,131 @@
+package chat
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// readTimeout is a little above the ~5 minutes Twitch waits between PINGs, so
+// a connection that silently died is noticed and reconnected.
+var readTimeout = 6 * time.Minute
+
+type transport interface {
+	ReadLine() (string, error)
+	WriteLine(line string) error
+	Close() error
+}
+
+type streamTransport struct {
+	conn net.Conn
+	r    *bufio.Reader
+
+	mu sync.Mutex
+}
+
+type webSocketTransport struct {
+	conn    *websocket.Conn
+	pending []string
+
+	mu sync.Mutex
+}
+
+// dial accepts "host:port" or "ircs://host:port" for TLS, "irc://host:port" for
+// plain TCP and "ws://" or "wss://" urls for WebSocket.
+func dial(server string, timeout time.Duration) (transport, error) {
+	u, err := url.Parse(server)
+	if err != nil || u.Host == "" {
+		u = &url.URL{Scheme: "ircs", Host: server}
+	}
+
+	switch u.Scheme {
+	case "ws", "wss":
+		conn, _, err := (&websocket.Dialer{HandshakeTimeout: timeout}).Dial(u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		return &webSocketTransport{conn: conn}, nil
+	case "irc":
+		conn, err := net.DialTimeout("tcp", u.Host, timeout)
+		if err != nil {
+			return nil, err
+		}
+		return newStreamTransport(conn), nil
+	default:
+		conn, err := tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", u.Host, nil)
+		if err != nil {
+			return nil, err
+		}
+		return newStreamTransport(conn), nil
+	}
+}
+
+func newStreamTransport(conn net.Conn) *streamTransport {
+	return &streamTransport{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+	}
+}
+
+func (t *streamTransport) ReadLine() (string, error) {
+	t.conn.SetReadDeadline(time.Now().Add(readTimeout))
+	line, err := t.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (t *streamTransport) WriteLine(line string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := t.conn.Write([]byte(line + "\r\n"))
+
+	return err
+}
+
+func (t *streamTransport) Close() error {
+	return t.conn.Close()
+}
+
+func (t *webSocketTransport) ReadLine() (string, error) {
+	for len(t.pending) == 0 {
+		t.conn.SetReadDeadline(time.Now().Add(readTimeout))
+		_, data, err := t.conn.ReadMessage()
+		if err != nil {
+			return "", err
+		}
+		for _, line := range strings.Split(string(data), "\r\n") {
+			if line != "" {
+				t.pending = append(t.pending, line)
+			}
+		}
+	}
+
+	line := t.pending[0]
+	t.pending = t.pending[1:]
+
+	return line, nil
+}
+
+func (t *webSocketTransport) WriteLine(line string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+
+	return t.conn.WriteMessage(websocket.TextMessage, []byte(line))
+}
+
+func (t *webSocketTransport) Close() error {
+	return t.conn.Close()
+}
@@ -0,0 +1,243 @@
+package chat
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Message struct {
+	Raw     string
+	Tags    map[string]string
+	Prefix  string
+	Command string
+	Params  []string
+}
+
+type Badge struct {
+	Name    string
+	Version string
+}
+
+type Emote struct {
+	Id    string
+	Start int
+	End   int
+}
+
+type ChatMessage struct {
+	Id          string
+	Channel     string
+	User        string
+	DisplayName string
+	Color       string
+	Badges      []Badge
+	Emotes      []Emote
+	Bits        uint64
+	Text        string
+	Action      bool
+	Sent        time.Time
+}
+
+var tagUnescaper = strings.NewReplacer(`\:`, ";", `\s`, " ", `\\`, `\`, `\r`, "\r", `\n`, "\n")
+var tagEscaper = strings.NewReplacer(`\`, `\\`, ";", `\:`, " ", `\s`, "\r", `\r`, "\n", `\n`)
+
+func ParseMessage(line string) (msg Message, err error) {
+	msg.Raw = line
+	line = strings.TrimRight(line, "\r\n")
+
+	if strings.HasPrefix(line, "@") {
+		i := strings.IndexByte(line, ' ')
+		if i < 0 {
+			return msg, fmt.Errorf("Malformed IRC message: %s", msg.Raw)
+		}
+		msg.Tags = parseTags(line[1:i])
+		line = strings.TrimLeft(line[i+1:], " ")
+	}
+
+	if strings.HasPrefix(line, ":") {
+		i := strings.IndexByte(line, ' ')
+		if i < 0 {
+			return msg, fmt.Errorf("Malformed IRC message: %s", msg.Raw)
+		}
+		msg.Prefix = line[1:i]
+		line = strings.TrimLeft(line[i+1:], " ")
+	}
+
+	for line != "" {
+		if strings.HasPrefix(line, ":") {
+			msg.Params = append(msg.Params, line[1:])
+			break
+		}
+		i := strings.IndexByte(line, ' ')
+		if i < 0 {
+			msg.Params = append(msg.Params, line)
+			break
+		}
+		msg.Params = append(msg.Params, line[:i])
+		line = strings.TrimLeft(line[i+1:], " ")
+	}
+
+	if len(msg.Params) == 0 {
+		return msg, fmt.Errorf("Malformed IRC message: %s", msg.Raw)
+	}
+	msg.Command, msg.Params = strings.ToUpper(msg.Params[0]), msg.Params[1:]
+
+	return msg, nil
+}
+
+func parseTags(raw string) map[string]string {
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(raw, ";") {
+		if kv := strings.SplitN(tag, "=", 2); len(kv) == 2 {
+			tags[kv[0]] = tagUnescaper.Replace(kv[1])
+		} else if tag != "" {
+			tags[tag] = ""
+		}
+	}
+
+	return tags
+}
+
+func (m Message) String() string {
+	var sb strings.Builder
+	if len(m.Tags) > 0 {
+		sb.WriteByte('@')
+		first := true
+		for k, v := range m.Tags {
+			if !first {
+				sb.WriteByte(';')
+			}
+			first = false
+			sb.WriteString(k)
+			sb.WriteByte('=')
+			sb.WriteString(tagEscaper.Replace(v))
+		}
+		sb.WriteByte(' ')
+	}
+	if m.Prefix != "" {
+		sb.WriteByte(':')
+		sb.WriteString(m.Prefix)
+		sb.WriteByte(' ')
+	}
+	sb.WriteString(m.Command)
+	for i, p := range m.Params {
+		sb.WriteByte(' ')
+		if i == len(m.Params)-1 && (p == "" || strings.ContainsAny(p, " :") || p[0] == ':') {
+			sb.WriteByte(':')
+		}
+		sb.WriteString(p)
+	}
+
+	return sb.String()
+}
+
+func (m Message) Nick() string {
+	if i := strings.IndexByte(m.Prefix, '!'); i >= 0 {
+		return m.Prefix[:i]
+	}
+
+	return m.Prefix
+}
+
+func (m Message) Channel() string {
+	if len(m.Params) == 0 || !strings.HasPrefix(m.Params[0], "#") {
+		return ""
+	}
+
+	return m.Params[0][1:]
+}
+
+func (m Message) Trailing() string {
+	if len(m.Params) == 0 {
+		return ""
+	}
+
+	return m.Params[len(m.Params)-1]
+}
+
+func (m Message) ChatMessage() (cm ChatMessage, ok bool) {
+	if (m.Command != "PRIVMSG" && m.Command != "USERNOTICE") || len(m.Params) < 2 {
+		return cm, false
+	}
+
+	cm = ChatMessage{
+		Id:          m.Tags["id"],
+		Channel:     m.Channel(),
+		User:        m.Nick(),
+		DisplayName: m.Tags["display-name"],
+		Color:       m.Tags["color"],
+		Badges:      parseBadges(m.Tags["badges"]),
+		Emotes:      parseEmotes(m.Tags["emotes"]),
+		Text:        m.Trailing(),
+	}
+	if login := m.Tags["login"]; login != "" {
+		cm.User = login
+	}
+	if cm.DisplayName == "" {
+		cm.DisplayName = cm.User
+	}
+	if bits, err := strconv.ParseUint(m.Tags["bits"], 10, 64); err == nil {
+		cm.Bits = bits
+	}
+	if ts, err := strconv.ParseInt(m.Tags["tmi-sent-ts"], 10, 64); err == nil {
+		cm.Sent = time.Unix(0, ts*int64(time.Millisecond))
+	}
+	if strings.HasPrefix(cm.Text, "\x01ACTION ") && strings.HasSuffix(cm.Text, "\x01") {
+		cm.Action = true
+		cm.Text = cm.Text[len("\x01ACTION ") : len(cm.Text)-1]
+	}
+
+	return cm, true
+}
+
+func (cm ChatMessage) HasBadge(name string) bool {
+	for _, b := range cm.Badges {
+		if b.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseBadges(raw string) (badges []Badge) {
+	for _, b := range strings.Split(raw, ",") {
+		if b == "" {
+			continue
+		}
+		kv := strings.SplitN(b, "/", 2)
+		badge := Badge{Name: kv[0]}
+		if len(kv) == 2 {
+			badge.Version = kv[1]
+		}
+		badges = append(badges, badge)
+	}
+
+	return badges
+}
+
+// parseEmotes decodes "id:start-end,start-end/id:start-end"; positions are rune offsets.
+func parseEmotes(raw string) (emotes []Emote) {
+	for _, e := range strings.Split(raw, "/") {
+		kv := strings.SplitN(e, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		for _, pos := range strings.Split(kv[1], ",") {
+			se := strings.SplitN(pos, "-", 2)
+			if len(se) != 2 {
+				continue
+			}
+			start, err1 := strconv.Atoi(se[0])
+			end, err2 := strconv.Atoi(se[1])
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			emotes = append(emotes, Emote{Id: kv[0], Start: start, End: end})
+		}
+	}
+
+	return emotes
+}
@@ -0,0 +1,50 @@
+package chat
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	RateLimitWindow    = 30 * time.Second
+	RateLimitUser      = 20
+	RateLimitModerator = 100
+)
+
+type rateLimiter struct {
+	window time.Duration
+
+	mu   sync.Mutex
+	sent []time.Time
+}
+
+func newRateLimiter(window time.Duration) *rateLimiter {
+	return &rateLimiter{
+		window: window,
+	}
+}
+
+// wait blocks until fewer than limit messages were sent within the window, and
+// records a send. It returns false if done is closed first.
+func (r *rateLimiter) wait(limit int, done <-chan struct{}) bool {
+	for {
+		r.mu.Lock()
+		now := time.Now()
+		for len(r.sent) > 0 && now.Sub(r.sent[0]) >= r.window {
+			r.sent = r.sent[1:]
+		}
+		if len(r.sent) < limit {
+			r.sent = append(r.sent, now)
+			r.mu.Unlock()
+			return true
+		}
+		delay := r.sent[len(r.sent)-limit].Add(r.window).Sub(now)
+		r.mu.Unlock()
+
+		select {
+		case <-time.After(delay):
+		case <-done:
+			return false
+		}
+	}
+}
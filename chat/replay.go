@@ -0,0 +1,242 @@
+package chat
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultReplayLifetime = 10 * time.Second
+	DefaultReplayLines    = 8
+)
+
+// ReplayMessage is a chat message placed on the timeline of a recording.
+type ReplayMessage struct {
+	Offset      time.Duration `json:"offset"`
+	Sent        time.Time     `json:"sent"`
+	User        string        `json:"user"`
+	DisplayName string        `json:"display_name"`
+	Color       string        `json:"color,omitempty"`
+	Badges      []string      `json:"badges,omitempty"`
+	Text        string        `json:"text"`
+	Action      bool          `json:"action,omitempty"`
+}
+
+func NewReplayMessage(cm ChatMessage, offset time.Duration) ReplayMessage {
+	m := ReplayMessage{
+		Offset:      offset,
+		Sent:        cm.Sent,
+		User:        cm.User,
+		DisplayName: cm.DisplayName,
+		Color:       cm.Color,
+		Text:        cm.Text,
+		Action:      cm.Action,
+	}
+	for _, b := range cm.Badges {
+		m.Badges = append(m.Badges, b.Name+"/"+b.Version)
+	}
+
+	return m
+}
+
+func (m ReplayMessage) name() string {
+	if m.DisplayName != "" {
+		return m.DisplayName
+	}
+
+	return m.User
+}
+
+func (m ReplayMessage) String() string {
+	return m.format(m.name(), m.Text)
+}
+
+// format joins name and text like the chat shows them.
+func (m ReplayMessage) format(name, text string) string {
+	if m.Action {
+		return "* " + name + " " + text
+	}
+
+	return name + ": " + text
+}
+
+// Replay is the chat of a recording, with message offsets relative to its
+// start.
+type Replay struct {
+	Channel string `json:"channel"`
+	VideoId string `json:"video_id,omitempty"`
+	// Started is the broadcast time at offset zero of a live recording.
+	Started  time.Time       `json:"started,omitempty"`
+	Messages []ReplayMessage `json:"messages"`
+}
+
+// Cue shows messages on screen from Start to End.
+type Cue struct {
+	Start    time.Duration
+	End      time.Duration
+	Messages []ReplayMessage
+}
+
+// Cues lays the chat out as a rolling box of at most lines messages, each
+// shown for lifetime.
+func (r *Replay) Cues(lifetime time.Duration, lines int) []Cue {
+	msgs := make([]ReplayMessage, 0, len(r.Messages))
+	for _, m := range r.Messages {
+		if m.Offset >= 0 {
+			msgs = append(msgs, m)
+		}
+	}
+	sort.SliceStable(msgs, func(i, j int) bool {
+		return msgs[i].Offset < msgs[j].Offset
+	})
+
+	times := make([]time.Duration, 0, 2*len(msgs))
+	for _, m := range msgs {
+		times = append(times, m.Offset, m.Offset+lifetime)
+	}
+	sort.Slice(times, func(i, j int) bool {
+		return times[i] < times[j]
+	})
+
+	var cues []Cue
+	lo, hi := 0, 0
+	for i := 0; i+1 < len(times); i++ {
+		t, next := times[i], times[i+1]
+		if t == next {
+			continue
+		}
+		for hi < len(msgs) && msgs[hi].Offset <= t {
+			hi++
+		}
+		for lo < hi && msgs[lo].Offset+lifetime <= t {
+			lo++
+		}
+		if lo == hi {
+			continue
+		}
+
+		from := lo
+		if hi-from > lines {
+			from = hi - lines
+		}
+		cues = append(cues, Cue{
+			Start:    t,
+			End:      next,
+			Messages: msgs[from:hi],
+		})
+	}
+
+	return cues
+}
+
+func (r *Replay) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(r)
+}
+
+func srtTime(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+func (r *Replay) WriteSRT(w io.Writer, lifetime time.Duration, lines int) error {
+	bw := bufio.NewWriter(w)
+	for i, c := range r.Cues(lifetime, lines) {
+		fmt.Fprintf(bw, "%d\n%s --> %s\n", i+1, srtTime(c.Start), srtTime(c.End))
+		for _, m := range c.Messages {
+			name := m.name()
+			if m.Color != "" {
+				name = fmt.Sprintf(`<font color="%s">%s</font>`, m.Color, name)
+			}
+			fmt.Fprintln(bw, m.format(name, strings.Replace(m.Text, "\n", " ", -1)))
+		}
+		fmt.Fprintln(bw)
+	}
+
+	return bw.Flush()
+}
+
+func assTime(d time.Duration) string {
+	cs := d.Milliseconds() / 10
+	return fmt.Sprintf("%d:%02d:%02d.%02d", cs/360000, cs/6000%60, cs/100%60, cs%100)
+}
+
+// assColor converts #RRGGBB to the &HBBGGRR& of ASS override tags.
+func assColor(color string) string {
+	c := strings.TrimPrefix(color, "#")
+	if len(c) != 6 {
+		return ""
+	}
+
+	return "&H" + strings.ToUpper(c[4:6]+c[2:4]+c[0:2]) + "&"
+}
+
+var assEscaper = strings.NewReplacer("{", "(", "}", ")", `\`, "/", "\n", " ")
+
+const assHeader = `[Script Info]
+ScriptType: v4.00+
+PlayResX: 1920
+PlayResY: 1080
+WrapStyle: 0
+
+[V4+ Styles]
+Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding
+Style: Chat,Arial,32,&H00FFFFFF,&H000000FF,&H00000000,&H80000000,0,0,0,0,100,100,0,0,1,2,0,7,24,24,24,1
+
+[Events]
+Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
+`
+
+func (r *Replay) WriteASS(w io.Writer, lifetime time.Duration, lines int) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(assHeader)
+	for _, c := range r.Cues(lifetime, lines) {
+		texts := make([]string, len(c.Messages))
+		for i, m := range c.Messages {
+			name := assEscaper.Replace(m.name())
+			if color := assColor(m.Color); color != "" {
+				name = `{\c` + color + `}` + name + `{\r}`
+			}
+			texts[i] = m.format(name, assEscaper.Replace(m.Text))
+		}
+		fmt.Fprintf(bw, "Dialogue: 0,%s,%s,Chat,,0,0,0,,%s\n", assTime(c.Start), assTime(c.End), strings.Join(texts, `\N`))
+	}
+
+	return bw.Flush()
+}
+
+// Save writes the replay to base.chat.json, base.srt and base.ass.
+func (r *Replay) Save(base string, lifetime time.Duration, lines int) error {
+	files := []struct {
+		ext   string
+		write func(io.Writer) error
+	}{
+		{".chat.json", r.WriteJSON},
+		{".srt", func(w io.Writer) error { return r.WriteSRT(w, lifetime, lines) }},
+		{".ass", func(w io.Writer) error { return r.WriteASS(w, lifetime, lines) }},
+	}
+
+	for _, f := range files {
+		out, err := os.Create(base + f.ext)
+		if err != nil {
+			return err
+		}
+		if err := f.write(out); err != nil {
+			out.Close()
+			return err
+		}
+		if err := out.Close(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli"
+
+	"github.com/hchagen/twitch-player/chat"
+	"github.com/hchagen/twitch-player/recorder"
+	"github.com/hchagen/twitch-player/remux"
+	"github.com/hchagen/twitch-player/twitch"
+)
+
+var chatReplayFlags = []cli.Flag{
+	cli.BoolFlag{
+		Name:  "chat-replay",
+		Usage: "Save chat next to the video as JSON, SRT and ASS subtitles (added as a track with --remux mkv)",
+	},
+	cli.DurationFlag{
+		Name:  "chat-replay-lifetime",
+		Usage: "How long a message stays in the chat subtitles",
+		Value: chat.DefaultReplayLifetime,
+	},
+	cli.IntFlag{
+		Name:  "chat-replay-lines",
+		Usage: "Maximum number of messages in the chat subtitles",
+		Value: chat.DefaultReplayLines,
+	},
+}
+
+// chatCapture keeps the chat of a live recording until it is saved with the
+// part it belongs to.
+type chatCapture struct {
+	client chat.Client
+
+	mu       sync.Mutex
+	messages []chat.ChatMessage
+	wg       sync.WaitGroup
+}
+
+func startChatCapture(channel string) (*chatCapture, error) {
+	client := chat.NewChatClient(chat.IrcServer, "", "", DefaultTwitchHttpTimeout)
+	if err := client.Join(channel); err != nil {
+		return nil, err
+	}
+	if err := client.Connect(); err != nil {
+		return nil, err
+	}
+
+	c := &chatCapture{client: client}
+	c.wg.Add(1)
+	go c.receive()
+
+	return c, nil
+}
+
+func (c *chatCapture) receive() {
+	defer c.wg.Done()
+
+	for msg := range c.client.Messages() {
+		cm, ok := msg.ChatMessage()
+		if !ok || msg.Command != "PRIVMSG" {
+			continue
+		}
+		if cm.Sent.IsZero() {
+			cm.Sent = time.Now()
+		}
+
+		c.mu.Lock()
+		c.messages = append(c.messages, cm)
+		c.mu.Unlock()
+	}
+}
+
+// Replay returns the messages sent while the part was recorded, placed on its
+// timeline, and forgets the ones before its end. Messages sent during skipped
+// ads are dropped and later ones moved up by the skipped time.
+func (c *chatCapture) Replay(p recorder.Part) *chat.Replay {
+	start := p.ProgramDateTime
+	if start.IsZero() {
+		start = p.Started
+	}
+	end := start.Add(p.BroadcastDuration())
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r := &chat.Replay{
+		Channel: p.Channel,
+		Started: start,
+	}
+	kept := c.messages[:0]
+	for _, cm := range c.messages {
+		if !cm.Sent.Before(end) {
+			kept = append(kept, cm)
+			continue
+		}
+		if cm.Sent.Before(start) {
+			continue
+		}
+		if offset, ok := p.PartOffset(cm.Sent.Sub(start)); ok {
+			r.Messages = append(r.Messages, chat.NewReplayMessage(cm, offset))
+		}
+	}
+	c.messages = kept
+
+	return r
+}
+
+func (c *chatCapture) Close() error {
+	err := c.client.Close()
+	c.wg.Wait()
+
+	return err
+}
+
+// fetchVideoChat returns the comments of a video from one offset to another,
+// or to the end if to is zero, with offsets relative to from.
+func fetchVideoChat(video twitch.Video, from, to time.Duration) (*chat.Replay, error) {
+	r := &chat.Replay{
+		Channel: video.Channel.Name,
+		VideoId: video.Id,
+	}
+
+	var cursor string
+	for {
+		cr, err := twitchClient().GetVideoComments(video.Id, from, cursor)
+		if err != nil {
+			if cursor != "" {
+				fmt.Println("")
+			}
+			return r, err
+		}
+
+		ended := false
+		for _, c := range cr.Comments {
+			offset := c.Offset()
+			if offset < from {
+				continue
+			}
+			if to > 0 && offset >= to {
+				ended = true
+				break
+			}
+
+			m := chat.ReplayMessage{
+				Offset: offset - from,
+				Sent:   c.Created,
+				Color:  c.Message.UserColor,
+				Text:   c.Text(),
+			}
+			if c.Commenter != nil {
+				m.User, m.DisplayName = c.Commenter.Login, c.Commenter.DisplayName
+			}
+			for _, b := range c.Message.UserBadges {
+				m.Badges = append(m.Badges, b.SetId+"/"+b.Version)
+			}
+			r.Messages = append(r.Messages, m)
+		}
+		fmt.Printf("\rFetched %d chat messages", len(r.Messages))
+
+		if ended || cr.Cursor == "" {
+			fmt.Println("")
+			return r, nil
+		}
+		cursor = cr.Cursor
+	}
+}
+
+// saveChatReplay writes the replay next to the video at path.
+func saveChatReplay(ctx *cli.Context, replay *chat.Replay, path string) error {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	if err := replay.Save(base, ctx.Duration("chat-replay-lifetime"), ctx.Int("chat-replay-lines")); err != nil {
+		return err
+	}
+	fmt.Printf("Saved %d chat messages to %s.chat.json, .srt and .ass\n", len(replay.Messages), base)
+
+	return nil
+}
+
+// chatSubtitles lays out the replay like the SRT file, for a Matroska track.
+func chatSubtitles(ctx *cli.Context, replay *chat.Replay) []remux.Subtitle {
+	var subtitles []remux.Subtitle
+	for _, c := range replay.Cues(ctx.Duration("chat-replay-lifetime"), ctx.Int("chat-replay-lines")) {
+		lines := make([]string, len(c.Messages))
+		for i, m := range c.Messages {
+			lines[i] = m.String()
+		}
+		subtitles = append(subtitles, remux.Subtitle{
+			Start: c.Start,
+			End:   c.End,
+			Text:  strings.Join(lines, "\n"),
+		})
+	}
+
+	return subtitles
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/urfave/cli"
+
+	"github.com/hchagen/twitch-player/hls"
+	"github.com/hchagen/twitch-player/twitch"
+)
+
+var (
+	DefaultClipResultLen    = 10
+	DefaultClipPeriod       = twitch.ClipPeriodWeek
+	DefaultClipNameTemplate = "{channel}_{date}_{title}_{slug}.mp4"
+
+	unsafeFilenameChars = regexp.MustCompile(`[^\pL\pN._-]+`)
+)
+
+var clipListFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "channel,c",
+		Usage: "List top clips for channel",
+	},
+	cli.StringFlag{
+		Name:  "game,g",
+		Usage: "List top clips for game",
+	},
+	cli.StringFlag{
+		Name:  "period,p",
+		Usage: "Time window for top clips (day, week, month or all)",
+		Value: DefaultClipPeriod,
+	},
+	cli.IntFlag{
+		Name:  "number,n",
+		Usage: "Number of clips to list",
+		Value: DefaultClipResultLen,
+	},
+}
+
+func listClips(ctx *cli.Context) ([]twitch.Clip, error) {
+	switch ctx.String("period") {
+	case twitch.ClipPeriodDay, twitch.ClipPeriodWeek, twitch.ClipPeriodMonth, twitch.ClipPeriodAll:
+	default:
+		return nil, fmt.Errorf("Unknown period %s (day, week, month or all)", ctx.String("period"))
+	}
+
+	clips, err := twitchClient().GetClipList(ctx.String("channel"), ctx.String("game"), ctx.String("period"), ctx.Int("number"), "")
+	if err != nil {
+		return nil, err
+	}
+	if len(clips.Clips) == 0 {
+		return nil, fmt.Errorf("No clips found")
+	}
+
+	fmt.Printf("Listing top %d clips of the %s:\n\n", len(clips.Clips), ctx.String("period"))
+	printClips(clips.Clips)
+
+	return clips.Clips, nil
+}
+
+// selectClip accepts a bare slug or a clips.twitch.tv / twitch.tv/<channel>/clip/ url,
+// or lists top clips to select from.
+func selectClip(ctx *cli.Context) (twitch.Clip, error) {
+	if ctx.NArg() == 1 {
+		slug := ctx.Args()[0]
+		if u, err := url.Parse(slug); err == nil && u.Host != "" {
+			slug = path.Base(u.Path)
+		}
+		return twitchClient().GetClip(slug)
+	}
+
+	clips, err := listClips(ctx)
+	if err != nil {
+		return twitch.Clip{}, err
+	}
+	selection := getNumericInput(os.Stdout, fmt.Sprintf("\nSelect clip: [0-%d]: ", len(clips)-1), len(clips)-1)
+
+	return clips[selection], nil
+}
+
+func clipFilename(template string, clip twitch.Clip, uri twitch.StreamUrl) string {
+	sanitize := func(s string) string {
+		return strings.Trim(unsafeFilenameChars.ReplaceAllString(s, "_"), "_")
+	}
+
+	return strings.NewReplacer(
+		"{channel}", sanitize(clip.Broadcaster.Name),
+		"{date}", clip.Created.Local().Format("2006-01-02"),
+		"{title}", sanitize(clip.Title),
+		"{game}", sanitize(clip.Game),
+		"{slug}", sanitize(clip.Slug),
+		"{quality}", sanitize(uri.Quality),
+	).Replace(template)
+}
+
+func onClips(ctx *cli.Context) error {
+	if _, err := listClips(ctx); err != nil {
+		return err
+	}
+	fmt.Println("")
+
+	return nil
+}
+
+func onClipPlay(ctx *cli.Context) error {
+	clip, err := selectClip(ctx)
+	if err != nil {
+		return err
+	}
+
+	uris, err := twitchClient().GetClipUrls(clip.Slug)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\n%s - %s playing %s (%.0fs, %d views): %s\n\n",
+		clip.Broadcaster.DisplayName,
+		clip.Created.Local().Format("2006-01-02"),
+		clip.Game,
+		clip.Duration,
+		clip.Views,
+		clip.Title,
+	)
+
+	if err := playStreamUrl(ctx, clip.Slug, selectStreamUrl(os.Stdout, uris)); err != nil {
+		return err
+	}
+
+	waitForSignal()
+
+	return nil
+}
+
+func onClipDownload(ctx *cli.Context) error {
+	clip, err := selectClip(ctx)
+	if err != nil {
+		return err
+	}
+
+	uris, err := twitchClient().GetClipUrls(clip.Slug)
+	if err != nil {
+		return err
+	}
+
+	var uri twitch.StreamUrl
+	if quality := ctx.String("quality"); quality != "" {
+		if uri, err = findStreamUrl(uris, quality); err != nil {
+			return err
+		}
+	} else {
+		uri = uris[0]
+	}
+
+	output := clipFilename(ctx.String("output"), clip, uri)
+	fmt.Printf("Downloading %s %s to %s...\n", clip.Slug, uri.Quality, output)
+	size, err := hls.FetchSegment(segmentHttpClient, uri.URI, output)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Saved %s (%d KiB)\n", output, size/1024)
+
+	return nil
+}
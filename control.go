@@ -0,0 +1,180 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+
+	"github.com/hchagen/twitch-player/player"
+)
+
+const (
+	controlReadTimeout = 10 * time.Second
+	// controlWriteTimeout leaves time for switching channels.
+	controlWriteTimeout = 30 * time.Second
+	controlIdleTimeout  = time.Minute
+)
+
+var controlFlags = []cli.Flag{
+	cli.BoolFlag{
+		Name:  "no-mpris",
+		Usage: "Do not register with desktop media keys over D-Bus (MPRIS)",
+	},
+	cli.StringFlag{
+		Name:  "control-addr",
+		Usage: "Serve a remote control HTTP API on this address, e.g. :8081",
+	},
+	cli.StringFlag{
+		Name:   "control-token",
+		Usage:  "Bearer token required by the remote control API, and to serve it beyond localhost",
+		EnvVar: "TWITCH_PLAYER_CONTROL_TOKEN",
+	},
+}
+
+type controlRequest struct {
+	Channel string `json:"channel"`
+	Quality string `json:"quality"`
+	Volume  *int   `json:"volume"`
+}
+
+type controlError struct {
+	Error string `json:"error"`
+}
+
+// controlServer maps HTTP requests onto the stream session:
+//
+//	GET  /status
+//	POST /channel    {"channel": "name", "quality": "720p60"}
+//	POST /quality    {"quality": "720p60"}
+//	POST /pause, /resume, /fullscreen, /reload, /next, /previous, /stop
+//	POST /volume     {"volume": 80}
+type controlServer struct {
+	session *streamSession
+	token   string
+	server  *http.Server
+}
+
+func startControlServer(session *streamSession, addr, token string) (*controlServer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if ip := listener.Addr().(*net.TCPAddr).IP; token == "" && !ip.IsLoopback() {
+		listener.Close()
+		return nil, fmt.Errorf("Remote control on %s needs --control-token, or listen on 127.0.0.1", addr)
+	}
+
+	c := &controlServer{
+		session: session,
+		token:   token,
+	}
+	c.server = &http.Server{
+		Handler:      c,
+		ReadTimeout:  controlReadTimeout,
+		WriteTimeout: controlWriteTimeout,
+		IdleTimeout:  controlIdleTimeout,
+	}
+	go c.server.Serve(listener)
+
+	fmt.Printf("Remote control on http://%s/status\n", listener.Addr().String())
+
+	return c, nil
+}
+
+func (c *controlServer) Close() error {
+	return c.server.Close()
+}
+
+func (c *controlServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if c.token != "" {
+		auth := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(auth), []byte(c.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			c.reply(w, http.StatusUnauthorized, controlError{"Invalid or missing bearer token"})
+			return
+		}
+	}
+
+	if r.URL.Path == "/status" {
+		if r.Method != http.MethodGet {
+			c.reply(w, http.StatusMethodNotAllowed, controlError{"Use GET"})
+			return
+		}
+		c.reply(w, http.StatusOK, c.session.Status())
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		c.reply(w, http.StatusMethodNotAllowed, controlError{"Use POST"})
+		return
+	}
+
+	var req controlRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			c.reply(w, http.StatusBadRequest, controlError{err.Error()})
+			return
+		}
+	}
+
+	var err error
+	switch r.URL.Path {
+	case "/channel":
+		if req.Channel == "" {
+			c.reply(w, http.StatusBadRequest, controlError{"Missing channel"})
+			return
+		}
+		err = c.session.SwitchChannel(req.Channel, req.Quality)
+	case "/quality":
+		if req.Quality == "" {
+			c.reply(w, http.StatusBadRequest, controlError{"Missing quality"})
+			return
+		}
+		err = c.session.SwitchQuality(req.Quality)
+	case "/pause":
+		err = mediaPlayer().Pause()
+	case "/resume":
+		err = mediaPlayer().Resume()
+	case "/volume":
+		if req.Volume == nil {
+			c.reply(w, http.StatusBadRequest, controlError{"Missing volume"})
+			return
+		}
+		if *req.Volume < 0 || *req.Volume > player.MaxVolume {
+			c.reply(w, http.StatusBadRequest, controlError{fmt.Sprintf("Volume must be between 0 and %d", player.MaxVolume)})
+			return
+		}
+		err = mediaPlayer().SetVolume(*req.Volume)
+	case "/fullscreen":
+		err = c.session.ToggleFullscreen()
+	case "/reload":
+		err = c.session.Reload()
+	case "/next":
+		err = c.session.Next()
+	case "/previous":
+		err = c.session.Previous()
+	case "/stop":
+		c.session.Stop()
+	default:
+		c.reply(w, http.StatusNotFound, controlError{"Unknown command " + r.URL.Path})
+		return
+	}
+
+	if err != nil {
+		c.reply(w, http.StatusUnprocessableEntity, controlError{err.Error()})
+		return
+	}
+	c.reply(w, http.StatusOK, c.session.Status())
+}
+
+func (c *controlServer) reply(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/urfave/cli"
+
+	"github.com/hchagen/twitch-player/player"
+)
+
+const controlSocketUsage = "status, pause, resume, toggle, volume [+|-]<n>, quality <quality>, reload, switch <channel> [quality], next, previous, fullscreen, quit"
+
+// controlSocketDir holds one socket per running stream session, named by pid.
+// Without XDG_RUNTIME_DIR it falls back to the shared temporary directory,
+// where anyone could have created it first, so it must be a directory of
+// our own that nobody else can enter.
+func controlSocketDir() (string, error) {
+	name := fmt.Sprintf("twitch-player-%d", os.Getuid())
+	if base := os.Getenv("XDG_RUNTIME_DIR"); base != "" {
+		return filepath.Join(base, name), nil
+	}
+
+	dir := filepath.Join(os.TempDir(), name)
+	if err := os.Mkdir(dir, 0700); err != nil && !os.IsExist(err) {
+		return "", err
+	}
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return "", err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !fi.IsDir() || !ok || int(st.Uid) != os.Getuid() || fi.Mode().Perm() != 0700 {
+		return "", fmt.Errorf("Control socket directory %s is not a directory of user %d with mode 0700", dir, os.Getuid())
+	}
+
+	return dir, nil
+}
+
+type controlSocket struct {
+	session  *streamSession
+	path     string
+	listener net.Listener
+}
+
+func startControlSocket(session *streamSession) (*controlSocket, error) {
+	dir, err := controlSocketDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("%d.sock", os.Getpid()))
+	os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &controlSocket{
+		session:  session,
+		path:     path,
+		listener: listener,
+	}
+	go c.accept()
+
+	return c, nil
+}
+
+func (c *controlSocket) Close() error {
+	err := c.listener.Close()
+	os.Remove(c.path)
+
+	return err
+}
+
+func (c *controlSocket) accept() {
+	for {
+		conn, err := c.listener.Accept()
+		if err != nil {
+			return
+		}
+		go c.serve(conn)
+	}
+}
+
+// serve answers every command line with one line, starting with ok or error.
+func (c *controlSocket) serve(conn net.Conn) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		reply, err := runControlCommand(c.session, line)
+		if err != nil {
+			// keep the error on its single reply line
+			fmt.Fprintf(conn, "error %s\n", strings.NewReplacer("\r", " ", "\n", " ").Replace(err.Error()))
+			continue
+		}
+		if reply == "" {
+			fmt.Fprintln(conn, "ok")
+		} else {
+			fmt.Fprintf(conn, "ok %s\n", reply)
+		}
+	}
+}
+
+func runControlCommand(session *streamSession, line string) (string, error) {
+	args := strings.Fields(line)
+
+	switch args[0] {
+	case "status":
+		data, err := json.Marshal(session.Status())
+		return string(data), err
+	case "pause":
+		return "", mediaPlayer().Pause()
+	case "resume", "play":
+		return "", mediaPlayer().Resume()
+	case "toggle":
+		if state, err := mediaPlayer().State(); err == nil && state == player.StatePaused {
+			return "", mediaPlayer().Resume()
+		}
+		return "", mediaPlayer().Pause()
+	case "volume":
+		if len(args) != 2 {
+			return "", fmt.Errorf("Usage: volume [+|-]<n>")
+		}
+		return adjustVolume(args[1])
+	case "quality":
+		if len(args) != 2 {
+			return "", fmt.Errorf("Usage: quality <quality>")
+		}
+		return "", session.SwitchQuality(args[1])
+	case "reload":
+		return "", session.Reload()
+	case "next":
+		return "", session.Next()
+	case "previous", "prev":
+		return "", session.Previous()
+	case "switch":
+		if len(args) < 2 || len(args) > 3 {
+			return "", fmt.Errorf("Usage: switch <channel> [quality]")
+		}
+		quality := ""
+		if len(args) == 3 {
+			quality = args[2]
+		}
+		return "", session.SwitchChannel(args[1], quality)
+	case "fullscreen":
+		return "", session.ToggleFullscreen()
+	case "quit", "stop":
+		session.Stop()
+		return "", nil
+	}
+
+	return "", fmt.Errorf("Unknown command %s (%s)", args[0], controlSocketUsage)
+}
+
+// adjustVolume sets an absolute volume, or changes it for a leading + or -.
+func adjustVolume(arg string) (string, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil {
+		return "", fmt.Errorf("Invalid volume %s", arg)
+	}
+
+	volume := n
+	if strings.HasPrefix(arg, "+") || strings.HasPrefix(arg, "-") {
+		current, err := mediaPlayer().Volume()
+		if err != nil {
+			return "", err
+		}
+		volume = current + n
+	}
+	if volume < 0 {
+		volume = 0
+	} else if volume > player.MaxVolume {
+		volume = player.MaxVolume
+	}
+	if err := mediaPlayer().SetVolume(volume); err != nil {
+		return "", err
+	}
+
+	return strconv.Itoa(volume), nil
+}
+
+// findControlSocket returns the socket of the given session pid, or of the
+// most recently started session still running.
+func findControlSocket(pid int) (string, error) {
+	dir, err := controlSocketDir()
+	if err != nil {
+		return "", err
+	}
+	if pid > 0 {
+		return filepath.Join(dir, fmt.Sprintf("%d.sock", pid)), nil
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	var newest os.FileInfo
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), ".sock") {
+			continue
+		}
+		conn, err := net.DialTimeout("unix", filepath.Join(dir, f.Name()), time.Second)
+		if err != nil {
+			continue
+		}
+		conn.Close()
+		if newest == nil || f.ModTime().After(newest.ModTime()) {
+			newest = f
+		}
+	}
+	if newest == nil {
+		return "", fmt.Errorf("No running stream session found")
+	}
+
+	return filepath.Join(dir, newest.Name()), nil
+}
+
+func onCtl(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return fmt.Errorf("Please provide a command: %s", controlSocketUsage)
+	}
+
+	path, err := findControlSocket(ctx.Int("session"))
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("unix", path, DefaultTwitchHttpTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := fmt.Fprintln(conn, strings.Join(ctx.Args(), " ")); err != nil {
+		return err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	reply = strings.TrimSpace(reply)
+
+	if strings.HasPrefix(reply, "error ") {
+		return fmt.Errorf("%s", strings.TrimPrefix(reply, "error "))
+	}
+	if reply = strings.TrimPrefix(strings.TrimPrefix(reply, "ok"), " "); reply != "" {
+		fmt.Println(reply)
+	}
+
+	return nil
+}
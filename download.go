@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+
+	"github.com/hchagen/twitch-player/chat"
+	"github.com/hchagen/twitch-player/hls"
+	"github.com/hchagen/twitch-player/twitch"
+)
+
+func findStreamUrl(uris []twitch.StreamUrl, quality string) (twitch.StreamUrl, error) {
+	names := make([]string, 0, len(uris))
+	for _, uri := range uris {
+		if strings.EqualFold(uri.Quality, quality) || strings.EqualFold(uri.Resolution, quality) {
+			return uri, nil
+		}
+		names = append(names, uri.Quality)
+	}
+
+	return twitch.StreamUrl{}, fmt.Errorf("Quality %s not available (%s)", quality, strings.Join(names, ", "))
+}
+
+func onVodDownload(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("Please provide a video id")
+	}
+
+	if err := checkRemuxFlag(ctx); err != nil {
+		return err
+	}
+
+	from, to := ctx.Duration("from"), ctx.Duration("to")
+	if to > 0 && to <= from {
+		return fmt.Errorf("--to must be after --from")
+	}
+
+	video, err := twitchClient().GetVideo(ctx.Args()[0])
+	if err != nil {
+		return err
+	}
+	uris, err := twitchClient().GetVideoUrls(video.Id)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%s - %s playing %s (%s): %s\n\n",
+		video.Channel.DisplayName,
+		video.Published.Local().Format("2006-01-02"),
+		video.Game,
+		time.Duration(video.Length)*time.Second,
+		video.Title,
+	)
+
+	var uri twitch.StreamUrl
+	if quality := ctx.String("quality"); quality != "" {
+		if uri, err = findStreamUrl(uris, quality); err != nil {
+			return err
+		}
+	} else {
+		uri = selectStreamUrl(os.Stdout, uris)
+	}
+
+	output := ctx.String("output")
+	if output == "" {
+		output = fmt.Sprintf("%s_%s_%s.ts", video.Channel.Name, video.Published.Local().Format("2006-01-02"), strings.TrimPrefix(video.Id, "v"))
+	}
+
+	fmt.Printf("Downloading %s %s (%s) to %s...\n", video.Id, uri.Resolution, uri.Quality, output)
+	dl := &hls.Download{
+		Client:  segmentHttpClient,
+		Output:  output,
+		From:    from,
+		To:      to,
+		Workers: ctx.Int("workers"),
+		Progress: func(done, total int) {
+			fmt.Printf("\rDownloaded %d/%d segments (%d%%)", done, total, done*100/total)
+		},
+	}
+	start, err := dl.Run(uri.URI)
+	if err != nil {
+		fmt.Println("")
+		return err
+	}
+	fmt.Printf("\nSaved %s\n", output)
+
+	var replay *chat.Replay
+	if ctx.Bool("chat-replay") {
+		// the download starts with the segment containing from
+		if replay, err = fetchVideoChat(video, start, to); err != nil {
+			return err
+		}
+		if err := saveChatReplay(ctx, replay, output); err != nil {
+			return err
+		}
+	}
+
+	if ctx.String("remux") != "" {
+		out, err := remuxRecording(ctx, output, replay)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Converted to %s\n", out)
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package history
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Entry struct {
+	VideoId  string        `json:"video_id"`
+	Channel  string        `json:"channel"`
+	Title    string        `json:"title"`
+	Position time.Duration `json:"position"`
+	Length   time.Duration `json:"length"`
+	Updated  time.Time     `json:"updated"`
+}
+
+type Store struct {
+	path string
+
+	mu      sync.Mutex
+	entries map[string]Entry
+}
+
+func (e Entry) Progress() float64 {
+	if e.Length <= 0 {
+		return 0
+	}
+
+	return float64(e.Position) / float64(e.Length)
+}
+
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path:    path,
+		entries: make(map[string]Entry),
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		s.entries[e.VideoId] = e
+	}
+
+	return s, nil
+}
+
+func (s *Store) Get(videoId string) (Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[videoId]
+
+	return e, ok
+}
+
+func (s *Store) Update(e Entry) error {
+	e.Updated = time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[e.VideoId] = e
+
+	return s.save()
+}
+
+// List returns entries with the most recently watched first.
+func (s *Store) List() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make([]Entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Updated.After(entries[j].Updated)
+	})
+
+	return entries
+}
+
+func (s *Store) save() error {
+	entries := make([]Entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		entries = append(entries, e)
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path)
+}
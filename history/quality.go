@@ -0,0 +1,78 @@
+package history
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Qualities remembers the quality last picked per channel.
+type Qualities struct {
+	path string
+
+	mu        sync.Mutex
+	qualities map[string]string
+}
+
+func OpenQualities(path string) (*Qualities, error) {
+	q := &Qualities{
+		path:      path,
+		qualities: make(map[string]string),
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return q, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &q.qualities); err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+func (q *Qualities) Get(channel string) (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	quality, ok := q.qualities[strings.ToLower(channel)]
+
+	return quality, ok
+}
+
+func (q *Qualities) Set(channel, quality string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	channel = strings.ToLower(channel)
+	if q.qualities[channel] == quality {
+		return nil
+	}
+	q.qualities[channel] = quality
+
+	return q.save()
+}
+
+func (q *Qualities) save() error {
+	data, err := json.MarshalIndent(q.qualities, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(q.path), 0755); err != nil {
+		return err
+	}
+
+	tmp := q.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, q.path)
+}
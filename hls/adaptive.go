@@ -0,0 +1,128 @@
+package hls
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+const (
+	adaptiveSmoothing  = 0.3
+	adaptiveDownFactor = 1.2
+	adaptiveUpFactor   = 1.5
+	adaptiveUpSegments = 5
+)
+
+// VariantResolver returns the current media playlist url for the named variant.
+type VariantResolver func(name string) (string, error)
+
+// Adaptive picks a variant from the throughput measured while fetching
+// segments. It steps down as soon as the smoothed throughput gets within
+// adaptiveDownFactor of the variant bitrate, and only steps up after
+// adaptiveUpSegments segments with adaptiveUpFactor headroom.
+type Adaptive struct {
+	// OnSwitch is called from the fetching goroutine after changing variants.
+	OnSwitch func(from, to Variant, throughput float64)
+
+	variants []Variant
+	resolve  VariantResolver
+
+	mu         sync.Mutex
+	current    int
+	segments   int
+	throughput float64
+}
+
+func NewAdaptive(variants []Variant, initial string, resolve VariantResolver) (*Adaptive, error) {
+	if len(variants) == 0 {
+		return nil, fmt.Errorf("No variants to switch between")
+	}
+
+	a := &Adaptive{
+		variants: append([]Variant(nil), variants...),
+		resolve:  resolve,
+		current:  -1,
+	}
+	sort.SliceStable(a.variants, func(i, j int) bool {
+		return a.variants[i].Bandwidth < a.variants[j].Bandwidth
+	})
+	for i, v := range a.variants {
+		if v.Name == initial {
+			a.current = i
+		}
+	}
+	if a.current < 0 {
+		return nil, fmt.Errorf("Variant %s is not among the adaptive variants", initial)
+	}
+
+	return a, nil
+}
+
+func (a *Adaptive) Current() Variant {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.variants[a.current]
+}
+
+// Throughput is the smoothed segment download rate in bits per second.
+func (a *Adaptive) Throughput() float64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.throughput
+}
+
+// Resolver resolves the current variant.
+func (a *Adaptive) Resolver() Resolver {
+	return func() (string, error) {
+		return a.resolve(a.Current().Name)
+	}
+}
+
+// Observe adds the throughput of a fetched segment and reports whether the
+// current variant changed. Prefetched segments download at the encoding rate,
+// so they are not counted.
+func (a *Adaptive) Observe(s *SegmentData) bool {
+	if s.Prefetch || s.FetchDuration <= 0 || len(s.Data) == 0 {
+		return false
+	}
+
+	a.mu.Lock()
+	bps := float64(len(s.Data)*8) / s.FetchDuration.Seconds()
+	if a.throughput == 0 {
+		a.throughput = bps
+	} else {
+		a.throughput = adaptiveSmoothing*bps + (1-adaptiveSmoothing)*a.throughput
+	}
+	a.segments++
+
+	next := a.current
+	if a.throughput < a.bitrate(next)*adaptiveDownFactor {
+		for next > 0 && a.throughput < a.bitrate(next)*adaptiveDownFactor {
+			next--
+		}
+	} else if a.segments >= adaptiveUpSegments {
+		for next+1 < len(a.variants) && a.throughput >= a.bitrate(next+1)*adaptiveUpFactor {
+			next++
+		}
+	}
+
+	if next == a.current {
+		a.mu.Unlock()
+		return false
+	}
+	from, to, throughput := a.variants[a.current], a.variants[next], a.throughput
+	a.current, a.segments = next, 0
+	a.mu.Unlock()
+
+	if a.OnSwitch != nil {
+		a.OnSwitch(from, to, throughput)
+	}
+
+	return true
+}
+
+func (a *Adaptive) bitrate(i int) float64 {
+	return float64(a.variants[i].Bandwidth)
+}
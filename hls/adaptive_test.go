@@ -0,0 +1,90 @@
+package hls
+
+import (
+	"testing"
+	"time"
+)
+
+var testVariants = []Variant{
+	{Name: "720p60", Bandwidth: 6000000},
+	{Name: "160p30", Bandwidth: 300000},
+	{Name: "480p30", Bandwidth: 1500000},
+}
+
+// fetched is a segment of size bytes that took a second to download.
+func fetched(size int) *SegmentData {
+	return &SegmentData{Data: make([]byte, size), FetchDuration: time.Second}
+}
+
+func TestNewAdaptive(t *testing.T) {
+	if _, err := NewAdaptive(nil, "720p60", nil); err == nil {
+		t.Error("Created an adaptive without variants")
+	}
+	if _, err := NewAdaptive(testVariants, "1080p60", nil); err == nil {
+		t.Error("Created an adaptive starting at an unknown variant")
+	}
+
+	a, err := NewAdaptive(testVariants, "480p30", func(name string) (string, error) {
+		return "https://example.com/" + name + ".m3u8", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Current().Name != "480p30" {
+		t.Errorf("Current variant is %s, want 480p30", a.Current().Name)
+	}
+	if uri, err := a.Resolver()(); err != nil || uri != "https://example.com/480p30.m3u8" {
+		t.Errorf("Resolved %q, %v", uri, err)
+	}
+}
+
+func TestAdaptiveObserve(t *testing.T) {
+	a, err := NewAdaptive(testVariants, "720p60", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var switches []string
+	a.OnSwitch = func(from, to Variant, throughput float64) {
+		switches = append(switches, from.Name+">"+to.Name)
+	}
+
+	if a.Observe(&SegmentData{Segment: Segment{Prefetch: true}, Data: make([]byte, 10), FetchDuration: time.Second}) {
+		t.Error("Switched on a prefetched segment")
+	}
+	if a.Throughput() != 0 {
+		t.Errorf("Throughput is %v after a prefetched segment, want it not counted", a.Throughput())
+	}
+
+	// 2 Mbit/s is too slow for 720p60, and steps down right away
+	if !a.Observe(fetched(250000)) {
+		t.Fatal("Did not step down at 2 Mbit/s")
+	}
+	if a.Current().Name != "480p30" {
+		t.Errorf("Stepped down to %s, want 480p30", a.Current().Name)
+	}
+
+	// 12 Mbit/s has room for 720p60, but only after adaptiveUpSegments
+	for i := 1; i < adaptiveUpSegments; i++ {
+		if a.Observe(fetched(1500000)) {
+			t.Fatalf("Stepped up after %d segments", i)
+		}
+	}
+	if !a.Observe(fetched(1500000)) {
+		t.Fatalf("Did not step up after %d fast segments", adaptiveUpSegments)
+	}
+	if a.Current().Name != "720p60" {
+		t.Errorf("Stepped up to %s, want 720p60", a.Current().Name)
+	}
+
+	// 100 kbit/s is below every variant, so it stops at the lowest
+	for i := 0; i < 20; i++ {
+		a.Observe(fetched(12500))
+	}
+	if a.Current().Name != "160p30" {
+		t.Errorf("Slowest variant is %s, want 160p30", a.Current().Name)
+	}
+
+	if len(switches) < 3 || switches[0] != "720p60>480p30" || switches[1] != "480p30>720p60" {
+		t.Errorf("Switches are %q", switches)
+	}
+}
@@ -0,0 +1,180 @@
+package hls
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafov/m3u8"
+)
+
+const (
+	dateRangeTagName = "#EXT-X-DATERANGE:"
+
+	TwitchAdClass    = "twitch-stitched-ad"
+	TwitchAdIdPrefix = "stitched-ad-"
+	twitchLiveTitle  = "live"
+	twitchAdTitle    = "Amazon"
+
+	AdModeKeep = "keep"
+	AdModeSkip = "skip"
+	AdModeHold = "hold"
+)
+
+type DateRange struct {
+	Id         string
+	Class      string
+	Start      time.Time
+	Duration   time.Duration
+	Attributes map[string]string
+}
+
+type AdEvent struct {
+	Id       string
+	Start    bool
+	Time     time.Time
+	Duration time.Duration
+	Segments int
+}
+
+// dateRangeTag decodes EXT-X-DATERANGE, which grafov/m3u8 otherwise drops.
+type dateRangeTag struct {
+	line string
+	DateRange
+}
+
+func (t *dateRangeTag) TagName() string {
+	return dateRangeTagName
+}
+
+func (t *dateRangeTag) SegmentTag() bool {
+	return true
+}
+
+func (t *dateRangeTag) Decode(line string) (m3u8.CustomTag, error) {
+	attrs := m3u8.DecodeAttributeList(strings.TrimPrefix(line, dateRangeTagName))
+
+	dr := &dateRangeTag{
+		line: line,
+		DateRange: DateRange{
+			Id:         attrs["ID"],
+			Class:      attrs["CLASS"],
+			Attributes: attrs,
+		},
+	}
+	if start, err := m3u8.TimeParse(attrs["START-DATE"]); err == nil {
+		dr.Start = start
+	}
+	if d, err := strconv.ParseFloat(attrs["DURATION"], 64); err == nil {
+		dr.Duration = time.Duration(d * float64(time.Second))
+	} else if d, err := strconv.ParseFloat(attrs["PLANNED-DURATION"], 64); err == nil {
+		dr.Duration = time.Duration(d * float64(time.Second))
+	}
+
+	return dr, nil
+}
+
+func (t *dateRangeTag) Encode() *bytes.Buffer {
+	return bytes.NewBufferString(t.line)
+}
+
+func (t *dateRangeTag) String() string {
+	return t.line
+}
+
+func (d DateRange) IsAd() bool {
+	return d.Class == TwitchAdClass || strings.HasPrefix(d.Id, TwitchAdIdPrefix)
+}
+
+func (d DateRange) Contains(t time.Time) bool {
+	return !t.Before(d.Start) && t.Before(d.Start.Add(d.Duration))
+}
+
+// markAds flags segments that carry or fall within a stitched ad date range,
+// or that Twitch titles as served by its ad provider. Other titles, which
+// Twitch also sets on regular segments, are ignored.
+func markAds(segments []Segment) {
+	var ranges []DateRange
+	for _, s := range segments {
+		if s.DateRange != nil && s.DateRange.IsAd() {
+			ranges = append(ranges, *s.DateRange)
+		}
+	}
+
+	for i := range segments {
+		s := &segments[i]
+		if strings.Contains(s.Title, twitchAdTitle) || s.DateRange != nil && s.DateRange.IsAd() {
+			s.Ad = true
+			continue
+		}
+		for _, r := range ranges {
+			if !s.ProgramDateTime.IsZero() && r.Contains(s.ProgramDateTime) {
+				s.Ad = true
+				break
+			}
+		}
+	}
+}
+
+// AdTracker turns a sequence of segments into ad break start and end events.
+type AdTracker struct {
+	inBreak  bool
+	current  AdEvent
+	segments int
+	duration time.Duration
+}
+
+func (t *AdTracker) Observe(s Segment) *AdEvent {
+	at := s.ProgramDateTime
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	if s.Ad && !t.inBreak {
+		t.inBreak = true
+		t.segments, t.duration = 1, s.Duration
+		t.current = AdEvent{Start: true, Time: at}
+		if s.DateRange != nil {
+			t.current.Id = s.DateRange.Id
+			t.current.Duration = s.DateRange.Duration
+		}
+		ev := t.current
+		return &ev
+	} else if s.Ad {
+		t.segments++
+		t.duration += s.Duration
+	} else if t.inBreak {
+		t.inBreak = false
+		return &AdEvent{
+			Id:       t.current.Id,
+			Time:     at,
+			Duration: t.duration,
+			Segments: t.segments,
+		}
+	}
+
+	return nil
+}
+
+// AdFilter applies an ad mode to fetched segments: keep passes them through,
+// skip drops them and hold replaces them with a slate segment.
+type AdFilter struct {
+	Mode  string
+	Slate []byte
+}
+
+func (f *AdFilter) Filter(s *SegmentData) []byte {
+	if !s.Ad {
+		return s.Data
+	}
+
+	switch f.Mode {
+	case AdModeSkip:
+		return nil
+	case AdModeHold:
+		return f.Slate
+	}
+
+	return s.Data
+}
@@ -0,0 +1,96 @@
+package hls
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMarkAds(t *testing.T) {
+	start := time.Date(2024, 3, 9, 18, 0, 0, 0, time.UTC)
+	ad := &DateRange{Id: "stitched-ad-1", Class: TwitchAdClass, Start: start.Add(4 * time.Second), Duration: 4 * time.Second}
+	other := &DateRange{Id: "source-1", Class: "twitch-session", Start: start, Duration: time.Hour}
+
+	tests := []struct {
+		name    string
+		segment Segment
+		want    bool
+	}{
+		{"live title", Segment{Title: "live"}, false},
+		{"no title", Segment{}, false},
+		{"unknown title", Segment{Title: "something new"}, false},
+		{"ad title", Segment{Title: "Amazon|123456"}, true},
+		{"ad date range", Segment{DateRange: ad, ProgramDateTime: start.Add(4 * time.Second)}, true},
+		{"other date range", Segment{DateRange: other, ProgramDateTime: start.Add(2 * time.Second)}, false},
+		{"within the ad", Segment{Title: "live", ProgramDateTime: start.Add(6 * time.Second)}, true},
+		{"after the ad", Segment{Title: "live", ProgramDateTime: start.Add(8 * time.Second)}, false},
+		{"undated", Segment{Title: "live"}, false},
+	}
+
+	segments := make([]Segment, len(tests))
+	for i, tt := range tests {
+		segments[i] = tt.segment
+	}
+	markAds(segments)
+
+	for i, tt := range tests {
+		if segments[i].Ad != tt.want {
+			t.Errorf("%s: Ad is %v, want %v", tt.name, segments[i].Ad, tt.want)
+		}
+	}
+}
+
+func TestAdTracker(t *testing.T) {
+	start := time.Date(2024, 3, 9, 18, 0, 0, 0, time.UTC)
+	dr := &DateRange{Id: "stitched-ad-1", Duration: 30 * time.Second}
+	segments := []Segment{
+		{ProgramDateTime: start, Duration: 2 * time.Second},
+		{ProgramDateTime: start.Add(2 * time.Second), Duration: 2 * time.Second, Ad: true, DateRange: dr},
+		{ProgramDateTime: start.Add(4 * time.Second), Duration: 2 * time.Second, Ad: true},
+		{ProgramDateTime: start.Add(6 * time.Second), Duration: 1 * time.Second, Ad: true},
+		{ProgramDateTime: start.Add(7 * time.Second), Duration: 2 * time.Second},
+	}
+
+	var tracker AdTracker
+	var events []AdEvent
+	for _, s := range segments {
+		if ev := tracker.Observe(s); ev != nil {
+			events = append(events, *ev)
+		}
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("Got %d events, want a start and an end", len(events))
+	}
+	if ev := events[0]; !ev.Start || ev.Id != dr.Id || ev.Duration != dr.Duration || !ev.Time.Equal(start.Add(2*time.Second)) {
+		t.Errorf("Start event is %+v", ev)
+	}
+	if ev := events[1]; ev.Start || ev.Id != dr.Id || ev.Segments != 3 || ev.Duration != 5*time.Second || !ev.Time.Equal(start.Add(7*time.Second)) {
+		t.Errorf("End event is %+v", ev)
+	}
+}
+
+func TestAdFilter(t *testing.T) {
+	slate := []byte("slate")
+	content := &SegmentData{Data: []byte("content")}
+	ad := &SegmentData{Segment: Segment{Ad: true}, Data: []byte("ad")}
+
+	tests := []struct {
+		mode    string
+		content string
+		ad      string
+	}{
+		{AdModeKeep, "content", "ad"},
+		{AdModeSkip, "content", ""},
+		{AdModeHold, "content", "slate"},
+	}
+
+	for _, tt := range tests {
+		f := &AdFilter{Mode: tt.mode, Slate: slate}
+		if got := string(f.Filter(content)); got != tt.content {
+			t.Errorf("%s mode turns content into %q, want %q", tt.mode, got, tt.content)
+		}
+		if got := string(f.Filter(ad)); got != tt.ad {
+			t.Errorf("%s mode turns an ad into %q, want %q", tt.mode, got, tt.ad)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package hls
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	segmentRetries = 3
+)
+
+type downloadState struct {
+	From  time.Duration `json:"from"`
+	To    time.Duration `json:"to"`
+	Total int           `json:"total"`
+	Done  map[int]int64 `json:"done"`
+}
+
+type Download struct {
+	Client   *http.Client
+	Output   string
+	From     time.Duration
+	To       time.Duration
+	Workers  int
+	Progress func(done, total int)
+
+	mu    sync.Mutex
+	state downloadState
+}
+
+func (d *Download) stateFile() string {
+	return d.Output + ".state"
+}
+
+func (d *Download) partsDir() string {
+	return d.Output + ".parts"
+}
+
+func (d *Download) partFile(index int) string {
+	return filepath.Join(d.partsDir(), fmt.Sprintf("%06d.ts", index))
+}
+
+// loadState resumes a previous download of the same range, verifying parts on disk.
+func (d *Download) loadState(total int) error {
+	d.state = downloadState{
+		From:  d.From,
+		To:    d.To,
+		Total: total,
+		Done:  make(map[int]int64),
+	}
+
+	data, err := ioutil.ReadFile(d.stateFile())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var prev downloadState
+	if err := json.Unmarshal(data, &prev); err != nil {
+		return fmt.Errorf("Reading download state %s: %s", d.stateFile(), err.Error())
+	}
+	if prev.From != d.From || prev.To != d.To || prev.Total != total {
+		return fmt.Errorf("Download state %s is for a different range, remove it to start over", d.stateFile())
+	}
+
+	for index, size := range prev.Done {
+		if fi, err := os.Stat(d.partFile(index)); err == nil && fi.Size() == size {
+			d.state.Done[index] = size
+		}
+	}
+
+	return nil
+}
+
+func (d *Download) saveState() error {
+	data, err := json.Marshal(d.state)
+	if err != nil {
+		return err
+	}
+
+	tmp := d.stateFile() + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, d.stateFile())
+}
+
+// Run downloads the segments overlapping From and To and returns the start
+// of the first one, which is where the output begins.
+func (d *Download) Run(playlistUri string) (time.Duration, error) {
+	pl, err := FetchMediaPlaylist(d.Client, playlistUri)
+	if err != nil {
+		return 0, err
+	}
+
+	segments := pl.Slice(d.From, d.To)
+	if len(segments) == 0 {
+		return 0, fmt.Errorf("No segments in range %s-%s (video is %s)", d.From, d.To, pl.Duration())
+	}
+
+	if err := d.loadState(len(segments)); err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(d.partsDir(), 0755); err != nil {
+		return 0, err
+	}
+
+	if err := d.fetchAll(segments); err != nil {
+		return 0, err
+	}
+
+	if err := d.concat(segments); err != nil {
+		return 0, err
+	}
+
+	os.RemoveAll(d.partsDir())
+	os.Remove(d.stateFile())
+
+	return segments[0].Start, nil
+}
+
+func (d *Download) fetchAll(segments []Segment) error {
+	workers := d.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	jobs := make(chan Segment)
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s := range jobs {
+				if err := d.fetch(s); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	d.reportProgress()
+
+	var err error
+feed:
+	for i, s := range segments {
+		d.mu.Lock()
+		_, done := d.state.Done[i]
+		d.mu.Unlock()
+		if done {
+			continue
+		}
+
+		s.Index = i
+		select {
+		case jobs <- s:
+		case err = <-errs:
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err == nil {
+		select {
+		case err = <-errs:
+		default:
+		}
+	}
+
+	return err
+}
+
+func (d *Download) fetch(s Segment) error {
+	var err error
+	for i := 0; i < segmentRetries; i++ {
+		var size int64
+		if size, err = FetchSegment(d.Client, s.URI, d.partFile(s.Index)); err == nil {
+			d.mu.Lock()
+			d.state.Done[s.Index] = size
+			err = d.saveState()
+			d.mu.Unlock()
+			d.reportProgress()
+			return err
+		}
+		time.Sleep(time.Duration(i+1) * time.Second)
+	}
+
+	return fmt.Errorf("Downloading segment %d: %s", s.Index, err.Error())
+}
+
+func (d *Download) reportProgress() {
+	if d.Progress == nil {
+		return
+	}
+
+	d.mu.Lock()
+	done, total := len(d.state.Done), d.state.Total
+	d.mu.Unlock()
+
+	d.Progress(done, total)
+}
+
+func (d *Download) concat(segments []Segment) error {
+	for i := range segments {
+		if _, ok := d.state.Done[i]; !ok {
+			return fmt.Errorf("Segment %d missing", i)
+		}
+	}
+
+	out, err := os.Create(d.Output)
+	if err != nil {
+		return err
+	}
+
+	for i := range segments {
+		if err := appendFile(out, d.partFile(i)); err != nil {
+			out.Close()
+			return err
+		}
+	}
+
+	return out.Close()
+}
+
+func appendFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+
+	return err
+}
+
+// FetchSegment downloads uri to path, verifying the length against Content-Length.
+func FetchSegment(client *http.Client, uri, path string) (int64, error) {
+	res, err := client.Get(uri)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return 0, StatusError{res.StatusCode, res.Status}
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := io.Copy(f, res.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && res.ContentLength >= 0 && n != res.ContentLength {
+		err = fmt.Errorf("Short read: got %d of %d bytes", n, res.ContentLength)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+
+	return n, os.Rename(tmp, path)
+}
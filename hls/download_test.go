@@ -0,0 +1,131 @@
+package hls
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func vodCdn(t *testing.T) *fakeCdn {
+	files := map[string]string{"/index.m3u8": playlist(true, segmentLines(4)...)}
+	for i := 0; i < 4; i++ {
+		files[fmt.Sprintf("/seg%d.ts", i)] = strings.Repeat(fmt.Sprint(i), 10+i)
+	}
+
+	return newFakeCdn(t, files)
+}
+
+func TestDownload(t *testing.T) {
+	cdn := vodCdn(t)
+	d := &Download{
+		Client:  http.DefaultClient,
+		Output:  filepath.Join(t.TempDir(), "vod.ts"),
+		From:    3 * time.Second,
+		Workers: 2,
+	}
+
+	start, err := d.Run(cdn.URL + "/index.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if start != 2*time.Second {
+		t.Errorf("Output starts at %s, want the start of the segment overlapping --from", start)
+	}
+
+	data, err := ioutil.ReadFile(d.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Repeat("1", 11) + strings.Repeat("2", 12) + strings.Repeat("3", 13); string(data) != want {
+		t.Errorf("Output is %q, want %q", data, want)
+	}
+	if cdn.requested("/seg0.ts") != 0 {
+		t.Error("Fetched a segment before the range")
+	}
+	for _, path := range []string{d.stateFile(), d.partsDir()} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s was left behind", path)
+		}
+	}
+}
+
+func TestDownloadResume(t *testing.T) {
+	cdn := vodCdn(t)
+	d := &Download{
+		Client: http.DefaultClient,
+		Output: filepath.Join(t.TempDir(), "vod.ts"),
+	}
+
+	// segment 0 is complete, segment 1 was cut off after the state was saved
+	if err := os.MkdirAll(d.partsDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(d.partFile(0), []byte(strings.Repeat("0", 10)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(d.partFile(1), []byte("1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	state, err := json.Marshal(downloadState{Total: 4, Done: map[int]int64{0: 10, 1: 11}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(d.stateFile(), state, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var progress []string
+	d.Progress = func(done, total int) {
+		progress = append(progress, fmt.Sprintf("%d/%d", done, total))
+	}
+	if _, err := d.Run(cdn.URL + "/index.m3u8"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range []int{0, 1, 1, 1} {
+		if n := cdn.requested(fmt.Sprintf("/seg%d.ts", i)); n != want {
+			t.Errorf("Segment %d was fetched %d times, want %d", i, n, want)
+		}
+	}
+	if progress[0] != "1/4" || progress[len(progress)-1] != "4/4" {
+		t.Errorf("Progress is %v, want it to go from 1/4 to 4/4", progress)
+	}
+	data, err := ioutil.ReadFile(d.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 10+11+12+13 {
+		t.Errorf("Output has %d bytes, want %d", len(data), 10+11+12+13)
+	}
+}
+
+func TestDownloadOtherRange(t *testing.T) {
+	cdn := vodCdn(t)
+	d := &Download{
+		Client: http.DefaultClient,
+		Output: filepath.Join(t.TempDir(), "vod.ts"),
+		To:     4 * time.Second,
+	}
+	state, err := json.Marshal(downloadState{Total: 4, Done: map[int]int64{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(d.stateFile(), state, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := d.Run(cdn.URL + "/index.m3u8"); err == nil || !strings.Contains(err.Error(), "different range") {
+		t.Errorf("Error is %v, want a different range to be refused", err)
+	}
+
+	d.From = time.Minute
+	if _, err := d.Run(cdn.URL + "/index.m3u8"); err == nil || !strings.Contains(err.Error(), "No segments") {
+		t.Errorf("Error is %v, want no segments after the end", err)
+	}
+}
@@ -0,0 +1,277 @@
+package hls
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	liveEdgeSegments = 3
+	liveRetries      = 5
+)
+
+// ErrEnded is returned by a Resolver when the stream went offline, which
+// ends fetching without an error.
+var ErrEnded = fmt.Errorf("Stream ended")
+
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("HTTP %s", e.Status)
+}
+
+type SegmentData struct {
+	Segment
+
+	Data          []byte
+	Fetched       time.Time
+	FetchDuration time.Duration
+}
+
+// Resolver returns the current media playlist url, fetching a new access
+// token if needed. It is called on start and whenever the playlist is rejected.
+type Resolver func() (string, error)
+
+type LiveFetcher struct {
+	client  *http.Client
+	resolve Resolver
+
+	// LowLatency also fetches the upcoming segments Twitch announces with
+	// EXT-X-TWITCH-PREFETCH, which download as they are being encoded.
+	LowLatency bool
+
+	// OnAd is called from the fetching goroutine at the start and end of ad
+	// breaks, OnSegment for every fetched segment.
+	OnAd      func(AdEvent)
+	OnSegment func(*SegmentData)
+	ads       AdTracker
+	adaptive  *Adaptive
+
+	mu       sync.Mutex
+	err      error
+	playlist *MediaPlaylist
+
+	segments  chan *SegmentData
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewLiveFetcher(client *http.Client, resolve Resolver) *LiveFetcher {
+	return &LiveFetcher{
+		client:   client,
+		resolve:  resolve,
+		segments: make(chan *SegmentData, 16),
+		done:     make(chan struct{}),
+	}
+}
+
+func (f *LiveFetcher) Start() error {
+	uri, err := f.resolve()
+	if err != nil {
+		return err
+	}
+
+	go f.run(uri)
+
+	return nil
+}
+
+func (f *LiveFetcher) Segments() <-chan *SegmentData {
+	return f.segments
+}
+
+func (f *LiveFetcher) Err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.err
+}
+
+// Playlist returns the last fetched media playlist.
+func (f *LiveFetcher) Playlist() *MediaPlaylist {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.playlist
+}
+
+// NewAdaptiveFetcher follows the variant a picks, continuing at the next media
+// sequence number of the new variant after every switch.
+func NewAdaptiveFetcher(client *http.Client, a *Adaptive) *LiveFetcher {
+	f := NewLiveFetcher(client, a.Resolver())
+	f.adaptive = a
+
+	return f
+}
+
+func (f *LiveFetcher) Close() error {
+	f.closeOnce.Do(func() {
+		close(f.done)
+	})
+
+	return nil
+}
+
+func (f *LiveFetcher) fail(err error) {
+	if err == ErrEnded {
+		return
+	}
+
+	f.mu.Lock()
+	f.err = err
+	f.mu.Unlock()
+}
+
+func (f *LiveFetcher) sleep(d time.Duration) bool {
+	select {
+	case <-f.done:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+func (f *LiveFetcher) run(uri string) {
+	defer close(f.segments)
+
+	var lastSeq uint64
+	var started, switched bool
+	var failures int
+	for {
+		pl, err := FetchMediaPlaylist(f.client, uri)
+		if err != nil {
+			if failures++; failures > liveRetries {
+				f.fail(fmt.Errorf("Fetching live playlist: %s", err.Error()))
+				return
+			}
+			if _, ok := err.(StatusError); ok {
+				if uri, err = f.resolve(); err != nil {
+					f.fail(err)
+					return
+				}
+			}
+			if !f.sleep(time.Duration(failures) * time.Second) {
+				return
+			}
+			continue
+		}
+		failures = 0
+
+		f.mu.Lock()
+		f.playlist = pl
+		f.mu.Unlock()
+
+		segments := pl.Segments
+		if started && !switched && len(segments) > 0 && segments[len(segments)-1].SeqId < lastSeq {
+			started = false
+		}
+		if f.LowLatency {
+			segments = append(segments[:len(segments):len(segments)], pl.Prefetch...)
+		}
+		if !started && len(segments) > liveEdgeSegments {
+			segments = segments[len(segments)-liveEdgeSegments:]
+		}
+		refresh := false
+		for _, s := range segments {
+			if started && s.SeqId <= lastSeq {
+				continue
+			}
+			data, err := f.fetch(s)
+			if err != nil {
+				f.fail(err)
+				return
+			}
+			if switched {
+				data.Discontinuity, switched = true, false
+			}
+			if ev := f.ads.Observe(s); ev != nil && f.OnAd != nil {
+				f.OnAd(*ev)
+			}
+			if f.OnSegment != nil {
+				f.OnSegment(data)
+			}
+			select {
+			case f.segments <- data:
+			case <-f.done:
+				return
+			}
+			lastSeq, started = s.SeqId, true
+
+			if f.adaptive != nil && f.adaptive.Observe(data) {
+				if uri, err = f.resolve(); err != nil {
+					f.fail(err)
+					return
+				}
+				switched, refresh = true, true
+				break
+			}
+		}
+
+		if refresh {
+			continue
+		}
+		if pl.Closed {
+			return
+		}
+
+		wait := time.Duration(pl.TargetDuration*float64(time.Second)) / 2
+		if f.LowLatency && len(pl.Prefetch) > 0 {
+			wait = 250 * time.Millisecond
+		} else if wait < time.Second {
+			wait = time.Second
+		}
+		if !f.sleep(wait) {
+			return
+		}
+	}
+}
+
+func (f *LiveFetcher) fetch(s Segment) (*SegmentData, error) {
+	var err error
+	for i := 0; i < segmentRetries; i++ {
+		var data []byte
+		start := time.Now()
+		if data, err = FetchSegmentData(f.client, s.URI); err == nil {
+			return &SegmentData{
+				Segment:       s,
+				Data:          data,
+				Fetched:       time.Now(),
+				FetchDuration: time.Since(start),
+			}, nil
+		}
+		if !f.sleep(time.Duration(i+1) * 500 * time.Millisecond) {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("Fetching segment %d: %s", s.SeqId, err.Error())
+}
+
+// FetchSegmentData downloads uri into memory, verifying the length against Content-Length.
+func FetchSegmentData(client *http.Client, uri string) ([]byte, error) {
+	res, err := client.Get(uri)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, StatusError{res.StatusCode, res.Status}
+	}
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.ContentLength >= 0 && int64(len(data)) != res.ContentLength {
+		return nil, fmt.Errorf("Short read: got %d of %d bytes", len(data), res.ContentLength)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,130 @@
+package hls
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// drain collects the fetched segments until the fetcher closes them.
+func drain(t *testing.T, f *LiveFetcher) []*SegmentData {
+	var segments []*SegmentData
+	timeout := time.After(testTimeout)
+	for {
+		select {
+		case s, ok := <-f.Segments():
+			if !ok {
+				return segments
+			}
+			segments = append(segments, s)
+		case <-timeout:
+			f.Close()
+			t.Fatal("Timed out waiting for the fetcher to end")
+		}
+	}
+}
+
+func TestLiveFetcher(t *testing.T) {
+	files := map[string]string{"/index.m3u8": playlist(true, segmentLines(5)...)}
+	for i := 0; i < 5; i++ {
+		files[fmt.Sprintf("/seg%d.ts", i)] = fmt.Sprint(i)
+	}
+	cdn := newFakeCdn(t, files)
+
+	f := NewLiveFetcher(http.DefaultClient, func() (string, error) {
+		return cdn.URL + "/index.m3u8", nil
+	})
+	var seen int
+	f.OnSegment = func(*SegmentData) {
+		seen++
+	}
+	if err := f.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	segments := drain(t, f)
+	if err := f.Err(); err != nil {
+		t.Errorf("Fetcher ended with %s, want no error for an ended playlist", err)
+	}
+	if len(segments) != liveEdgeSegments {
+		t.Fatalf("Got %d segments, want the %d at the live edge", len(segments), liveEdgeSegments)
+	}
+	for i, s := range segments {
+		if want := fmt.Sprint(i + 2); string(s.Data) != want || s.SeqId != uint64(i+2) {
+			t.Errorf("Segment %d is %d with %q, want %s", i, s.SeqId, s.Data, want)
+		}
+	}
+	if seen != len(segments) {
+		t.Errorf("OnSegment saw %d segments, want %d", seen, len(segments))
+	}
+	if f.Playlist() == nil || !f.Playlist().Closed {
+		t.Error("Last playlist is not kept")
+	}
+}
+
+func TestLiveFetcherOffline(t *testing.T) {
+	cdn := newFakeCdn(t, nil)
+
+	tests := []struct {
+		name    string
+		err     error
+		wantErr bool
+	}{
+		{"ended", ErrEnded, false},
+		{"failed", fmt.Errorf("Getting access token: HTTP 500"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			f := NewLiveFetcher(http.DefaultClient, func() (string, error) {
+				// the first call starts the fetcher, the next follows the 404
+				if calls++; calls > 1 {
+					return "", tt.err
+				}
+				return cdn.URL + "/index.m3u8", nil
+			})
+			if err := f.Start(); err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			if segments := drain(t, f); len(segments) != 0 {
+				t.Errorf("Got %d segments from a missing playlist", len(segments))
+			}
+			if err := f.Err(); tt.wantErr && err != tt.err {
+				t.Errorf("Error is %v, want %v", err, tt.err)
+			} else if !tt.wantErr && err != nil {
+				t.Errorf("Error is %v after the stream went offline, want none", err)
+			}
+		})
+	}
+}
+
+func TestLiveFetcherClose(t *testing.T) {
+	cdn := newFakeCdn(t, map[string]string{
+		"/index.m3u8": playlist(false, segmentLines(1)...),
+		"/seg0.ts":    "0",
+	})
+
+	f := NewLiveFetcher(http.DefaultClient, func() (string, error) {
+		return cdn.URL + "/index.m3u8", nil
+	})
+	if err := f.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-f.Segments():
+	case <-time.After(testTimeout):
+		t.Fatal("Timed out waiting for a segment")
+	}
+	f.Close()
+
+	drain(t, f)
+	if err := f.Err(); err != nil {
+		t.Errorf("Fetcher ended with %s after Close, want no error", err)
+	}
+}
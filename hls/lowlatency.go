@@ -0,0 +1,94 @@
+package hls
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/grafov/m3u8"
+)
+
+const prefetchTagName = "#EXT-X-TWITCH-PREFETCH:"
+
+// prefetchTag collects EXT-X-TWITCH-PREFETCH uris. Twitch lists several per
+// playlist, while grafov/m3u8 keeps only one custom tag per name. The decoder
+// runs for both master and media parsing, hence the duplicate check.
+type prefetchTag struct {
+	line string
+	uris *[]string
+}
+
+func (t *prefetchTag) TagName() string {
+	return prefetchTagName
+}
+
+func (t *prefetchTag) SegmentTag() bool {
+	return false
+}
+
+func (t *prefetchTag) Decode(line string) (m3u8.CustomTag, error) {
+	uri := strings.TrimSpace(strings.TrimPrefix(line, prefetchTagName))
+	for _, u := range *t.uris {
+		if u == uri {
+			return &prefetchTag{line: line}, nil
+		}
+	}
+	*t.uris = append(*t.uris, uri)
+
+	return &prefetchTag{line: line}, nil
+}
+
+func (t *prefetchTag) Encode() *bytes.Buffer {
+	return bytes.NewBufferString(t.line)
+}
+
+func (t *prefetchTag) String() string {
+	return t.line
+}
+
+// addPrefetch appends upcoming segments, assuming they last as long as the last
+// listed one.
+func (p *MediaPlaylist) addPrefetch(uris []string) error {
+	if len(p.Segments) == 0 {
+		return nil
+	}
+
+	base, err := url.Parse(p.URI)
+	if err != nil {
+		return err
+	}
+
+	last := p.Segments[len(p.Segments)-1]
+	for i, uri := range uris {
+		ref, err := url.Parse(uri)
+		if err != nil {
+			return err
+		}
+		n := time.Duration(i + 1)
+		s := Segment{
+			Index:    -1,
+			SeqId:    last.SeqId + uint64(i) + 1,
+			URI:      base.ResolveReference(ref).String(),
+			Title:    twitchLiveTitle,
+			Duration: last.Duration,
+			Start:    last.Start + n*last.Duration,
+			Prefetch: true,
+		}
+		if !last.ProgramDateTime.IsZero() {
+			s.ProgramDateTime = last.ProgramDateTime.Add(n * last.Duration)
+		}
+		p.Prefetch = append(p.Prefetch, s)
+	}
+
+	return nil
+}
+
+// Latency is the age of the first frame of the segment when it finished downloading.
+func (s *SegmentData) Latency() time.Duration {
+	if s.ProgramDateTime.IsZero() {
+		return 0
+	}
+
+	return s.Fetched.Sub(s.ProgramDateTime)
+}
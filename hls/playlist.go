@@ -0,0 +1,130 @@
+package hls
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/grafov/m3u8"
+)
+
+type Segment struct {
+	Index           int
+	SeqId           uint64
+	URI             string
+	Title           string
+	Duration        time.Duration
+	Start           time.Duration
+	Discontinuity   bool
+	ProgramDateTime time.Time
+	DateRange       *DateRange
+	Ad              bool
+	Prefetch        bool
+}
+
+type MediaPlaylist struct {
+	*m3u8.MediaPlaylist
+
+	URI      string
+	Segments []Segment
+	Prefetch []Segment
+}
+
+func FetchMediaPlaylist(client *http.Client, uri string) (*MediaPlaylist, error) {
+	res, err := client.Get(uri)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, StatusError{res.StatusCode, res.Status}
+	}
+
+	var prefetch []string
+	p, listType, err := m3u8.DecodeWith(res.Body, false, []m3u8.CustomDecoder{
+		&dateRangeTag{},
+		&prefetchTag{uris: &prefetch},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if listType != m3u8.MEDIA {
+		return nil, fmt.Errorf("Getting media playlist: Not a media playlist")
+	}
+
+	mp, err := newMediaPlaylist(uri, p.(*m3u8.MediaPlaylist))
+	if err != nil {
+		return nil, err
+	}
+
+	return mp, mp.addPrefetch(prefetch)
+}
+
+func newMediaPlaylist(uri string, pl *m3u8.MediaPlaylist) (*MediaPlaylist, error) {
+	base, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	mp := &MediaPlaylist{
+		MediaPlaylist: pl,
+		URI:           uri,
+	}
+
+	var start time.Duration
+	for i, s := range pl.Segments {
+		if s == nil {
+			break
+		}
+		ref, err := url.Parse(s.URI)
+		if err != nil {
+			return nil, err
+		}
+		duration := time.Duration(s.Duration * float64(time.Second))
+		segment := Segment{
+			Index:           i,
+			SeqId:           s.SeqId,
+			URI:             base.ResolveReference(ref).String(),
+			Title:           s.Title,
+			Duration:        duration,
+			Start:           start,
+			Discontinuity:   s.Discontinuity,
+			ProgramDateTime: s.ProgramDateTime,
+		}
+		if tag, ok := s.Custom[dateRangeTagName].(*dateRangeTag); ok {
+			segment.DateRange = &tag.DateRange
+		}
+		// Only some segments carry a date, the rest follow from their durations.
+		if n := len(mp.Segments); segment.ProgramDateTime.IsZero() && n > 0 && !mp.Segments[n-1].ProgramDateTime.IsZero() {
+			segment.ProgramDateTime = mp.Segments[n-1].ProgramDateTime.Add(mp.Segments[n-1].Duration)
+		}
+		mp.Segments = append(mp.Segments, segment)
+		start += duration
+	}
+	markAds(mp.Segments)
+
+	return mp, nil
+}
+
+func (p *MediaPlaylist) Duration() (d time.Duration) {
+	for _, s := range p.Segments {
+		d += s.Duration
+	}
+
+	return d
+}
+
+// Slice returns the segments overlapping [from, to); a zero to means until the end.
+func (p *MediaPlaylist) Slice(from, to time.Duration) []Segment {
+	var segments []Segment
+	for _, s := range p.Segments {
+		if s.Start+s.Duration <= from || (to > 0 && s.Start >= to) {
+			continue
+		}
+		segments = append(segments, s)
+	}
+
+	return segments
+}
@@ -0,0 +1,178 @@
+package hls
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testTimeout = 5 * time.Second
+
+// fakeCdn serves fixed playlists and segments, counting the requests for each.
+type fakeCdn struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	files    map[string]string
+	requests map[string]int
+}
+
+func newFakeCdn(t *testing.T, files map[string]string) *fakeCdn {
+	c := &fakeCdn{files: files, requests: make(map[string]int)}
+	c.Server = httptest.NewServer(c)
+	t.Cleanup(c.Close)
+
+	return c
+}
+
+func (c *fakeCdn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	c.requests[r.URL.Path]++
+	data, ok := c.files[r.URL.Path]
+	c.mu.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Write([]byte(data))
+}
+
+func (c *fakeCdn) requested(path string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.requests[path]
+}
+
+// playlist lists 2 second segments starting at media sequence 0.
+func playlist(ended bool, lines ...string) string {
+	text := "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:2\n#EXT-X-MEDIA-SEQUENCE:0\n" + strings.Join(lines, "\n") + "\n"
+	if ended {
+		text += "#EXT-X-ENDLIST\n"
+	}
+
+	return text
+}
+
+func segmentLines(n int) []string {
+	var lines []string
+	for i := 0; i < n; i++ {
+		lines = append(lines, "#EXTINF:2.000,live", fmt.Sprintf("seg%d.ts", i))
+	}
+
+	return lines
+}
+
+func TestFetchMediaPlaylist(t *testing.T) {
+	cdn := newFakeCdn(t, map[string]string{
+		"/v/index.m3u8": playlist(true,
+			"#EXT-X-PROGRAM-DATE-TIME:2024-03-09T18:00:00.000Z",
+			"#EXTINF:2.000,live",
+			"seg0.ts",
+			"#EXTINF:1.500,live",
+			"/other/seg1.ts",
+			"#EXT-X-DATERANGE:ID=\"stitched-ad-1\",CLASS=\"twitch-stitched-ad\",START-DATE=\"2024-03-09T18:00:03.500Z\",DURATION=4.000",
+			"#EXTINF:2.000,Amazon|123",
+			"seg2.ts",
+			"#EXTINF:2.000,Amazon|123",
+			"seg3.ts",
+			"#EXTINF:2.000,live",
+			"seg4.ts",
+		),
+	})
+
+	pl, err := FetchMediaPlaylist(http.DefaultClient, cdn.URL+"/v/index.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pl.Segments) != 5 {
+		t.Fatalf("Got %d segments, want 5", len(pl.Segments))
+	}
+	if d := pl.Duration(); d != 9500*time.Millisecond {
+		t.Errorf("Duration is %s, want 9.5s", d)
+	}
+
+	start := time.Date(2024, 3, 9, 18, 0, 0, 0, time.UTC)
+	tests := []struct {
+		uri   string
+		start time.Duration
+		date  time.Time
+		ad    bool
+	}{
+		{cdn.URL + "/v/seg0.ts", 0, start, false},
+		{cdn.URL + "/other/seg1.ts", 2 * time.Second, start.Add(2 * time.Second), false},
+		{cdn.URL + "/v/seg2.ts", 3500 * time.Millisecond, start.Add(3500 * time.Millisecond), true},
+		{cdn.URL + "/v/seg3.ts", 5500 * time.Millisecond, start.Add(5500 * time.Millisecond), true},
+		{cdn.URL + "/v/seg4.ts", 7500 * time.Millisecond, start.Add(7500 * time.Millisecond), false},
+	}
+	for i, tt := range tests {
+		s := pl.Segments[i]
+		if s.URI != tt.uri {
+			t.Errorf("Segment %d is at %q, want %q", i, s.URI, tt.uri)
+		}
+		if s.Start != tt.start {
+			t.Errorf("Segment %d starts at %s, want %s", i, s.Start, tt.start)
+		}
+		if !s.ProgramDateTime.Equal(tt.date) {
+			t.Errorf("Segment %d is dated %s, want %s", i, s.ProgramDateTime, tt.date)
+		}
+		if s.Ad != tt.ad {
+			t.Errorf("Segment %d ad is %v, want %v", i, s.Ad, tt.ad)
+		}
+	}
+
+	dr := pl.Segments[2].DateRange
+	if dr == nil {
+		t.Fatal("Date range was dropped")
+	}
+	if dr.Id != "stitched-ad-1" || !dr.IsAd() || dr.Duration != 4*time.Second || !dr.Start.Equal(start.Add(3500*time.Millisecond)) {
+		t.Errorf("Date range is %+v", *dr)
+	}
+}
+
+func TestFetchMediaPlaylistErrors(t *testing.T) {
+	cdn := newFakeCdn(t, map[string]string{
+		"/master.m3u8": "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1000\nindex.m3u8\n",
+	})
+
+	_, err := FetchMediaPlaylist(http.DefaultClient, cdn.URL+"/missing.m3u8")
+	if serr, ok := err.(StatusError); !ok || serr.StatusCode != http.StatusNotFound {
+		t.Errorf("Error for a missing playlist is %v, want a 404 StatusError", err)
+	}
+	if _, err := FetchMediaPlaylist(http.DefaultClient, cdn.URL+"/master.m3u8"); err == nil {
+		t.Error("Fetched a master playlist as a media playlist")
+	}
+}
+
+func TestSlice(t *testing.T) {
+	pl := &MediaPlaylist{}
+	for i := 0; i < 5; i++ {
+		pl.Segments = append(pl.Segments, Segment{Index: i, Start: time.Duration(i) * 10 * time.Second, Duration: 10 * time.Second})
+	}
+
+	tests := []struct {
+		from, to time.Duration
+		want     []int
+	}{
+		{0, 0, []int{0, 1, 2, 3, 4}},
+		{15 * time.Second, 0, []int{1, 2, 3, 4}},
+		{10 * time.Second, 30 * time.Second, []int{1, 2}},
+		{15 * time.Second, 31 * time.Second, []int{1, 2, 3}},
+		{50 * time.Second, 0, nil},
+	}
+
+	for _, tt := range tests {
+		var got []int
+		for _, s := range pl.Slice(tt.from, tt.to) {
+			got = append(got, s.Index)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("Slice(%s, %s) is %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
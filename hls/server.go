@@ -0,0 +1,157 @@
+package hls
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/grafov/m3u8"
+)
+
+const (
+	MasterPlaylistPath = "/master.m3u8"
+	MediaPlaylistPath  = "/media.m3u8"
+	SegmentPath        = "/segment/"
+)
+
+type Variant struct {
+	Bandwidth  uint32
+	Resolution string
+	Name       string
+}
+
+// Server re-serves segments from a LiveFetcher as a sliding window live playlist.
+type Server struct {
+	// OnRequest is called for every segment request, before the segment is written.
+	OnRequest func(Segment)
+
+	variant Variant
+	window  int
+
+	mu       sync.RWMutex
+	segments []*SegmentData
+	ended    bool
+}
+
+func NewServer(variant Variant, window int) *Server {
+	return &Server{
+		variant: variant,
+		window:  window,
+	}
+}
+
+// Feed caches segments until the channel closes, which ends the playlist.
+func (s *Server) Feed(segments <-chan *SegmentData) {
+	for seg := range segments {
+		s.mu.Lock()
+		s.segments = append(s.segments, seg)
+		if len(s.segments) > s.window {
+			s.segments = s.segments[len(s.segments)-s.window:]
+		}
+		s.mu.Unlock()
+	}
+
+	s.mu.Lock()
+	s.ended = true
+	s.mu.Unlock()
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/" || r.URL.Path == MasterPlaylistPath:
+		s.serveMaster(w, r)
+	case r.URL.Path == MediaPlaylistPath:
+		s.serveMedia(w, r)
+	case strings.HasPrefix(r.URL.Path, SegmentPath):
+		s.serveSegment(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) serveMaster(w http.ResponseWriter, r *http.Request) {
+	pl := m3u8.NewMasterPlaylist()
+	pl.Append(strings.TrimPrefix(MediaPlaylistPath, "/"), nil, m3u8.VariantParams{
+		Bandwidth:  s.variant.Bandwidth,
+		Resolution: s.variant.Resolution,
+		Name:       s.variant.Name,
+	})
+
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(pl.Encode().Bytes())
+}
+
+func (s *Server) serveMedia(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.segments) == 0 {
+		http.Error(w, "No segments fetched yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	pl, err := m3u8.NewMediaPlaylist(uint(len(s.segments)), uint(len(s.segments)))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	pl.SeqNo = s.segments[0].SeqId
+
+	var target float64
+	for _, seg := range s.segments {
+		if err := pl.Append(fmt.Sprintf("%s%d.ts", strings.TrimPrefix(SegmentPath, "/"), seg.SeqId), seg.Duration.Seconds(), seg.Title); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if seg.Discontinuity {
+			pl.SetDiscontinuity()
+		}
+		if !seg.ProgramDateTime.IsZero() {
+			pl.SetProgramDateTime(seg.ProgramDateTime)
+		}
+		target = math.Max(target, math.Ceil(seg.Duration.Seconds()))
+	}
+	pl.TargetDuration = target
+	if s.ended {
+		pl.Close()
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(pl.Encode().Bytes())
+}
+
+func (s *Server) serveSegment(w http.ResponseWriter, r *http.Request) {
+	seq, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, SegmentPath), ".ts"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.RLock()
+	var found *SegmentData
+	for _, seg := range s.segments {
+		if seg.SeqId == seq {
+			found = seg
+			break
+		}
+	}
+	s.mu.RUnlock()
+
+	if found == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if s.OnRequest != nil {
+		s.OnRequest(found.Segment)
+	}
+	data := found.Data
+
+	w.Header().Set("Content-Type", "video/mp2t")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/hchagen/twitch-player/player"
+)
+
+var (
+	DefaultStatusInterval = time.Second
+	DefaultVolumeStep     = 5
+)
+
+const keyboardHelp = "space pause, +/- volume, m mute, f fullscreen, 1-9 quality, r reload, n/b next/previous when surfing, q quit"
+
+// keyboardControl reads single keys from the terminal in raw mode and keeps a
+// status line at the bottom. Raw mode also disables output post-processing,
+// so the session writes through it to translate newlines and clear the status
+// line before other output.
+type keyboardControl struct {
+	session *streamSession
+	fd      int
+	state   *term.State
+	stdout  io.Writer
+
+	mu         sync.Mutex
+	statusLine bool
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// startKeyboardControl returns nil without error if stdin is not a terminal.
+func startKeyboardControl(session *streamSession) (*keyboardControl, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, nil
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	k := &keyboardControl{
+		session: session,
+		fd:      fd,
+		state:   state,
+		stdout:  os.Stdout,
+		done:    make(chan struct{}),
+	}
+	session.SetOutput(k)
+	fmt.Fprintln(k, keyboardHelp)
+
+	go k.read()
+	go k.refresh()
+
+	return k, nil
+}
+
+func (k *keyboardControl) Close() error {
+	var err error
+	k.closeOnce.Do(func() {
+		close(k.done)
+		k.session.SetOutput(os.Stdout)
+
+		k.mu.Lock()
+		fmt.Fprint(k.stdout, "\r\033[K")
+		k.statusLine = false
+		k.mu.Unlock()
+		err = term.Restore(k.fd, k.state)
+	})
+
+	return err
+}
+
+func (k *keyboardControl) read() {
+	buf := make([]byte, 1)
+	for {
+		if _, err := os.Stdin.Read(buf); err != nil {
+			return
+		}
+		select {
+		case <-k.done:
+			return
+		default:
+		}
+
+		if err := k.handle(buf[0]); err != nil {
+			fmt.Fprintln(k, err.Error())
+		}
+		k.draw()
+	}
+}
+
+func (k *keyboardControl) handle(key byte) error {
+	switch key {
+	case ' ':
+		if state, err := mediaPlayer().State(); err == nil && state == player.StatePaused {
+			return mediaPlayer().Resume()
+		}
+		return mediaPlayer().Pause()
+	case '+', '=':
+		_, err := adjustVolume(fmt.Sprintf("+%d", DefaultVolumeStep))
+		return err
+	case '-':
+		_, err := adjustVolume(fmt.Sprintf("-%d", DefaultVolumeStep))
+		return err
+	case 'm':
+		muted, err := mediaPlayer().IsMuted()
+		if err != nil {
+			return err
+		}
+		return mediaPlayer().SetMute(!muted)
+	case 'f':
+		return k.session.ToggleFullscreen()
+	case 'r':
+		fmt.Fprintln(k, "Reloading...")
+		return k.session.Reload()
+	case 'n':
+		return k.session.Next()
+	case 'b':
+		return k.session.Previous()
+	case 'q', 3, 4:
+		k.session.Stop()
+		return nil
+	}
+
+	if key >= '1' && key <= '9' {
+		qualities := k.session.Status().Qualities
+		i := int(key - '1')
+		if i >= len(qualities) {
+			return fmt.Errorf("Only %d qualities available", len(qualities))
+		}
+		fmt.Fprintf(k, "Switching to %s...\n", qualities[i])
+		return k.session.SwitchQuality(qualities[i])
+	}
+
+	return nil
+}
+
+func (k *keyboardControl) refresh() {
+	ticker := time.NewTicker(DefaultStatusInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-k.done:
+			return
+		case <-ticker.C:
+		}
+
+		k.draw()
+	}
+}
+
+// Write prints above the status line, which the next draw brings back.
+func (k *keyboardControl) Write(p []byte) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.statusLine {
+		fmt.Fprint(k.stdout, "\r\033[K")
+		k.statusLine = false
+	}
+	if _, err := io.WriteString(k.stdout, strings.Replace(string(p), "\n", "\r\n", -1)); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (k *keyboardControl) draw() {
+	status := k.session.Status()
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	line := fmt.Sprintf("[%s] %s %s | vol %d", status.State, status.Channel, status.Quality, status.Volume)
+	if status.Muted {
+		line += " (muted)"
+	}
+	line += fmt.Sprintf(" | %d viewers", status.Viewers)
+	if !status.Started.IsZero() {
+		line += fmt.Sprintf(" | up %s", formatUptime(time.Since(status.Started)))
+	}
+	fmt.Fprintf(k.stdout, "\r\033[K%s", line)
+	k.statusLine = true
+}
+
+func formatUptime(d time.Duration) string {
+	d = d.Truncate(time.Minute)
+	if d < time.Hour {
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
+
+	return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+}
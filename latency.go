@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/urfave/cli"
+
+	"github.com/hchagen/twitch-player/hls"
+)
+
+var (
+	DefaultLatencyInterval  = 10 * time.Second
+	DefaultLowLatencyWindow = 4
+)
+
+var lowLatencyFlag = cli.BoolFlag{
+	Name:  "low-latency",
+	Usage: "Fetch prefetch segments as they are encoded and report the latency to the broadcaster",
+}
+
+// latencyReporter prints the latency of fetched segments to out, averaged over
+// DefaultLatencyInterval.
+func latencyReporter(out io.Writer) func(*hls.SegmentData) {
+	var (
+		last     time.Time
+		sum      time.Duration
+		n        int
+		prefetch int
+	)
+
+	return func(s *hls.SegmentData) {
+		l := s.Latency()
+		if l <= 0 {
+			return
+		}
+		sum += l
+		n++
+		if s.Prefetch {
+			prefetch++
+		}
+
+		if time.Since(last) < DefaultLatencyInterval {
+			return
+		}
+		fmt.Fprintf(out, "Latency: %.1fs (%d/%d segments prefetched)\n", (sum / time.Duration(n)).Seconds(), prefetch, n)
+		last = time.Now()
+		sum, n, prefetch = 0, 0, 0
+	}
+}
@@ -3,28 +3,42 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/urfave/cli"
 
+	"github.com/hchagen/twitch-player/history"
 	"github.com/hchagen/twitch-player/player"
+	"github.com/hchagen/twitch-player/recorder"
 	"github.com/hchagen/twitch-player/twitch"
 )
 
 var (
-	DefaultTwitchHttpTimeout = 20 * time.Second
-	DefaultChannelResultLen  = 5
-	DefaultGameResultLen     = 25
-	DefaultStreamResultLen   = 30
+	DefaultTwitchHttpTimeout  = 20 * time.Second
+	DefaultSegmentHttpTimeout = 60 * time.Second
+	DefaultDownloadWorkers    = 4
+	DefaultChannelResultLen   = 5
+	DefaultGameResultLen      = 25
+	DefaultStreamResultLen    = 30
+	DefaultVideoResultLen     = 10
+	DefaultHistoryResultLen   = 20
+
+	segmentHttpClient = &http.Client{
+		Timeout: DefaultSegmentHttpTimeout,
+	}
 
 	mediaPlayerCloser func() error = func() error {
 		return nil
 	}
 
 	aout, vout  string
+	overlay     *player.Overlay
 	mediaPlayer func() player.Player = func() func() player.Player {
 		var p player.Player
 		var err error
@@ -33,7 +47,7 @@ var (
 				return p
 			}
 
-			p, err = player.NewVlcPlayer(aout, vout)
+			p, err = player.NewVlcPlayer(aout, vout, overlay)
 			if err != nil {
 				fmt.Printf("Error initializing media player: %s\n", err.Error())
 				os.Exit(1)
@@ -44,6 +58,42 @@ var (
 		}
 	}()
 
+	watchHistory func() *history.Store = func() func() *history.Store {
+		var s *history.Store
+		var err error
+		return func() *history.Store {
+			if s != nil {
+				return s
+			}
+
+			s, err = history.Open(configPath("history.json"))
+			if err != nil {
+				fmt.Printf("Error opening watch history: %s\n", err.Error())
+				os.Exit(1)
+			}
+
+			return s
+		}
+	}()
+
+	qualityPrefs func() *history.Qualities = func() func() *history.Qualities {
+		var q *history.Qualities
+		var err error
+		return func() *history.Qualities {
+			if q != nil {
+				return q
+			}
+
+			q, err = history.OpenQualities(configPath("qualities.json"))
+			if err != nil {
+				fmt.Printf("Error opening quality preferences: %s\n", err.Error())
+				os.Exit(1)
+			}
+
+			return q
+		}
+	}()
+
 	twitchClient func() twitch.Client = func() func() twitch.Client {
 		var c twitch.Client
 		var err error
@@ -79,14 +129,314 @@ func main() {
 	app.Commands = []cli.Command{
 		{
 			Name: "stream",
+			Before: func(ctx *cli.Context) error {
+				aout = ctx.String("aout")
+				vout = ctx.String("vout")
+				overlay = overlayFromFlags(ctx)
+				return nil
+			},
+			Usage:     "Play stream from channel",
+			ArgsUsage: "<channel>",
+			Action:    onStream,
+			Flags: joinFlags([]cli.Flag{
+				cli.StringFlag{
+					Name:  "quality,q",
+					Usage: "Quality to play, e.g. chunked or 720p60 (default last picked for the channel, or prompts)",
+				},
+				cli.BoolFlag{
+					Name:  "fullscreen,f",
+					Usage: "Run in fullscreen",
+				},
+				cli.StringFlag{
+					Name:  "aout,a",
+					Usage: "Audio output device",
+				},
+				cli.StringFlag{
+					Name:  "vout,v",
+					Usage: "Video output device",
+				},
+				lowLatencyFlag,
+			}, chatOverlayFlags, controlFlags, surfFlags, metadataFlags),
+		},
+		{
+			Name:      "multi",
+			Usage:     "Play streams from several channels at once",
+			ArgsUsage: "<channel[:quality]> <channel[:quality]>...",
+			Before: func(ctx *cli.Context) error {
+				aout = ctx.String("aout")
+				vout = ctx.String("vout")
+				return nil
+			},
+			Action: onMulti,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "max-quality,q",
+					Usage: "Highest quality per stream unless given as channel:quality, e.g. 480p30",
+				},
+				cli.IntFlag{
+					Name:  "focus",
+					Usage: "Stream to start with audio from",
+					Value: 1,
+				},
+				cli.StringFlag{
+					Name:  "aout,a",
+					Usage: "Audio output device",
+				},
+				cli.StringFlag{
+					Name:  "vout,v",
+					Usage: "Video output device",
+				},
+			},
+		},
+		{
+			Name:  "party",
+			Usage: "Watch a stream in sync with others",
+			Subcommands: []cli.Command{
+				{
+					Name:      "lead",
+					Before:    onPartyBefore,
+					Usage:     "Play stream from channel and keep followers in sync",
+					ArgsUsage: "<channel>",
+					Action:    onPartyLead,
+					Flags: append([]cli.Flag{
+						cli.StringFlag{
+							Name:  "addr",
+							Usage: "Address to accept followers on",
+							Value: DefaultPartyAddr,
+						},
+						cli.StringFlag{
+							Name:  "quality,q",
+							Usage: "Quality to play, e.g. chunked or 720p60 (prompts if empty)",
+						},
+					}, partyPlayerFlags...),
+				},
+				{
+					Name:      "join",
+					Before:    onPartyBefore,
+					Usage:     "Follow the stream played by a leader",
+					ArgsUsage: "<host:port>",
+					Action:    onPartyJoin,
+					Flags: append([]cli.Flag{
+						cli.DurationFlag{
+							Name:  "tolerance",
+							Usage: "Drift from the leader to allow before correcting",
+							Value: DefaultPartyTolerance,
+						},
+					}, partyPlayerFlags...),
+				},
+			},
+		},
+		{
+			Name:      "record",
+			Usage:     "Record stream from channel to a file",
+			ArgsUsage: "<channel>",
+			Action:    onRecord,
+			Flags: joinFlags([]cli.Flag{
+				cli.StringFlag{
+					Name:  "output,o",
+					Usage: "Output file, may use {channel}, {game}, {title}, {id}, {date}, {time} and {part} (default " + recorder.DefaultOutput + ")",
+				},
+				cli.DurationFlag{
+					Name:  "split-duration",
+					Usage: "Start a new part after this duration",
+				},
+				cli.StringFlag{
+					Name:  "split-size",
+					Usage: "Start a new part before exceeding this size, e.g. 2GiB",
+				},
+			}, recordFlags, remuxFlags, chatReplayFlags),
+		},
+		{
+			Name:   "recorder",
+			Usage:  "Record channels automatically when they go live matching a rule file",
+			Action: onRecorder,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "rules",
+					Usage: "YAML rule file",
+					Value: configPath("recorder.yaml"),
+				},
+			},
+		},
+		{
+			Name:      "remux",
+			Usage:     "Convert a recorded .ts file to seekable mp4 or mkv",
+			ArgsUsage: "<input.ts> <output.mp4|output.mkv>",
+			Action:    onRemux,
+		},
+		{
+			Name:      "pipe",
+			Usage:     "Write stream from channel to stdout, e.g. for omxplayer or mpv",
+			ArgsUsage: "<channel>",
+			Action:    onPipe,
+			Flags:     recordFlags,
+		},
+		{
+			Name:      "serve",
+			Usage:     "Relay stream from channel over HTTP to devices on the local network",
+			ArgsUsage: "<channel>",
+			Action:    onServe,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "addr",
+					Usage: "Address to serve on",
+					Value: DefaultServeAddr,
+				},
+				cli.StringFlag{
+					Name:  "quality,q",
+					Usage: "Quality to relay, e.g. chunked or 720p60 (prompts if empty)",
+				},
+				cli.IntFlag{
+					Name:  "window",
+					Usage: "Number of segments to keep in the served playlist",
+					Value: DefaultServeWindow,
+				},
+				lowLatencyFlag,
+				adaptiveFlag,
+				minQualityFlag,
+				maxQualityFlag,
+			},
+		},
+		{
+			Name:      "ctl",
+			Usage:     "Control a running stream session: " + controlSocketUsage,
+			ArgsUsage: "<command> [arguments]",
+			Action:    onCtl,
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:  "session",
+					Usage: "Process id of the session (default most recent)",
+				},
+			},
+		},
+		{
+			Name:   "chat",
+			Usage:  "Read and write chat in channel",
+			Action: onChat,
+			Flags:  chatFlags,
+			Subcommands: []cli.Command{
+				{
+					Name:      "say",
+					Usage:     "Send a message to channel",
+					ArgsUsage: "<channel> <message>",
+					Action:    onChatCommand(""),
+					Flags:     chatFlags,
+				},
+				{
+					Name:      "me",
+					Usage:     "Send an action message to channel",
+					ArgsUsage: "<channel> <message>",
+					Action:    onChatCommand("me"),
+					Flags:     chatFlags,
+				},
+				{
+					Name:      "timeout",
+					Usage:     "Time out a user in channel",
+					ArgsUsage: "<channel> <user> <duration> [reason]",
+					Action:    onChatCommand("timeout"),
+					Flags:     chatFlags,
+				},
+				{
+					Name:      "ban",
+					Usage:     "Ban a user from channel",
+					ArgsUsage: "<channel> <user> [reason]",
+					Action:    onChatCommand("ban"),
+					Flags:     chatFlags,
+				},
+				{
+					Name:      "unban",
+					Usage:     "Unban a user from channel",
+					ArgsUsage: "<channel> <user>",
+					Action:    onChatCommand("unban"),
+					Flags:     chatFlags,
+				},
+				{
+					Name:      "delete",
+					Usage:     "Delete a chat message",
+					ArgsUsage: "<channel> <message id>",
+					Action:    onChatCommand("delete"),
+					Flags:     chatFlags,
+				},
+				{
+					Name:      "slow",
+					Usage:     "Set slow mode for channel",
+					ArgsUsage: "<channel> <seconds|off>",
+					Action:    onChatCommand("slow"),
+					Flags:     chatFlags,
+				},
+				{
+					Name:      "subscribers",
+					Usage:     "Set subscriber-only mode for channel",
+					ArgsUsage: "<channel> <on|off>",
+					Action:    onChatCommand("subscribers"),
+					Flags:     chatFlags,
+				},
+			},
+		},
+		{
+			Name: "vod",
 			Before: func(ctx *cli.Context) error {
 				aout = ctx.String("aout")
 				vout = ctx.String("vout")
 				return nil
 			},
-			Usage:  "Play stream from channel",
-			Action: onStream,
+			Usage:     "Play past broadcasts, highlights and uploads from channel",
+			ArgsUsage: "<channel>",
+			Action:    onVod,
+			Subcommands: []cli.Command{
+				{
+					Name:      "download",
+					Usage:     "Download video to disk",
+					ArgsUsage: "<video id>",
+					Action:    onVodDownload,
+					Flags: joinFlags([]cli.Flag{
+						cli.StringFlag{
+							Name:  "output,o",
+							Usage: "Output file (default <channel>_<date>_<id>.ts)",
+						},
+						cli.StringFlag{
+							Name:  "quality,q",
+							Usage: "Quality to download, e.g. chunked or 720p60 (prompts if empty)",
+						},
+						cli.DurationFlag{
+							Name:  "from",
+							Usage: "Download from offset, e.g. 1h23m",
+						},
+						cli.DurationFlag{
+							Name:  "to",
+							Usage: "Download up to offset, e.g. 2h",
+						},
+						cli.IntFlag{
+							Name:  "workers,w",
+							Usage: "Number of segments to download in parallel",
+							Value: DefaultDownloadWorkers,
+						},
+					}, remuxFlags, chatReplayFlags),
+				},
+			},
 			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "id",
+					Usage: "Play video with this id rather than selecting from channel",
+				},
+				cli.StringFlag{
+					Name:  "type,t",
+					Usage: "Type of videos to list (archive, highlight, upload or all)",
+					Value: twitch.VideoTypeArchive,
+				},
+				cli.IntFlag{
+					Name:  "number,n",
+					Usage: "Number of videos to list",
+					Value: DefaultVideoResultLen,
+				},
+				cli.IntFlag{
+					Name:  "page,p",
+					Usage: "Page of videos to list",
+				},
+				cli.DurationFlag{
+					Name:  "start,s",
+					Usage: "Start playback at offset, e.g. 1h23m",
+				},
 				cli.BoolFlag{
 					Name:  "fullscreen,f",
 					Usage: "Run in fullscreen",
@@ -101,6 +451,68 @@ func main() {
 				},
 			},
 		},
+		{
+			Name:   "clips",
+			Usage:  "List top clips by channel or game",
+			Action: onClips,
+			Flags:  clipListFlags,
+			Subcommands: []cli.Command{
+				{
+					Name: "play",
+					Before: func(ctx *cli.Context) error {
+						aout = ctx.String("aout")
+						vout = ctx.String("vout")
+						return nil
+					},
+					Usage:     "Play a clip (selects from top clips if no slug is given)",
+					ArgsUsage: "[slug or url]",
+					Action:    onClipPlay,
+					Flags: append([]cli.Flag{
+						cli.BoolFlag{
+							Name:  "fullscreen,f",
+							Usage: "Run in fullscreen",
+						},
+						cli.StringFlag{
+							Name:  "aout,a",
+							Usage: "Audio output device",
+						},
+						cli.StringFlag{
+							Name:  "vout,v",
+							Usage: "Video output device",
+						},
+					}, clipListFlags...),
+				},
+				{
+					Name:      "download",
+					Usage:     "Download a clip as mp4 (selects from top clips if no slug is given)",
+					ArgsUsage: "[slug or url]",
+					Action:    onClipDownload,
+					Flags: append([]cli.Flag{
+						cli.StringFlag{
+							Name:  "output,o",
+							Usage: "Output file template ({channel}, {date}, {title}, {game}, {slug}, {quality})",
+							Value: DefaultClipNameTemplate,
+						},
+						cli.StringFlag{
+							Name:  "quality,q",
+							Usage: "Quality to download, e.g. 1080p60 (best if empty)",
+						},
+					}, clipListFlags...),
+				},
+			},
+		},
+		{
+			Name:   "history",
+			Usage:  "List watched videos and progress",
+			Action: onHistory,
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:  "number,n",
+					Usage: "Number of videos to list",
+					Value: DefaultHistoryResultLen,
+				},
+			},
+		},
 		{
 			Name:   "games",
 			Usage:  "Display games",
@@ -166,6 +578,24 @@ func main() {
 	}
 }
 
+func joinFlags(sets ...[]cli.Flag) []cli.Flag {
+	var flags []cli.Flag
+	for _, set := range sets {
+		flags = append(flags, set...)
+	}
+
+	return flags
+}
+
+func configPath(name string) string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+
+	return filepath.Join(dir, "twitch-player", name)
+}
+
 func printChannels(channels []twitch.Channel) {
 	for _, channel := range channels {
 		fmt.Printf("[%s] %s (id %d) last played: %s (%s)\n", channel.Name, channel.DisplayName, channel.Id, channel.Game, channel.Updated)
@@ -208,18 +638,77 @@ func printStreams(streams []twitch.Stream) {
 	}
 }
 
-func getNumericInput(prompt string, max int) int {
+func printVideos(videos []twitch.Video) {
+	for i, video := range videos {
+		fmt.Printf("[%d - %s] %s playing %s (%s, %d views): %s\n",
+			i,
+			video.Id,
+			video.Published.Local().Format("2006-01-02"),
+			video.Game,
+			time.Duration(video.Length)*time.Second,
+			video.Views,
+			video.Title,
+		)
+	}
+}
+
+func printClips(clips []twitch.Clip) {
+	for i, clip := range clips {
+		fmt.Printf("[%d - %s] %s playing %s (%.0fs, %d views): %s\n",
+			i,
+			clip.Slug,
+			clip.Broadcaster.DisplayName,
+			clip.Game,
+			clip.Duration,
+			clip.Views,
+			clip.Title,
+		)
+	}
+}
+
+func printHistory(entries []history.Entry) {
+	for _, e := range entries {
+		fmt.Printf("[%s] %s: %s - %s/%s (%.0f%%) watched %s\n",
+			e.VideoId,
+			e.Channel,
+			e.Title,
+			e.Position.Truncate(time.Second),
+			e.Length.Truncate(time.Second),
+			e.Progress()*100,
+			e.Updated.Local().Format("2006-01-02 15:04"),
+		)
+	}
+}
+
+func getYesNoInput(prompt string, def bool) bool {
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Print(prompt)
+		inp, _ := reader.ReadString('\n')
+		switch strings.ToLower(strings.TrimSpace(inp)) {
+		case "":
+			return def
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		}
+		fmt.Printf("%s is not y or n...\n", strings.TrimSpace(inp))
+	}
+}
+
+func getNumericInput(out io.Writer, prompt string, max int) int {
 	reader := bufio.NewReader(os.Stdin)
 	selection := -1
 	for selection < 0 {
-		fmt.Printf(prompt)
+		fmt.Fprint(out, prompt)
 		if inp, _ := reader.ReadString('\n'); inp != "\n" {
 			if i, err := strconv.Atoi(strings.TrimSpace(inp)); err != nil {
-				fmt.Printf("%s is not a valid number...\n", inp)
+				fmt.Fprintf(out, "%s is not a valid number...\n", inp)
 				continue
 			} else {
 				if i < 0 || i > max {
-					fmt.Printf("%s is not in range [0-%d]...\n", inp, max)
+					fmt.Fprintf(out, "%s is not in range [0-%d]...\n", inp, max)
 					continue
 				}
 				selection = i
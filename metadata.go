@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+var (
+	DefaultRefreshInterval = 30 * time.Second
+	DefaultOsdDuration     = 5 * time.Second
+)
+
+// viewerChangePercent is how far the viewers have to move from the last
+// announced count before they are announced again.
+const viewerChangePercent = 10
+
+var metadataFlags = []cli.Flag{
+	cli.DurationFlag{
+		Name:  "refresh-interval",
+		Usage: "How often to refresh the title, game and viewers (0 to disable)",
+		Value: DefaultRefreshInterval,
+	},
+	cli.BoolFlag{
+		Name:  "no-osd",
+		Usage: "Don't show title, game and viewer changes on the video",
+	},
+}
+
+// watchMetadata refreshes the stream data until the session ends, announcing
+// title and game changes on the video and in the terminal. Viewers are only
+// announced once they moved by viewerChangePercent, and not in the terminal
+// when the keyboard status line shows them. A stream that went offline is
+// not polled again unless another one plays.
+func (s *streamSession) watchMetadata(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	announced := s.Status().Viewers
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+
+		before := s.Status()
+		if before.Offline {
+			continue
+		}
+		if err := s.Refresh(); err != nil {
+			fmt.Fprintln(s, err.Error())
+			continue
+		}
+		after := s.Status()
+		if after.Channel != before.Channel {
+			announced = after.Viewers
+			continue
+		}
+
+		uptime := formatUptime(time.Since(after.Started))
+		var notices []string
+		if after.Title != before.Title {
+			fmt.Fprintf(s, "[up %s] Title changed: %s\n", uptime, after.Title)
+			notices = append(notices, after.Title)
+		}
+		if after.Game != before.Game {
+			fmt.Fprintf(s, "[up %s] Now playing %s\n", uptime, after.Game)
+			notices = append(notices, "Now playing "+after.Game)
+		}
+		if viewersChanged(announced, after.Viewers) {
+			announced = after.Viewers
+			if !s.hasStatusLine() {
+				fmt.Fprintf(s, "[up %s] %d viewers\n", uptime, after.Viewers)
+			}
+			notices = append(notices, fmt.Sprintf("%d viewers", after.Viewers))
+		}
+		if len(notices) > 0 {
+			s.Notice(strings.Join(notices, " | "))
+		}
+	}
+}
+
+func viewersChanged(announced, viewers uint64) bool {
+	diff := viewers - announced
+	if viewers < announced {
+		diff = announced - viewers
+	}
+
+	return diff > 0 && diff*100 >= announced*viewerChangePercent
+}
+
+// Notice shows text on the video, between chat messages if the chat overlay
+// is shown, or else for DefaultOsdDuration.
+func (s *streamSession) Notice(text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.chat != nil {
+		s.chat.Notice(text)
+		return
+	}
+	if s.ctx.Bool("no-osd") {
+		return
+	}
+
+	if err := mediaPlayer().SetOverlayText(text); err != nil {
+		fmt.Fprintf(s, "Error updating OSD: %s\n", err.Error())
+		return
+	}
+	s.notices++
+	notice := s.notices
+	time.AfterFunc(DefaultOsdDuration, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if s.notices == notice {
+			mediaPlayer().SetOverlayText("")
+		}
+	})
+}
@@ -0,0 +1,441 @@
+package mpris
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+
+	"github.com/hchagen/twitch-player/player"
+)
+
+const (
+	BusName  = "org.mpris.MediaPlayer2.twitchplayer"
+	Identity = "Twitch Player"
+
+	objectPath      = "/org/mpris/MediaPlayer2"
+	trackPath       = "/org/mpris/MediaPlayer2/twitchplayer/track/"
+	rootInterface   = "org.mpris.MediaPlayer2"
+	playerInterface = "org.mpris.MediaPlayer2.Player"
+
+	introspectableInterface = "org.freedesktop.DBus.Introspectable"
+
+	statusPlaying = "Playing"
+	statusPaused  = "Paused"
+	statusStopped = "Stopped"
+
+	pollInterval = time.Second
+)
+
+var errNotSupported = dbus.MakeFailedError(fmt.Errorf("Not supported for live streams"))
+
+// Metadata describes the stream in xesam terms: the title is the stream title,
+// the artist the channel and the album the game.
+type Metadata struct {
+	Id     string
+	Title  string
+	Artist string
+	Album  string
+	ArtUrl string
+	Url    string
+}
+
+func (m Metadata) variants() map[string]dbus.Variant {
+	md := map[string]dbus.Variant{
+		"mpris:trackid": dbus.MakeVariant(dbus.ObjectPath(trackPath + m.Id)),
+		"xesam:title":   dbus.MakeVariant(m.Title),
+		"xesam:artist":  dbus.MakeVariant([]string{m.Artist}),
+		"xesam:album":   dbus.MakeVariant(m.Album),
+	}
+	if m.ArtUrl != "" {
+		md["mpris:artUrl"] = dbus.MakeVariant(m.ArtUrl)
+	}
+	if m.Url != "" {
+		md["xesam:url"] = dbus.MakeVariant(m.Url)
+	}
+
+	return md
+}
+
+// Server exposes a player on the session bus. OnStop is called for Stop and
+// Quit, since stopping a live stream ends playback.
+type Server struct {
+	OnStop func()
+
+	mu       sync.Mutex
+	next     func() error
+	previous func() error
+
+	conn     *dbus.Conn
+	ownsConn bool
+	player   player.Player
+	props    *prop.Properties
+	name     string
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type root struct {
+	s *Server
+}
+
+type mprisPlayer struct {
+	s *Server
+}
+
+// playerMethods maps Go method names to D-Bus ones where the D-Bus name
+// clashes with a standard Go signature, such as io.Seeker's Seek.
+var playerMethods = map[string]string{
+	"SeekMpris": "Seek",
+}
+
+// NewServer registers on conn, falling back to a per process instance name if
+// another player already owns BusName. Close leaves conn open for the caller.
+func NewServer(conn *dbus.Conn, p player.Player) (*Server, error) {
+	s := &Server{
+		conn:   conn,
+		player: p,
+		done:   make(chan struct{}),
+	}
+
+	if err := s.export(); err != nil {
+		s.unexport()
+		return nil, err
+	}
+
+	go s.poll()
+
+	return s, nil
+}
+
+func (s *Server) export() error {
+	props, err := prop.Export(s.conn, objectPath, s.propMap())
+	if err != nil {
+		return err
+	}
+	s.props = props
+
+	if err := s.conn.Export(root{s}, objectPath, rootInterface); err != nil {
+		return err
+	}
+	if err := s.conn.ExportWithMap(mprisPlayer{s}, playerMethods, objectPath, playerInterface); err != nil {
+		return err
+	}
+	methods := introspect.Methods(mprisPlayer{s})
+	for i := range methods {
+		if name, ok := playerMethods[methods[i].Name]; ok {
+			methods[i].Name = name
+		}
+	}
+
+	node := &introspect.Node{
+		Name: objectPath,
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			prop.IntrospectData,
+			{
+				Name:       rootInterface,
+				Methods:    introspect.Methods(root{s}),
+				Properties: props.Introspection(rootInterface),
+			},
+			{
+				Name:       playerInterface,
+				Methods:    methods,
+				Properties: props.Introspection(playerInterface),
+			},
+		},
+	}
+	if err := s.conn.Export(introspect.NewIntrospectable(node), objectPath, introspectableInterface); err != nil {
+		return err
+	}
+
+	for _, name := range []string{BusName, fmt.Sprintf("%s.instance%d", BusName, os.Getpid())} {
+		reply, err := s.conn.RequestName(name, dbus.NameFlagDoNotQueue)
+		if err != nil {
+			return err
+		}
+		if reply == dbus.RequestNameReplyPrimaryOwner {
+			s.name = name
+			break
+		}
+	}
+	if s.name == "" {
+		return fmt.Errorf("Cannot register %s: Name is taken", BusName)
+	}
+
+	return nil
+}
+
+func (s *Server) unexport() {
+	for _, iface := range []string{rootInterface, playerInterface, introspectableInterface, "org.freedesktop.DBus.Properties"} {
+		s.conn.Export(nil, objectPath, iface)
+	}
+}
+
+// NewSessionServer connects to the user's session bus.
+func NewSessionServer(p player.Player) (*Server, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := NewServer(conn, p)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	s.ownsConn = true
+
+	return s, nil
+}
+
+func (s *Server) Name() string {
+	return s.name
+}
+
+func (s *Server) SetMetadata(m Metadata) {
+	s.props.SetMust(playerInterface, "Metadata", m.variants())
+}
+
+// SetNavigation enables Next and Previous, e.g. for flipping through channels.
+func (s *Server) SetNavigation(next, previous func() error) {
+	s.mu.Lock()
+	s.next, s.previous = next, previous
+	s.mu.Unlock()
+
+	s.props.SetMust(playerInterface, "CanGoNext", next != nil)
+	s.props.SetMust(playerInterface, "CanGoPrevious", previous != nil)
+}
+
+func (s *Server) navigate(next bool) *dbus.Error {
+	s.mu.Lock()
+	fn := s.previous
+	if next {
+		fn = s.next
+	}
+	s.mu.Unlock()
+
+	if fn == nil {
+		return nil
+	}
+	if err := fn(); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+
+	return nil
+}
+
+// Close releases the bus name and removes the exported objects, closing the
+// connection only if NewSessionServer opened it.
+func (s *Server) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.done)
+		_, err = s.conn.ReleaseName(s.name)
+		s.unexport()
+		if s.ownsConn {
+			err = s.conn.Close()
+		}
+	})
+
+	return err
+}
+
+func (s *Server) propMap() prop.Map {
+	return prop.Map{
+		rootInterface: {
+			"CanQuit":             {Value: true, Emit: prop.EmitFalse},
+			"CanRaise":            {Value: false, Emit: prop.EmitFalse},
+			"HasTrackList":        {Value: false, Emit: prop.EmitFalse},
+			"Identity":            {Value: Identity, Emit: prop.EmitFalse},
+			"SupportedUriSchemes": {Value: []string{}, Emit: prop.EmitFalse},
+			"SupportedMimeTypes":  {Value: []string{}, Emit: prop.EmitFalse},
+			"CanSetFullscreen":    {Value: true, Emit: prop.EmitFalse},
+			"Fullscreen": {
+				Value:    false,
+				Writable: true,
+				Emit:     prop.EmitTrue,
+				Callback: s.setFullscreen,
+			},
+		},
+		playerInterface: {
+			"PlaybackStatus": {Value: statusStopped, Emit: prop.EmitTrue},
+			"Rate":           {Value: 1.0, Emit: prop.EmitFalse},
+			"MinimumRate":    {Value: 1.0, Emit: prop.EmitFalse},
+			"MaximumRate":    {Value: 1.0, Emit: prop.EmitFalse},
+			"Metadata":       {Value: Metadata{}.variants(), Emit: prop.EmitTrue},
+			"Volume": {
+				Value:    1.0,
+				Writable: true,
+				Emit:     prop.EmitTrue,
+				Callback: s.setVolume,
+			},
+			"Position":      {Value: int64(0), Emit: prop.EmitFalse},
+			"CanGoNext":     {Value: false, Emit: prop.EmitTrue},
+			"CanGoPrevious": {Value: false, Emit: prop.EmitTrue},
+			"CanPlay":       {Value: true, Emit: prop.EmitFalse},
+			"CanPause":      {Value: true, Emit: prop.EmitFalse},
+			"CanSeek":       {Value: false, Emit: prop.EmitFalse},
+			"CanControl":    {Value: true, Emit: prop.EmitFalse},
+		},
+	}
+}
+
+func (s *Server) setVolume(c *prop.Change) *dbus.Error {
+	volume, ok := c.Value.(float64)
+	if !ok {
+		return prop.ErrInvalidArg
+	}
+	if volume < 0 {
+		volume = 0
+	}
+
+	if err := s.player.SetVolume(int(volume * 100)); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+
+	return nil
+}
+
+func (s *Server) setFullscreen(c *prop.Change) *dbus.Error {
+	fullscreen, ok := c.Value.(bool)
+	if !ok {
+		return prop.ErrInvalidArg
+	}
+
+	current, err := s.player.IsFullscreen()
+	if err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	if current == fullscreen {
+		return nil
+	}
+	if fullscreen {
+		err = s.player.EnterFullscreen()
+	} else {
+		err = s.player.ExitFullscreen()
+	}
+	if err != nil {
+		return dbus.MakeFailedError(err)
+	}
+
+	return nil
+}
+
+// poll mirrors changes made outside of D-Bus, e.g. from the VLC window.
+func (s *Server) poll() {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.update()
+		}
+	}
+}
+
+func (s *Server) update() {
+	if status := s.status(); status != s.props.GetMust(playerInterface, "PlaybackStatus") {
+		s.props.SetMust(playerInterface, "PlaybackStatus", status)
+	}
+	if volume, err := s.player.Volume(); err == nil && volume >= 0 {
+		if v := float64(volume) / 100; v != s.props.GetMust(playerInterface, "Volume") {
+			s.props.SetMust(playerInterface, "Volume", v)
+		}
+	}
+	if fs, err := s.player.IsFullscreen(); err == nil && fs != s.props.GetMust(rootInterface, "Fullscreen") {
+		s.props.SetMust(rootInterface, "Fullscreen", fs)
+	}
+	if pos, err := s.player.Position(); err == nil {
+		s.props.SetMust(playerInterface, "Position", int64(pos/time.Microsecond))
+	}
+}
+
+func (s *Server) status() string {
+	state, err := s.player.State()
+	if err != nil {
+		return statusStopped
+	}
+
+	switch state {
+	case player.StatePlaying, player.StateOpening, player.StateBuffering:
+		return statusPlaying
+	case player.StatePaused:
+		return statusPaused
+	}
+
+	return statusStopped
+}
+
+func (s *Server) stop() {
+	if s.OnStop != nil {
+		s.OnStop()
+	}
+}
+
+func (r root) Raise() *dbus.Error {
+	return nil
+}
+
+func (r root) Quit() *dbus.Error {
+	r.s.stop()
+	return nil
+}
+
+func (p mprisPlayer) Next() *dbus.Error {
+	return p.s.navigate(true)
+}
+
+func (p mprisPlayer) Previous() *dbus.Error {
+	return p.s.navigate(false)
+}
+
+func (p mprisPlayer) Pause() *dbus.Error {
+	return p.call(p.s.player.Pause)
+}
+
+func (p mprisPlayer) Play() *dbus.Error {
+	return p.call(p.s.player.Resume)
+}
+
+func (p mprisPlayer) PlayPause() *dbus.Error {
+	if p.s.status() == statusPlaying {
+		return p.call(p.s.player.Pause)
+	}
+
+	return p.call(p.s.player.Resume)
+}
+
+func (p mprisPlayer) Stop() *dbus.Error {
+	p.s.stop()
+	return nil
+}
+
+func (p mprisPlayer) SeekMpris(offset int64) *dbus.Error {
+	return errNotSupported
+}
+
+func (p mprisPlayer) SetPosition(track dbus.ObjectPath, position int64) *dbus.Error {
+	return errNotSupported
+}
+
+func (p mprisPlayer) OpenUri(uri string) *dbus.Error {
+	return errNotSupported
+}
+
+func (p mprisPlayer) call(fn func() error) *dbus.Error {
+	if err := fn(); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	p.s.update()
+
+	return nil
+}
@@ -0,0 +1,214 @@
+package mpris
+
+import (
+	"bufio"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/hchagen/twitch-player/player"
+)
+
+type fakePlayer struct {
+	mu     sync.Mutex
+	state  player.State
+	volume int
+}
+
+func (p *fakePlayer) LoadFromUrl(url string) error   { return nil }
+func (p *fakePlayer) LoadFromFile(path string) error { return nil }
+func (p *fakePlayer) Play() error                    { return p.setState(player.StatePlaying) }
+func (p *fakePlayer) Pause() error                   { return p.setState(player.StatePaused) }
+func (p *fakePlayer) Resume() error                  { return p.setState(player.StatePlaying) }
+func (p *fakePlayer) Stop() error                    { return p.setState(player.StateStopped) }
+func (p *fakePlayer) Seek(offset time.Duration) error {
+	return nil
+}
+func (p *fakePlayer) Position() (time.Duration, error) { return 0, nil }
+func (p *fakePlayer) Length() (time.Duration, error)   { return 0, nil }
+func (p *fakePlayer) SetMute(mute bool) error          { return nil }
+func (p *fakePlayer) IsMuted() (bool, error)           { return false, nil }
+func (p *fakePlayer) IsFullscreen() (bool, error)      { return false, nil }
+func (p *fakePlayer) EnterFullscreen() error           { return nil }
+func (p *fakePlayer) ExitFullscreen() error            { return nil }
+func (p *fakePlayer) SetOverlayText(text string) error { return nil }
+func (p *fakePlayer) Reset() error                     { return nil }
+func (p *fakePlayer) Close() error                     { return nil }
+
+func (p *fakePlayer) State() (player.State, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.state, nil
+}
+
+func (p *fakePlayer) setState(state player.State) error {
+	p.mu.Lock()
+	p.state = state
+	p.mu.Unlock()
+
+	return nil
+}
+
+func (p *fakePlayer) Volume() (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.volume, nil
+}
+
+func (p *fakePlayer) SetVolume(volume int) error {
+	p.mu.Lock()
+	p.volume = volume
+	p.mu.Unlock()
+
+	return nil
+}
+
+// privateBus starts a dbus-daemon of its own so the test never touches the
+// user's session.
+func privateBus(t *testing.T) string {
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon is not installed")
+	}
+
+	cmd := exec.Command(daemon, "--session", "--nofork", "--print-address")
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Skipf("Cannot start dbus-daemon: %s", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	address, err := bufio.NewReader(out).ReadString('\n')
+	if err != nil {
+		t.Fatalf("Cannot read bus address: %s", err)
+	}
+
+	return strings.TrimSpace(address)
+}
+
+func connect(t *testing.T, address string) *dbus.Conn {
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return conn
+}
+
+func TestServer(t *testing.T) {
+	address := privateBus(t)
+
+	p := &fakePlayer{state: player.StatePlaying, volume: 50}
+	conn := connect(t, address)
+	defer conn.Close()
+	s, err := NewServer(conn, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	client := connect(t, address)
+	defer client.Close()
+	obj := client.Object(s.Name(), objectPath)
+
+	if err := obj.Call(playerInterface+".PlayPause", 0).Err; err != nil {
+		t.Fatalf("PlayPause: %s", err)
+	}
+	if state, _ := p.State(); state != player.StatePaused {
+		t.Errorf("PlayPause left the player %s, want %s", state, player.StatePaused)
+	}
+	if err := obj.Call(playerInterface+".PlayPause", 0).Err; err != nil {
+		t.Fatalf("PlayPause: %s", err)
+	}
+	if state, _ := p.State(); state != player.StatePlaying {
+		t.Errorf("PlayPause left the player %s, want %s", state, player.StatePlaying)
+	}
+
+	if err := obj.Call(playerInterface+".Seek", 0, int64(0)).Err; err == nil {
+		t.Error("Seek succeeded on a live stream")
+	} else if dbusErr, ok := err.(dbus.Error); !ok || dbusErr.Name != "org.freedesktop.DBus.Error.Failed" {
+		t.Errorf("Seek: %s", err)
+	}
+
+	s.update()
+	volume, err := obj.GetProperty(playerInterface + ".Volume")
+	if err != nil {
+		t.Fatalf("Volume: %s", err)
+	}
+	if v, _ := volume.Value().(float64); v != 0.5 {
+		t.Errorf("Volume is %v, want 0.5", volume.Value())
+	}
+	if err := obj.SetProperty(playerInterface+".Volume", dbus.MakeVariant(0.8)); err != nil {
+		t.Fatalf("Set Volume: %s", err)
+	}
+	if v, _ := p.Volume(); v != 80 {
+		t.Errorf("Player volume is %d, want 80", v)
+	}
+
+	s.SetMetadata(Metadata{
+		Id:     "42",
+		Title:  "Speedrun",
+		Artist: "streamer",
+		Album:  "Celeste",
+	})
+	variant, err := obj.GetProperty(playerInterface + ".Metadata")
+	if err != nil {
+		t.Fatalf("Metadata: %s", err)
+	}
+	md, ok := variant.Value().(map[string]dbus.Variant)
+	if !ok {
+		t.Fatalf("Metadata is %T", variant.Value())
+	}
+	if title, _ := md["xesam:title"].Value().(string); title != "Speedrun" {
+		t.Errorf("Title is %q, want %q", title, "Speedrun")
+	}
+	if artist, _ := md["xesam:artist"].Value().([]string); len(artist) != 1 || artist[0] != "streamer" {
+		t.Errorf("Artist is %q, want [streamer]", artist)
+	}
+	if album, _ := md["xesam:album"].Value().(string); album != "Celeste" {
+		t.Errorf("Album is %q, want %q", album, "Celeste")
+	}
+	if id, _ := md["mpris:trackid"].Value().(dbus.ObjectPath); id != trackPath+"42" {
+		t.Errorf("Track id is %q, want %q", id, trackPath+"42")
+	}
+}
+
+func TestCloseKeepsConn(t *testing.T) {
+	address := privateBus(t)
+	conn := connect(t, address)
+	defer conn.Close()
+
+	p := &fakePlayer{state: player.StatePlaying, volume: 50}
+	s, err := NewServer(conn, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !conn.Connected() {
+		t.Fatal("Close closed the caller's connection")
+	}
+
+	// the name and objects are free for another server on the same connection
+	s, err = NewServer(conn, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if s.Name() != BusName {
+		t.Errorf("Name is %q after closing the first server, want %q", s.Name(), BusName)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli"
+
+	"github.com/hchagen/twitch-player/player"
+	"github.com/hchagen/twitch-player/twitch"
+)
+
+type multiStream struct {
+	channel string
+	uri     twitch.StreamUrl
+	player  player.Player
+}
+
+// parseQualityHeight returns the vertical resolution of qualities like 720p60,
+// 1080p or 1280x720.
+func parseQualityHeight(quality string) int {
+	if i := strings.IndexByte(quality, 'x'); i >= 0 {
+		quality = quality[i+1:]
+	}
+	if i := strings.IndexByte(quality, 'p'); i >= 0 {
+		quality = quality[:i]
+	}
+
+	height, _ := strconv.Atoi(quality)
+	return height
+}
+
+// cappedStreamUrl picks the quality if available, or else the best video
+// variant not above its resolution. An empty quality picks the best variant.
+func cappedStreamUrl(uris []twitch.StreamUrl, quality string) (twitch.StreamUrl, error) {
+	if quality != "" {
+		if uri, err := findStreamUrl(uris, quality); err == nil {
+			return uri, nil
+		}
+	}
+
+	max := parseQualityHeight(quality)
+	var best twitch.StreamUrl
+	for _, uri := range uris {
+		height := parseQualityHeight(uri.Resolution)
+		if height == 0 || (max > 0 && height > max) {
+			continue
+		}
+		if uri.Bandwidth > best.Bandwidth {
+			best = uri
+		}
+	}
+	if best.URI == "" {
+		return best, fmt.Errorf("No quality up to %s available", quality)
+	}
+
+	return best, nil
+}
+
+// parseMultiArg splits channel:quality arguments, defaulting to the max quality.
+func parseMultiArg(arg, maxQuality string) (string, string) {
+	if i := strings.LastIndexByte(arg, ':'); i >= 0 {
+		return arg[:i], arg[i+1:]
+	}
+
+	return arg, maxQuality
+}
+
+func openMultiStream(arg, maxQuality string) (*multiStream, error) {
+	channelName, quality := parseMultiArg(arg, maxQuality)
+
+	channel, err := selectChannel(os.Stdout, channelName)
+	if err != nil {
+		return nil, err
+	}
+	streamData, err := twitchClient().GetStreamData(channel.Id)
+	if err != nil {
+		return nil, err
+	}
+	if streamData.Stream.Id == 0 {
+		return nil, fmt.Errorf("No online stream found for channel %s", channelName)
+	}
+
+	uris, err := twitchClient().GetStreamUrls(channel.Name)
+	if err != nil {
+		return nil, err
+	}
+	uri, err := cappedStreamUrl(uris, quality)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", channel.Name, err.Error())
+	}
+
+	p, err := player.NewVlcPlayer(aout, vout, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.LoadFromUrl(uri.URI); err != nil {
+		p.Close()
+		return nil, err
+	}
+
+	return &multiStream{
+		channel: channel.Name,
+		uri:     uri,
+		player:  p,
+	}, nil
+}
+
+// focusMultiStream unmutes the focused stream and mutes all others.
+func focusMultiStream(streams []*multiStream, focus int) error {
+	for i, s := range streams {
+		if err := s.player.SetMute(i != focus); err != nil {
+			return err
+		}
+	}
+
+	for i, s := range streams {
+		marker := " "
+		if i == focus {
+			marker = "*"
+		}
+		fmt.Printf("%s[%d] %s %s (%s)\n", marker, i+1, s.channel, s.uri.Resolution, s.uri.Quality)
+	}
+
+	return nil
+}
+
+func onMulti(ctx *cli.Context) error {
+	if ctx.NArg() < 2 {
+		return fmt.Errorf("Please provide at least two channel names")
+	}
+
+	var streams []*multiStream
+	defer func() {
+		for _, s := range streams {
+			s.player.Close()
+		}
+	}()
+
+	for _, arg := range ctx.Args() {
+		s, err := openMultiStream(arg, ctx.String("max-quality"))
+		if err != nil {
+			return err
+		}
+		streams = append(streams, s)
+	}
+
+	focus := ctx.Int("focus") - 1
+	if focus < 0 || focus >= len(streams) {
+		return fmt.Errorf("--focus must be between 1 and %d", len(streams))
+	}
+
+	for _, s := range streams {
+		fmt.Printf("Playing %s %s (%s)...\n", s.channel, s.uri.Resolution, s.uri.Quality)
+		if err := s.player.Play(); err != nil {
+			return err
+		}
+	}
+	if err := focusMultiStream(streams, focus); err != nil {
+		return err
+	}
+	fmt.Printf("\nEnter 1-%d to move audio focus, q to quit\n", len(streams))
+
+	input := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			input <- strings.TrimSpace(scanner.Text())
+		}
+		close(input)
+	}()
+
+	signals := make(chan struct{})
+	go func() {
+		waitForSignal()
+		close(signals)
+	}()
+
+	for {
+		select {
+		case line, ok := <-input:
+			if !ok || line == "q" {
+				return nil
+			}
+			n, err := strconv.Atoi(line)
+			if err != nil || n < 1 || n > len(streams) {
+				fmt.Printf("Enter 1-%d to move audio focus, q to quit\n", len(streams))
+				continue
+			}
+			if err := focusMultiStream(streams, n-1); err != nil {
+				return err
+			}
+		case <-signals:
+			return nil
+		}
+	}
+}
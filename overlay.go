@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli"
+
+	"github.com/hchagen/twitch-player/chat"
+	"github.com/hchagen/twitch-player/player"
+)
+
+var (
+	DefaultChatOverlayPosition = "bottom-left"
+	DefaultChatOverlayLifetime = 20 * time.Second
+	DefaultChatOverlayLines    = 8
+	DefaultChatOverlayWidth    = 80
+	DefaultOsdPosition         = "top-left"
+)
+
+type chatOverlayLine struct {
+	text    string
+	expires time.Time
+}
+
+type chatOverlay struct {
+	client   chat.Client
+	player   player.Player
+	out      io.Writer
+	lifetime time.Duration
+	maxLines int
+	users    map[string]bool
+	badges   []string
+
+	mu    sync.Mutex
+	lines []chatOverlayLine
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+var chatOverlayFlags = []cli.Flag{
+	cli.BoolFlag{
+		Name:  "chat",
+		Usage: "Show chat as an overlay on the video",
+	},
+	cli.StringFlag{
+		Name:  "chat-position",
+		Usage: "Chat overlay position (top-left, top-right, bottom-left, bottom-right, top, bottom, left, right, center)",
+		Value: DefaultChatOverlayPosition,
+	},
+	cli.DurationFlag{
+		Name:  "chat-lifetime",
+		Usage: "How long a chat message stays on screen",
+		Value: DefaultChatOverlayLifetime,
+	},
+	cli.IntFlag{
+		Name:  "chat-lines",
+		Usage: "Maximum number of chat messages on screen",
+		Value: DefaultChatOverlayLines,
+	},
+	cli.IntFlag{
+		Name:  "chat-size",
+		Usage: "Chat overlay font size in pixels (0 for default)",
+	},
+	cli.StringSliceFlag{
+		Name:  "chat-user",
+		Usage: "Only show messages from this user (repeatable)",
+	},
+	cli.StringSliceFlag{
+		Name:  "chat-badge",
+		Usage: "Only show messages from users with this badge, e.g. moderator, vip (repeatable)",
+	},
+}
+
+// overlayFromFlags shares the overlay between chat and OSD notices, placing
+// it where chat goes if shown.
+func overlayFromFlags(ctx *cli.Context) *player.Overlay {
+	switch {
+	case ctx.Bool("chat"):
+		return &player.Overlay{
+			Position: ctx.String("chat-position"),
+			Size:     ctx.Int("chat-size"),
+		}
+	case !ctx.Bool("no-osd"):
+		return &player.Overlay{
+			Position: DefaultOsdPosition,
+			Size:     ctx.Int("chat-size"),
+		}
+	}
+
+	return nil
+}
+
+// startChatOverlay reports overlay errors to out.
+func startChatOverlay(ctx *cli.Context, p player.Player, channel string, out io.Writer) (*chatOverlay, error) {
+	client := chat.NewChatClient(chat.IrcServer, "", "", DefaultTwitchHttpTimeout)
+	if err := client.Join(channel); err != nil {
+		return nil, err
+	}
+	if err := client.Connect(); err != nil {
+		return nil, err
+	}
+
+	o := &chatOverlay{
+		client:   client,
+		player:   p,
+		out:      out,
+		lifetime: ctx.Duration("chat-lifetime"),
+		maxLines: ctx.Int("chat-lines"),
+		users:    make(map[string]bool),
+		badges:   ctx.StringSlice("chat-badge"),
+		done:     make(chan struct{}),
+	}
+	for _, u := range ctx.StringSlice("chat-user") {
+		o.users[strings.ToLower(u)] = true
+	}
+
+	o.wg.Add(2)
+	go o.receive()
+	go o.refresh()
+
+	return o, nil
+}
+
+func (o *chatOverlay) Close() error {
+	close(o.done)
+	err := o.client.Close()
+	o.wg.Wait()
+
+	return err
+}
+
+// Notice shows a line between the chat messages.
+func (o *chatOverlay) Notice(text string) {
+	o.add("** " + text)
+}
+
+func (o *chatOverlay) add(text string) {
+	if r := []rune(text); len(r) > DefaultChatOverlayWidth {
+		text = string(r[:DefaultChatOverlayWidth-3]) + "..."
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.lines = append(o.lines, chatOverlayLine{
+		text:    text,
+		expires: time.Now().Add(o.lifetime),
+	})
+	if len(o.lines) > o.maxLines {
+		o.lines = o.lines[len(o.lines)-o.maxLines:]
+	}
+}
+
+func (o *chatOverlay) accept(cm chat.ChatMessage) bool {
+	if len(o.users) == 0 && len(o.badges) == 0 {
+		return true
+	}
+	if o.users[cm.User] {
+		return true
+	}
+	for _, b := range o.badges {
+		if cm.HasBadge(b) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (o *chatOverlay) receive() {
+	defer o.wg.Done()
+
+	for msg := range o.client.Messages() {
+		cm, ok := msg.ChatMessage()
+		if !ok || msg.Command != "PRIVMSG" || !o.accept(cm) {
+			continue
+		}
+
+		if cm.Action {
+			o.add("* " + cm.DisplayName + " " + cm.Text)
+		} else {
+			o.add(cm.DisplayName + ": " + cm.Text)
+		}
+	}
+}
+
+func (o *chatOverlay) refresh() {
+	defer o.wg.Done()
+
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+
+	var shown string
+	for {
+		select {
+		case <-o.done:
+			o.player.SetOverlayText("")
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		o.mu.Lock()
+		for len(o.lines) > 0 && now.After(o.lines[0].expires) {
+			o.lines = o.lines[1:]
+		}
+		texts := make([]string, len(o.lines))
+		for i, l := range o.lines {
+			texts[i] = l.text
+		}
+		o.mu.Unlock()
+
+		if text := strings.Join(texts, "\n"); text != shown {
+			if err := o.player.SetOverlayText(text); err != nil {
+				fmt.Fprintf(o.out, "Error updating chat overlay: %s\n", err.Error())
+			}
+			shown = text
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+
+	"github.com/hchagen/twitch-player/hls"
+	"github.com/hchagen/twitch-player/party"
+)
+
+var (
+	DefaultPartyAddr      = ":7878"
+	DefaultPartyInterval  = time.Second
+	DefaultPartyTolerance = time.Second
+	DefaultPartyWindow    = 10
+	DefaultPartyMaxWait   = 10 * time.Second
+)
+
+var partyPlayerFlags = []cli.Flag{
+	cli.BoolFlag{
+		Name:  "fullscreen,f",
+		Usage: "Run in fullscreen",
+	},
+	cli.StringFlag{
+		Name:  "aout,a",
+		Usage: "Audio output device",
+	},
+	cli.StringFlag{
+		Name:  "vout,v",
+		Usage: "Video output device",
+	},
+}
+
+func onPartyBefore(ctx *cli.Context) error {
+	aout = ctx.String("aout")
+	vout = ctx.String("vout")
+	return nil
+}
+
+// partyPlayer plays a stream through a local relay, so the player position can
+// be mapped to the program date-time shared between instances.
+type partyPlayer struct {
+	relay   *relay
+	quality string
+	playing bool
+}
+
+func startPartyPlayer(ctx *cli.Context, channel, quality string) (*partyPlayer, error) {
+	stream, uri, err := selectLiveStream(os.Stdout, channel, quality)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := startRelay(ctx, stream, uri, "127.0.0.1:0", DefaultPartyWindow, os.Stdout)
+	if err != nil {
+		return nil, err
+	}
+	name, quality := stream.Channel.Name, uri.Quality
+	uri.URI = "http://" + r.Addr() + hls.MasterPlaylistPath
+	if err := playStreamUrl(ctx, name, uri); err != nil {
+		r.Close()
+		return nil, err
+	}
+
+	return &partyPlayer{
+		relay:   r,
+		quality: quality,
+		playing: true,
+	}, nil
+}
+
+func (p *partyPlayer) Position() (time.Time, bool) {
+	anchor, ok := p.relay.Anchor()
+	if !ok {
+		return time.Time{}, false
+	}
+	pos, err := mediaPlayer().Position()
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return anchor.Add(pos), true
+}
+
+func (p *partyPlayer) SetPlaying(playing bool) error {
+	if playing == p.playing {
+		return nil
+	}
+
+	var err error
+	if playing {
+		err = mediaPlayer().Resume()
+	} else {
+		err = mediaPlayer().Pause()
+	}
+	if err != nil {
+		return err
+	}
+	p.playing = playing
+
+	return nil
+}
+
+func (p *partyPlayer) Close() error {
+	return p.relay.Close()
+}
+
+func readLines() <-chan string {
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			lines <- strings.TrimSpace(scanner.Text())
+		}
+		close(lines)
+	}()
+
+	return lines
+}
+
+func onPartyLead(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("Please provide a channel name")
+	}
+
+	leader, err := party.Listen(ctx.String("addr"))
+	if err != nil {
+		return err
+	}
+	defer leader.Close()
+
+	p, err := startPartyPlayer(ctx, ctx.Args()[0], ctx.String("quality"))
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+
+	channel := ctx.Args()[0]
+	broadcast := func() {
+		s := party.State{
+			Channel: channel,
+			Quality: p.quality,
+			Playing: p.playing,
+			Sent:    time.Now(),
+		}
+		s.Position, _ = p.Position()
+		leader.Broadcast(s)
+	}
+
+	fmt.Printf("Leading party on %s, enter p to pause or resume for everyone\n", leader.Addr())
+
+	ticker := time.NewTicker(DefaultPartyInterval)
+	defer ticker.Stop()
+
+	lines, signals := readLines(), signalled()
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				lines = nil
+				continue
+			}
+			if line != "p" {
+				continue
+			}
+			if err := p.SetPlaying(!p.playing); err != nil {
+				return err
+			}
+			broadcast()
+			if p.playing {
+				fmt.Printf("Resumed for %d followers\n", leader.Followers())
+			} else {
+				fmt.Printf("Paused for %d followers\n", leader.Followers())
+			}
+		case <-ticker.C:
+			broadcast()
+		case <-signals:
+			return nil
+		}
+	}
+}
+
+func onPartyJoin(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("Please provide the leader address")
+	}
+
+	follower, err := party.Join(ctx.Args()[0], DefaultTwitchHttpTimeout)
+	if err != nil {
+		return err
+	}
+	defer follower.Close()
+
+	tolerance := ctx.Duration("tolerance")
+	signals := signalled()
+
+	var p *partyPlayer
+	var settled time.Time
+	for {
+		var s party.State
+		var ok bool
+		select {
+		case s, ok = <-follower.States():
+			if !ok {
+				if err := follower.Err(); err != nil {
+					return err
+				}
+				fmt.Println("Leader ended the party")
+				return nil
+			}
+		case <-signals:
+			return nil
+		}
+
+		if p == nil {
+			fmt.Printf("Joining party watching %s\n", s.Channel)
+			if p, err = startPartyPlayer(ctx, s.Channel, s.Quality); err != nil {
+				return err
+			}
+			defer p.Close()
+		}
+
+		if s.Playing != p.playing {
+			if s.Playing {
+				fmt.Println("Leader resumed")
+			} else {
+				fmt.Println("Leader paused")
+			}
+			if err := p.SetPlaying(s.Playing); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		pos, ok := p.Position()
+		if !s.Playing || !ok || s.Position.IsZero() || now.Before(settled) {
+			continue
+		}
+
+		// waiting only works for small leads, anything more is sought back
+		drift := pos.Sub(s.PositionAt(now))
+		switch {
+		case drift > tolerance && drift <= DefaultPartyMaxWait:
+			fmt.Printf("Ahead of leader by %.1fs, waiting\n", drift.Seconds())
+			if err := mediaPlayer().Pause(); err != nil {
+				return err
+			}
+			timer := time.NewTimer(drift)
+			select {
+			case <-timer.C:
+			case <-signals:
+				timer.Stop()
+				return nil
+			}
+			if err := mediaPlayer().Resume(); err != nil {
+				return err
+			}
+		case drift > tolerance || drift < -tolerance:
+			if drift > 0 {
+				fmt.Printf("Ahead of leader by %.1fs, seeking\n", drift.Seconds())
+			} else {
+				fmt.Printf("Behind leader by %.1fs, seeking\n", -drift.Seconds())
+			}
+			offset, err := mediaPlayer().Position()
+			if err != nil {
+				return err
+			}
+			if err := mediaPlayer().Seek(offset - drift); err != nil {
+				return err
+			}
+		default:
+			continue
+		}
+		settled = time.Now().Add(2 * DefaultPartyInterval)
+	}
+}
@@ -0,0 +1,206 @@
+package party
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const writeTimeout = 5 * time.Second
+
+// State is sent by the leader as newline delimited JSON. Position is the
+// program date-time being played when the state was sent.
+type State struct {
+	Channel  string    `json:"channel"`
+	Quality  string    `json:"quality"`
+	Playing  bool      `json:"playing"`
+	Position time.Time `json:"position"`
+	Sent     time.Time `json:"sent"`
+}
+
+// PositionAt extrapolates the leader position, assuming both clocks are in sync.
+func (s State) PositionAt(now time.Time) time.Time {
+	if !s.Playing || s.Position.IsZero() {
+		return s.Position
+	}
+
+	return s.Position.Add(now.Sub(s.Sent))
+}
+
+type Leader struct {
+	listener net.Listener
+
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+	last   *State
+	closed bool
+}
+
+// Listen accepts followers on addr, sending each the last state on connect.
+func Listen(addr string) (*Leader, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Leader{
+		listener: listener,
+		conns:    make(map[net.Conn]struct{}),
+	}
+	go l.accept()
+
+	return l, nil
+}
+
+func (l *Leader) Addr() string {
+	return l.listener.Addr().String()
+}
+
+func (l *Leader) Followers() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return len(l.conns)
+}
+
+// Broadcast sends the state to all followers, dropping those that fail.
+// Followers are written to without holding the lock, so a slow one does not
+// hold up accepting others.
+func (l *Leader) Broadcast(s State) {
+	l.mu.Lock()
+	l.last = &s
+	conns := make([]net.Conn, 0, len(l.conns))
+	for conn := range l.conns {
+		conns = append(conns, conn)
+	}
+	l.mu.Unlock()
+
+	for _, conn := range conns {
+		if err := send(conn, s); err != nil {
+			conn.Close()
+			l.mu.Lock()
+			delete(l.conns, conn)
+			l.mu.Unlock()
+		}
+	}
+}
+
+func (l *Leader) Close() error {
+	err := l.listener.Close()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.closed = true
+	for conn := range l.conns {
+		conn.Close()
+		delete(l.conns, conn)
+	}
+
+	return err
+}
+
+func (l *Leader) accept() {
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		l.mu.Lock()
+		last := l.last
+		l.mu.Unlock()
+
+		if last != nil {
+			if err := send(conn, *last); err != nil {
+				conn.Close()
+				continue
+			}
+		}
+
+		l.mu.Lock()
+		if l.closed {
+			conn.Close()
+		} else {
+			l.conns[conn] = struct{}{}
+		}
+		l.mu.Unlock()
+	}
+}
+
+func send(conn net.Conn, s State) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err = conn.Write(append(data, '\n'))
+	return err
+}
+
+type Follower struct {
+	conn net.Conn
+
+	mu  sync.Mutex
+	err error
+
+	states chan State
+}
+
+// Join connects to a leader. States closes when the leader goes away.
+func Join(addr string, timeout time.Duration) (*Follower, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Follower{
+		conn:   conn,
+		states: make(chan State, 16),
+	}
+	go f.read()
+
+	return f, nil
+}
+
+func (f *Follower) States() <-chan State {
+	return f.states
+}
+
+func (f *Follower) Err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.err
+}
+
+func (f *Follower) Close() error {
+	return f.conn.Close()
+}
+
+func (f *Follower) read() {
+	defer close(f.states)
+
+	scanner := bufio.NewScanner(f.conn)
+	for scanner.Scan() {
+		var s State
+		if err := json.Unmarshal(scanner.Bytes(), &s); err != nil {
+			f.fail(fmt.Errorf("Decoding party state: %s", err.Error()))
+			return
+		}
+		f.states <- s
+	}
+	if err := scanner.Err(); err != nil {
+		f.fail(err)
+	}
+}
+
+func (f *Follower) fail(err error) {
+	f.mu.Lock()
+	f.err = err
+	f.mu.Unlock()
+}
@@ -1,15 +1,54 @@
 package player
 
+import "time"
+
+type Overlay struct {
+	Position string
+	Size     int
+	Opacity  int
+}
+
+type State string
+
+const (
+	StateIdle      State = "idle"
+	StateOpening   State = "opening"
+	StateBuffering State = "buffering"
+	StatePlaying   State = "playing"
+	StatePaused    State = "paused"
+	StateStopped   State = "stopped"
+	StateEnded     State = "ended"
+	StateError     State = "error"
+)
+
+// MaxVolume is the loudest volume in percent, amplifying the stream.
+const MaxVolume = 200
+
 type Player interface {
 	LoadFromUrl(url string) error
 	LoadFromFile(path string) error
 
 	Play() error
+	Pause() error
+	Resume() error
 	Stop() error
+	Seek(offset time.Duration) error
+
+	Position() (time.Duration, error)
+	Length() (time.Duration, error)
+	State() (State, error)
 
+	Volume() (int, error)
+	SetVolume(volume int) error
+	SetMute(mute bool) error
+	IsMuted() (bool, error)
+
+	IsFullscreen() (bool, error)
 	EnterFullscreen() error
 	ExitFullscreen() error
 
+	SetOverlayText(text string) error
+
 	Reset() error
 	Close() error
 }
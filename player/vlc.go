@@ -2,17 +2,56 @@ package player
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
 
 	vlc "github.com/adrg/libvlc-go"
 )
 
+var vlcStates = map[vlc.MediaState]State{
+	vlc.MediaNothingSpecial: StateIdle,
+	vlc.MediaOpening:        StateOpening,
+	vlc.MediaBuffering:      StateBuffering,
+	vlc.MediaPlaying:        StatePlaying,
+	vlc.MediaPaused:         StatePaused,
+	vlc.MediaStopped:        StateStopped,
+	vlc.MediaEnded:          StateEnded,
+	vlc.MediaError:          StateError,
+}
+
+var marqueePositions = map[string]int{
+	"center":       0,
+	"left":         1,
+	"right":        2,
+	"top":          4,
+	"top-left":     5,
+	"top-right":    6,
+	"bottom":       8,
+	"bottom-left":  9,
+	"bottom-right": 10,
+}
+
+// libvlc has a single global instance, shared by all players. Only the
+// params of the first player are applied.
+var (
+	vlcMu    sync.Mutex
+	vlcUsers int
+)
+
 type vlcPlayer struct {
 	player *vlc.Player
 
 	loadedMedia *vlc.Media
+	marqueeFile string
+
+	muted  bool
+	volume int
 }
 
-func NewVlcPlayer(aout, vout string) (Player, error) {
+func NewVlcPlayer(aout, vout string, overlay *Overlay) (Player, error) {
 	var params = []string{
 		"--quiet",
 	}
@@ -22,21 +61,90 @@ func NewVlcPlayer(aout, vout string) (Player, error) {
 	if vout != "" {
 		params = append(params, fmt.Sprintf("--vout=%s", vout))
 	}
-	if err := vlc.Init(params...); err != nil {
+
+	var marqueeFile string
+	if overlay != nil {
+		marqueeParams, file, err := marqueeParams(overlay)
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, marqueeParams...)
+		marqueeFile = file
+	}
+
+	if err := initVlc(params); err != nil {
 		return nil, err
 	}
 
 	player, err := vlc.NewPlayer()
 	if err != nil {
-		vlc.Release()
+		releaseVlc()
 		return nil, err
 	}
 
 	return &vlcPlayer{
-		player: player,
+		player:      player,
+		marqueeFile: marqueeFile,
 	}, nil
 }
 
+func initVlc(params []string) error {
+	vlcMu.Lock()
+	defer vlcMu.Unlock()
+
+	if vlcUsers == 0 {
+		if err := vlc.Init(params...); err != nil {
+			return err
+		}
+	}
+	vlcUsers++
+
+	return nil
+}
+
+func releaseVlc() error {
+	vlcMu.Lock()
+	defer vlcMu.Unlock()
+
+	if vlcUsers--; vlcUsers > 0 {
+		return nil
+	}
+
+	return vlc.Release()
+}
+
+// marqueeParams sets up the marq sub source, which re-reads its text file
+// on every refresh, so the overlay can be updated without libvlc bindings.
+func marqueeParams(overlay *Overlay) ([]string, string, error) {
+	position, ok := marqueePositions[overlay.Position]
+	if !ok {
+		return nil, "", fmt.Errorf("Unknown overlay position %s", overlay.Position)
+	}
+
+	f, err := ioutil.TempFile("", "twitch-player-marquee-")
+	if err != nil {
+		return nil, "", err
+	}
+	f.Close()
+
+	params := []string{
+		"--sub-source=marq",
+		fmt.Sprintf("--marq-file=%s", f.Name()),
+		fmt.Sprintf("--marq-position=%d", position),
+		"--marq-refresh=250",
+		"--marq-x=10",
+		"--marq-y=10",
+	}
+	if overlay.Size > 0 {
+		params = append(params, fmt.Sprintf("--marq-size=%d", overlay.Size))
+	}
+	if overlay.Opacity > 0 {
+		params = append(params, fmt.Sprintf("--marq-opacity=%d", overlay.Opacity))
+	}
+
+	return params, f.Name(), nil
+}
+
 func (p *vlcPlayer) Reset() (res error) {
 	if p.player.IsPlaying() {
 		if err := p.player.Stop(); err != nil {
@@ -58,9 +166,12 @@ func (p *vlcPlayer) Close() (res error) {
 	if err := p.player.Release(); err != nil {
 		res = err
 	}
-	if err := vlc.Release(); err != nil {
+	if err := releaseVlc(); err != nil {
 		res = err
 	}
+	if p.marqueeFile != "" {
+		os.Remove(p.marqueeFile)
+	}
 
 	return res
 }
@@ -95,6 +206,22 @@ func (p *vlcPlayer) Play() error {
 	return p.player.Play()
 }
 
+func (p *vlcPlayer) Pause() error {
+	if p.loadedMedia == nil {
+		return fmt.Errorf("Cannot pause: No media loaded")
+	}
+
+	return p.player.SetPause(true)
+}
+
+func (p *vlcPlayer) Resume() error {
+	if p.loadedMedia == nil {
+		return fmt.Errorf("Cannot resume: No media loaded")
+	}
+
+	return p.player.SetPause(false)
+}
+
 func (p *vlcPlayer) Stop() error {
 	if !p.player.IsPlaying() {
 		return fmt.Errorf("Cannot stop: No media playing")
@@ -103,6 +230,118 @@ func (p *vlcPlayer) Stop() error {
 	return p.player.Stop()
 }
 
+// Seek waits for playback to start, since libvlc ignores seeks while opening.
+func (p *vlcPlayer) Seek(offset time.Duration) error {
+	if p.loadedMedia == nil {
+		return fmt.Errorf("Cannot seek: No media loaded")
+	}
+
+	for deadline := time.Now().Add(15 * time.Second); !p.player.IsPlaying(); {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Cannot seek: Media did not start playing")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return p.player.SetMediaTime(int(offset / time.Millisecond))
+}
+
+func (p *vlcPlayer) Position() (time.Duration, error) {
+	if p.loadedMedia == nil {
+		return 0, fmt.Errorf("Cannot get position: No media loaded")
+	}
+
+	ms, err := p.player.MediaTime()
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+func (p *vlcPlayer) Length() (time.Duration, error) {
+	if p.loadedMedia == nil {
+		return 0, fmt.Errorf("Cannot get length: No media loaded")
+	}
+
+	ms, err := p.player.MediaLength()
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+func (p *vlcPlayer) State() (State, error) {
+	if p.loadedMedia == nil {
+		return StateIdle, nil
+	}
+
+	state, err := p.player.MediaState()
+	if err != nil {
+		return StateError, err
+	}
+
+	return vlcStates[state], nil
+}
+
+// Volume reports the volume to restore while muted.
+func (p *vlcPlayer) Volume() (int, error) {
+	if p.muted {
+		return p.volume, nil
+	}
+
+	return p.player.Volume()
+}
+
+func (p *vlcPlayer) SetVolume(volume int) error {
+	if volume < 0 || volume > MaxVolume {
+		return fmt.Errorf("Cannot set volume: %d is not between 0 and %d", volume, MaxVolume)
+	}
+	if p.muted {
+		p.volume = volume
+		return nil
+	}
+
+	return p.player.SetVolume(volume)
+}
+
+// SetMute remembers the volume, as libvlc reports -1 while nothing plays.
+func (p *vlcPlayer) SetMute(mute bool) error {
+	if mute == p.muted {
+		return nil
+	}
+
+	if mute {
+		volume, err := p.player.Volume()
+		if err != nil {
+			return err
+		}
+		if volume < 0 {
+			volume = 100
+		}
+		if err := p.player.SetVolume(0); err != nil {
+			return err
+		}
+		p.volume = volume
+	} else {
+		if err := p.player.SetVolume(p.volume); err != nil {
+			return err
+		}
+	}
+	p.muted = mute
+
+	return nil
+}
+
+func (p *vlcPlayer) IsMuted() (bool, error) {
+	return p.muted, nil
+}
+
+func (p *vlcPlayer) IsFullscreen() (bool, error) {
+	return p.player.IsFullScreen()
+}
+
 func (p *vlcPlayer) EnterFullscreen() error {
 	if fs, err := p.player.IsFullScreen(); err != nil {
 		return fmt.Errorf("Cannot enter fullscreen: %s", err.Error())
@@ -122,3 +361,25 @@ func (p *vlcPlayer) ExitFullscreen() error {
 
 	return p.player.ToggleFullScreen()
 }
+
+func (p *vlcPlayer) SetOverlayText(text string) error {
+	if p.marqueeFile == "" {
+		return fmt.Errorf("Cannot set overlay: Overlay not enabled")
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(p.marqueeFile), filepath.Base(p.marqueeFile)+".")
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(text); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), p.marqueeFile)
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli"
+
+	"github.com/hchagen/twitch-player/chat"
+	"github.com/hchagen/twitch-player/hls"
+	"github.com/hchagen/twitch-player/recorder"
+	"github.com/hchagen/twitch-player/twitch"
+)
+
+var recordFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "quality,q",
+		Usage: "Quality to record, e.g. chunked or 720p60 (prompts if empty)",
+	},
+	cli.StringFlag{
+		Name:  "ads",
+		Usage: "What to do with stitched ad breaks: keep, skip or hold (replace with --ad-slate)",
+		Value: hls.AdModeKeep,
+	},
+	cli.StringFlag{
+		Name:  "ad-slate",
+		Usage: "MPEG-TS segment to show instead of ads in hold mode",
+	},
+	cli.DurationFlag{
+		Name:  "max-duration",
+		Usage: "Stop after this duration (0 for until the stream ends)",
+	},
+	lowLatencyFlag,
+	adaptiveFlag,
+	minQualityFlag,
+	maxQualityFlag,
+}
+
+func newAdFilter(ctx *cli.Context) (*hls.AdFilter, error) {
+	filter := &hls.AdFilter{
+		Mode: ctx.String("ads"),
+	}
+
+	switch filter.Mode {
+	case hls.AdModeKeep, hls.AdModeSkip:
+	case hls.AdModeHold:
+		if ctx.String("ad-slate") == "" {
+			return nil, fmt.Errorf("Hold mode requires an --ad-slate segment")
+		}
+		slate, err := ioutil.ReadFile(ctx.String("ad-slate"))
+		if err != nil {
+			return nil, err
+		}
+		filter.Slate = slate
+	default:
+		return nil, fmt.Errorf("Unknown ad mode %s (keep, skip or hold)", filter.Mode)
+	}
+
+	return filter, nil
+}
+
+func printAdEvent(ev hls.AdEvent) {
+	if ev.Start {
+		fmt.Fprintf(os.Stderr, "Ad break started at %s (%s planned)\n", ev.Time.Local().Format("15:04:05"), ev.Duration)
+	} else {
+		fmt.Fprintf(os.Stderr, "Ad break ended at %s after %s (%d segments)\n", ev.Time.Local().Format("15:04:05"), ev.Duration.Truncate(time.Second), ev.Segments)
+	}
+}
+
+// segmentWriter receives the segments of recordStream, after ad filtering.
+type segmentWriter interface {
+	WriteSegment(s *hls.SegmentData, data []byte) error
+	SetMetadata(title, game string)
+	Close() error
+}
+
+type pipeWriter struct {
+	io.Writer
+}
+
+func (w pipeWriter) WriteSegment(s *hls.SegmentData, data []byte) error {
+	_, err := w.Write(data)
+	return err
+}
+
+func (w pipeWriter) SetMetadata(title, game string) {}
+
+func (w pipeWriter) Close() error {
+	return nil
+}
+
+// watchStreamData sends the stream data every DefaultRefreshInterval until
+// done closes.
+func watchStreamData(stream twitch.Stream, done <-chan struct{}) <-chan twitch.Stream {
+	updates := make(chan twitch.Stream)
+	go func() {
+		ticker := time.NewTicker(DefaultRefreshInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			sd, err := twitchClient().GetStreamData(stream.Channel.Id)
+			if err != nil || sd.Stream.Id == 0 {
+				continue
+			}
+			select {
+			case updates <- sd.Stream:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return updates
+}
+
+// recordStream writes fetched segments to the writer returned by open until
+// the stream ends, the max duration passes or the process is signalled,
+// printing progress to out.
+func recordStream(ctx *cli.Context, out io.Writer, channelName string, open func(twitch.Stream, twitch.StreamUrl) (segmentWriter, error)) error {
+	filter, err := newAdFilter(ctx)
+	if err != nil {
+		return err
+	}
+
+	stream, uri, err := selectLiveStream(out, channelName, ctx.String("quality"))
+	if err != nil {
+		return err
+	}
+
+	w, err := open(stream, uri)
+	if err != nil {
+		return err
+	}
+
+	fetcher, err := newLiveFetcher(ctx, stream, uri, out)
+	if err != nil {
+		w.Close()
+		return err
+	}
+	fetcher.OnAd = printAdEvent
+	if err := fetcher.Start(); err != nil {
+		w.Close()
+		return err
+	}
+	defer fetcher.Close()
+
+	fmt.Fprintf(out, "Recording %s %s (%s)...\n", stream.Channel.Name, uri.Resolution, uri.Quality)
+
+	stop := make(chan struct{})
+	go func() {
+		waitForSignal()
+		close(stop)
+	}()
+	done := make(chan struct{})
+	defer close(done)
+	updates := watchStreamData(stream, done)
+
+	var deadline <-chan time.Time
+	if d := ctx.Duration("max-duration"); d > 0 {
+		deadline = time.After(d)
+	}
+
+	var written int64
+	for {
+		select {
+		case s, ok := <-fetcher.Segments():
+			if !ok {
+				fmt.Fprintf(out, "Stream ended after %d MiB\n", written>>20)
+				if err := fetcher.Err(); err != nil {
+					w.Close()
+					return err
+				}
+				return w.Close()
+			}
+			data := filter.Filter(s)
+			if err := w.WriteSegment(s, data); err != nil {
+				w.Close()
+				return err
+			}
+			written += int64(len(data))
+		case s := <-updates:
+			w.SetMetadata(s.Channel.Status, s.Game)
+		case <-deadline:
+			fmt.Fprintf(out, "Reached max duration after %d MiB\n", written>>20)
+			return w.Close()
+		case <-stop:
+			return w.Close()
+		}
+	}
+}
+
+func onRecord(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("Please provide a channel name")
+	}
+
+	var splitSize recorder.Size
+	if s := ctx.String("split-size"); s != "" {
+		size, err := recorder.ParseSize(s)
+		if err != nil {
+			return err
+		}
+		splitSize = size
+	}
+	splitDuration := ctx.Duration("split-duration")
+	if err := checkRemuxFlag(ctx); err != nil {
+		return err
+	}
+
+	template := ctx.String("output")
+	if template == "" {
+		template = recorder.DefaultOutput
+	}
+	if splitDuration > 0 || splitSize > 0 {
+		template = recorder.PartTemplate(template)
+	}
+
+	// parts are converted while the next one is recorded
+	var converting sync.WaitGroup
+	defer converting.Wait()
+
+	var capture *chatCapture
+	defer func() {
+		if capture != nil {
+			capture.Close()
+		}
+	}()
+
+	return recordStream(ctx, os.Stdout, ctx.Args()[0], func(stream twitch.Stream, uri twitch.StreamUrl) (segmentWriter, error) {
+		if ctx.Bool("chat-replay") {
+			c, err := startChatCapture(stream.Channel.Name)
+			if err != nil {
+				return nil, err
+			}
+			capture = c
+		}
+
+		w := recorder.NewPartWriter(recorder.Part{
+			Channel:  stream.Channel.Name,
+			StreamId: stream.Id,
+			Quality:  uri.Quality,
+			Title:    stream.Channel.Status,
+			Game:     stream.Game,
+		}, func(number int, started time.Time, title string) string {
+			s := stream
+			s.Channel.Status = title
+			return recorder.Filename(template, s, started, number)
+		}, splitDuration, splitSize)
+		w.OnPart = func(p recorder.Part) {
+			fmt.Printf("Saved %s (%s, %s)\n", p.Path, p.Duration.Truncate(time.Second), recorder.Size(p.Size))
+
+			var replay *chat.Replay
+			if capture != nil {
+				replay = capture.Replay(p)
+				if err := saveChatReplay(ctx, replay, p.Path); err != nil {
+					fmt.Println(err.Error())
+				}
+			}
+			if ctx.String("remux") == "" {
+				return
+			}
+
+			converting.Add(1)
+			go func() {
+				defer converting.Done()
+				if out, err := remuxRecording(ctx, p.Path, replay); err != nil {
+					fmt.Println(err.Error())
+				} else {
+					fmt.Printf("Converted to %s\n", out)
+				}
+			}()
+		}
+
+		return w, nil
+	})
+}
+
+// onPipe writes the stream to stdout, so everything else is printed to stderr.
+func onPipe(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("Please provide a channel name")
+	}
+
+	return recordStream(ctx, os.Stderr, ctx.Args()[0], func(twitch.Stream, twitch.StreamUrl) (segmentWriter, error) {
+		return pipeWriter{os.Stdout}, nil
+	})
+}
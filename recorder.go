@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli"
+
+	"github.com/hchagen/twitch-player/recorder"
+)
+
+func onRecorder(ctx *cli.Context) error {
+	config, err := recorder.LoadConfig(ctx.String("rules"))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Watching %d rules every %s, recording to %s\n", len(config.Rules), config.Interval, config.OutputDir)
+
+	return recorder.NewRecorder(config, twitchClient(), segmentHttpClient).Run(signalled())
+}
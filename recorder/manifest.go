@@ -0,0 +1,174 @@
+package recorder
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ReasonEnded       = "ended"
+	ReasonMaxDuration = "max-duration"
+	ReasonUnmatched   = "unmatched"
+	ReasonStopped     = "stopped"
+	ReasonFailed      = "failed"
+	ReasonSplit       = "split"
+)
+
+type Entry struct {
+	Channel  string        `json:"channel"`
+	StreamId uint64        `json:"stream_id"`
+	Game     string        `json:"game"`
+	Title    string        `json:"title"`
+	Quality  string        `json:"quality"`
+	Part     int           `json:"part,omitempty"`
+	Path     string        `json:"path"`
+	Size     int64         `json:"size"`
+	Started  time.Time     `json:"started"`
+	Ended    time.Time     `json:"ended"`
+	Duration time.Duration `json:"duration"`
+	Reason   string        `json:"reason"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Manifest lists completed recordings as JSON lines, so it is safe to append
+// to while other tools read it.
+type Manifest struct {
+	path string
+	mu   sync.Mutex
+}
+
+func OpenManifest(path string) *Manifest {
+	return &Manifest{path: path}
+}
+
+func (m *Manifest) Append(e Entry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(m.path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(m.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func (m *Manifest) Entries() ([]Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.read()
+}
+
+func (m *Manifest) read() ([]Entry, error) {
+	f, err := os.Open(m.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, scanner.Err()
+}
+
+// Prune deletes recordings of the channel, or of all channels if empty, that
+// ended longer than retention ago or that don't fit in quota bytes next to
+// newer ones, keeping at least the newest. Converted parts are found through
+// their sidecars, which go with them, and they are dropped from the manifest.
+// Zero retention or quota disables that limit.
+func (m *Manifest) Prune(channel string, retention time.Duration, quota Size) ([]Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries, err := m.read()
+	if err != nil {
+		return nil, err
+	}
+
+	expired := make([]bool, len(entries))
+	var total int64
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if channel != "" && !strings.EqualFold(e.Channel, channel) {
+			continue
+		}
+		total += e.Size
+		expired[i] = (retention > 0 && time.Since(e.Ended) >= retention) || (quota > 0 && total > int64(quota) && total > e.Size)
+	}
+
+	var kept, pruned []Entry
+	for i, e := range entries {
+		if !expired[i] {
+			kept = append(kept, e)
+			continue
+		}
+		path := partPath(e.Path)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			kept = append(kept, e)
+			continue
+		}
+		os.Remove(SidecarPath(path))
+		e.Path = path
+		pruned = append(pruned, e)
+	}
+	if len(pruned) == 0 {
+		return nil, nil
+	}
+
+	return pruned, m.write(kept)
+}
+
+func (m *Manifest) write(entries []Entry) error {
+	tmp := m.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	for _, e := range entries {
+		data, err := json.Marshal(e)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		w.Write(append(data, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, m.path)
+}
@@ -0,0 +1,130 @@
+package recorder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// record writes a part of size bytes with its sidecar and lists it in m.
+func record(t *testing.T, m *Manifest, dir, channel, name string, size int64, ended time.Time) Entry {
+	e := Entry{
+		Channel: channel,
+		Path:    filepath.Join(dir, name),
+		Size:    size,
+		Ended:   ended,
+	}
+	if err := ioutil.WriteFile(e.Path, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeSidecar(Part{Channel: channel, Path: e.Path, Size: size}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Append(e); err != nil {
+		t.Fatal(err)
+	}
+
+	return e
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestPrune(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name      string
+		channel   string
+		retention time.Duration
+		quota     Size
+		pruned    []string
+	}{
+		{name: "retention", retention: 36 * time.Hour, pruned: []string{"a1.ts"}},
+		{name: "quota", quota: 250, pruned: []string{"a1.ts", "b1.ts"}},
+		{name: "channel quota", channel: "a", quota: 150, pruned: []string{"a1.ts"}},
+		{name: "channel retention", channel: "b", retention: time.Hour, pruned: []string{"b1.ts"}},
+		{name: "keeps the newest", quota: 10, pruned: []string{"a1.ts", "b1.ts", "a2.ts"}},
+		{name: "disabled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			m := OpenManifest(filepath.Join(dir, DefaultManifest))
+			entries := []Entry{
+				record(t, m, dir, "a", "a1.ts", 100, now.Add(-48*time.Hour)),
+				record(t, m, dir, "b", "b1.ts", 100, now.Add(-24*time.Hour)),
+				record(t, m, dir, "a", "a2.ts", 100, now.Add(-2*time.Hour)),
+				record(t, m, dir, "b", "b2.ts", 100, now),
+			}
+
+			pruned, err := m.Prune(tt.channel, tt.retention, tt.quota)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, e := range pruned {
+				names = append(names, filepath.Base(e.Path))
+			}
+			if len(names) != len(tt.pruned) {
+				t.Fatalf("Pruned %q, want %q", names, tt.pruned)
+			}
+			for i := range names {
+				if names[i] != tt.pruned[i] {
+					t.Errorf("Pruned %q, want %q", names, tt.pruned)
+				}
+			}
+
+			kept, err := m.Entries()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(kept)+len(pruned) != len(entries) {
+				t.Errorf("Manifest lists %d entries after pruning %d of %d", len(kept), len(pruned), len(entries))
+			}
+			for _, e := range pruned {
+				if exists(e.Path) || exists(SidecarPath(e.Path)) {
+					t.Errorf("%s or its sidecar is still on disk", e.Path)
+				}
+			}
+			for _, e := range kept {
+				if !exists(e.Path) {
+					t.Errorf("%s was deleted but is still listed", e.Path)
+				}
+			}
+		})
+	}
+}
+
+func TestPruneConverted(t *testing.T) {
+	dir := t.TempDir()
+	m := OpenManifest(filepath.Join(dir, DefaultManifest))
+	old := record(t, m, dir, "a", "a1.ts", 100, time.Now().Add(-48*time.Hour))
+	record(t, m, dir, "a", "a2.ts", 100, time.Now())
+
+	mp4 := filepath.Join(dir, "a1.mp4")
+	if err := ioutil.WriteFile(mp4, make([]byte, 90), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(old.Path); err != nil {
+		t.Fatal(err)
+	}
+	if err := MovePart(old.Path, mp4); err != nil {
+		t.Fatal(err)
+	}
+
+	pruned, err := m.Prune("", time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 1 || pruned[0].Path != mp4 {
+		t.Fatalf("Pruned %+v, want the converted part", pruned)
+	}
+	if exists(mp4) || exists(SidecarPath(mp4)) {
+		t.Error("Converted part or its sidecar is still on disk")
+	}
+}
@@ -0,0 +1,359 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hchagen/twitch-player/hls"
+)
+
+// Size is a byte count written like 500MiB, 4GB or 2G in rule files.
+type Size int64
+
+func ParseSize(s string) (Size, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		i = len(s)
+	}
+
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid size %s", s)
+	}
+
+	units := map[string]float64{
+		"": 1, "b": 1,
+		"k": 1 << 10, "kb": 1e3, "kib": 1 << 10,
+		"m": 1 << 20, "mb": 1e6, "mib": 1 << 20,
+		"g": 1 << 30, "gb": 1e9, "gib": 1 << 30,
+		"t": 1 << 40, "tb": 1e12, "tib": 1 << 40,
+	}
+	unit, ok := units[strings.ToLower(strings.TrimSpace(s[i:]))]
+	if !ok {
+		return 0, fmt.Errorf("Invalid size unit in %s", s)
+	}
+
+	return Size(n * unit), nil
+}
+
+func (s *Size) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var str string
+	if err := unmarshal(&str); err != nil {
+		return err
+	}
+
+	size, err := ParseSize(str)
+	if err != nil {
+		return err
+	}
+	*s = size
+
+	return nil
+}
+
+func (s Size) String() string {
+	switch {
+	case s >= 1<<30:
+		return fmt.Sprintf("%.1f GiB", float64(s)/(1<<30))
+	case s >= 1<<20:
+		return fmt.Sprintf("%d MiB", s>>20)
+	case s >= 1<<10:
+		return fmt.Sprintf("%d KiB", s>>10)
+	}
+
+	return fmt.Sprintf("%d B", s)
+}
+
+// Change is a title or game change while a part was recorded.
+type Change struct {
+	Time   time.Time     `json:"time"`
+	Offset time.Duration `json:"offset"`
+	Title  string        `json:"title"`
+	Game   string        `json:"game"`
+}
+
+// Span is a stretch of the broadcast left out of a part, such as a skipped ad
+// break, cut at Offset into the part.
+type Span struct {
+	Offset   time.Duration `json:"offset"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Part is written as a JSON sidecar next to every part file.
+type Part struct {
+	Channel  string        `json:"channel"`
+	StreamId uint64        `json:"stream_id"`
+	Quality  string        `json:"quality"`
+	Number   int           `json:"part"`
+	Path     string        `json:"path"`
+	Size     int64         `json:"size"`
+	Started  time.Time     `json:"started"`
+	Ended    time.Time     `json:"ended"`
+	Duration time.Duration `json:"duration"`
+	// ProgramDateTime is the broadcast time of the first segment.
+	ProgramDateTime time.Time `json:"program_date_time,omitempty"`
+	Title           string    `json:"title"`
+	Game            string    `json:"game"`
+	Changes         []Change  `json:"changes,omitempty"`
+	Skipped         []Span    `json:"skipped,omitempty"`
+}
+
+// BroadcastDuration is how much of the broadcast the part covers, including
+// what was skipped.
+func (p Part) BroadcastDuration() time.Duration {
+	d := p.Duration
+	for _, s := range p.Skipped {
+		d += s.Duration
+	}
+
+	return d
+}
+
+// PartOffset maps an offset into the broadcast since the part started to one
+// into the part. It returns false for offsets within a skipped span.
+func (p Part) PartOffset(broadcast time.Duration) (time.Duration, bool) {
+	var skipped time.Duration
+	for _, s := range p.Skipped {
+		start := s.Offset + skipped
+		if broadcast < start {
+			break
+		}
+		if broadcast < start+s.Duration {
+			return 0, false
+		}
+		skipped += s.Duration
+	}
+
+	return broadcast - skipped, true
+}
+
+// SidecarPath returns the JSON sidecar path of a part file.
+func SidecarPath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".json"
+}
+
+// partPath returns where the part at path lives now according to its
+// sidecar, which MovePart updates after a conversion, or path itself.
+func partPath(path string) string {
+	data, err := ioutil.ReadFile(SidecarPath(path))
+	if err != nil {
+		return path
+	}
+
+	var p Part
+	if err := json.Unmarshal(data, &p); err != nil || p.Path == "" {
+		return path
+	}
+
+	return p.Path
+}
+
+// PartWriter writes segments to numbered part files, starting the next part
+// on a segment boundary once the current one reaches the split duration or
+// size. A zero limit never splits on it.
+type PartWriter struct {
+	// OnPart is called after a part and its sidecar are complete.
+	OnPart func(Part)
+
+	name          func(number int, started time.Time, title string) string
+	splitDuration time.Duration
+	splitSize     int64
+
+	info  Part
+	title string
+	game  string
+	f     *os.File
+}
+
+// NewPartWriter names parts with name, which should make every part number
+// unique. Channel, StreamId and Quality of info are copied to every part.
+func NewPartWriter(info Part, name func(number int, started time.Time, title string) string, splitDuration time.Duration, splitSize Size) *PartWriter {
+	return &PartWriter{
+		name:          name,
+		splitDuration: splitDuration,
+		splitSize:     int64(splitSize),
+		info:          info,
+		title:         info.Title,
+		game:          info.Game,
+	}
+}
+
+// SetMetadata records a title or game change in the current part.
+func (w *PartWriter) SetMetadata(title, game string) {
+	if title == w.title && game == w.game {
+		return
+	}
+	w.title, w.game = title, game
+
+	if w.f != nil {
+		w.info.Changes = append(w.info.Changes, Change{
+			Time:   time.Now(),
+			Offset: w.info.Duration,
+			Title:  title,
+			Game:   game,
+		})
+	}
+}
+
+// WriteSegment writes data, the possibly filtered contents of s. Empty data
+// is recorded as a skipped span instead.
+func (w *PartWriter) WriteSegment(s *hls.SegmentData, data []byte) error {
+	if len(data) == 0 {
+		w.skip(s.Duration)
+		return nil
+	}
+	if w.f != nil && ((w.splitDuration > 0 && w.info.Duration >= w.splitDuration) || (w.splitSize > 0 && w.info.Size+int64(len(data)) > w.splitSize)) {
+		if err := w.finish(); err != nil {
+			return err
+		}
+	}
+	if w.f == nil {
+		if err := w.next(); err != nil {
+			return err
+		}
+	}
+
+	if w.info.Duration == 0 {
+		w.info.ProgramDateTime = s.ProgramDateTime
+	}
+	n, err := w.f.Write(data)
+	w.info.Size += int64(n)
+	w.info.Duration += s.Duration
+
+	return err
+}
+
+// skip extends the span at the end of the part. Nothing written yet means
+// nothing to skip, since the part starts at its first written segment.
+func (w *PartWriter) skip(d time.Duration) {
+	if w.f == nil || w.info.Duration == 0 {
+		return
+	}
+
+	if n := len(w.info.Skipped); n > 0 && w.info.Skipped[n-1].Offset == w.info.Duration {
+		w.info.Skipped[n-1].Duration += d
+		return
+	}
+	w.info.Skipped = append(w.info.Skipped, Span{Offset: w.info.Duration, Duration: d})
+}
+
+// Part returns the part being written.
+func (w *PartWriter) Part() Part {
+	return w.info
+}
+
+// Close completes the current part.
+func (w *PartWriter) Close() error {
+	if w.f == nil {
+		return nil
+	}
+
+	return w.finish()
+}
+
+func (w *PartWriter) next() error {
+	started := time.Now()
+	path := w.name(w.info.Number+1, started, w.title)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, path, err := createUnique(path)
+	if err != nil {
+		return err
+	}
+
+	w.f = f
+	w.info.Number++
+	w.info.Path = path
+	w.info.Size = 0
+	w.info.Started = started
+	w.info.Duration = 0
+	w.info.ProgramDateTime = time.Time{}
+	w.info.Title = w.title
+	w.info.Game = w.game
+	w.info.Changes = nil
+	w.info.Skipped = nil
+
+	return nil
+}
+
+// createUnique never overwrites an earlier recording, which templates without
+// {time} would otherwise name the same, and appends _1, _2... instead. A
+// sidecar also claims the name, since remuxing removes the .ts next to it.
+func createUnique(path string) (*os.File, string, error) {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+
+	for i := 1; ; i++ {
+		if _, err := os.Stat(SidecarPath(path)); os.IsNotExist(err) {
+			f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+			if !os.IsExist(err) {
+				return f, path, err
+			}
+		}
+		path = fmt.Sprintf("%s_%d%s", base, i, ext)
+	}
+}
+
+// MovePart points the sidecar of a part at its new path, e.g. after the part
+// was converted and the original removed. Files without a sidecar are left
+// alone.
+func MovePart(path, newPath string) error {
+	data, err := ioutil.ReadFile(SidecarPath(path))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var p Part
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	p.Path = newPath
+	if fi, err := os.Stat(newPath); err == nil {
+		p.Size = fi.Size()
+	}
+	if err := writeSidecar(p); err != nil {
+		return err
+	}
+	if SidecarPath(newPath) != SidecarPath(path) {
+		return os.Remove(SidecarPath(path))
+	}
+
+	return nil
+}
+
+func writeSidecar(p Part) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(SidecarPath(p.Path), data, 0644)
+}
+
+func (w *PartWriter) finish() error {
+	err := w.f.Close()
+	w.f = nil
+	w.info.Ended = time.Now()
+
+	if jerr := writeSidecar(w.info); err == nil {
+		err = jerr
+	}
+
+	if w.OnPart != nil {
+		w.OnPart(w.info)
+	}
+
+	return err
+}
@@ -0,0 +1,230 @@
+package recorder
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hchagen/twitch-player/hls"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Size
+		err  bool
+	}{
+		{s: "0", want: 0},
+		{s: "512", want: 512},
+		{s: "100B", want: 100},
+		{s: "2k", want: 2 << 10},
+		{s: "500MiB", want: 500 << 20},
+		{s: "500MB", want: 500e6},
+		{s: "4G", want: 4 << 30},
+		{s: "4 GiB", want: 4 << 30},
+		{s: "1.5gb", want: 1.5e9},
+		{s: " 2TiB ", want: 2 << 40},
+		{s: "", err: true},
+		{s: "GiB", err: true},
+		{s: "4PB", err: true},
+		{s: "1.2.3G", err: true},
+	}
+
+	for _, tt := range tests {
+		size, err := ParseSize(tt.s)
+		if tt.err {
+			if err == nil {
+				t.Errorf("ParseSize(%q) is %d, want an error", tt.s, size)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseSize(%q): %s", tt.s, err)
+		} else if size != tt.want {
+			t.Errorf("ParseSize(%q) is %d, want %d", tt.s, size, tt.want)
+		}
+	}
+}
+
+func TestSizeString(t *testing.T) {
+	tests := []struct {
+		size Size
+		want string
+	}{
+		{512, "512 B"},
+		{2 << 10, "2 KiB"},
+		{500 << 20, "500 MiB"},
+		{3 << 29, "1.5 GiB"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.size.String(); got != tt.want {
+			t.Errorf("Size %d is %q, want %q", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestCreateUnique(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "channel_2024-03-09.ts")
+
+	var names []string
+	for i := 0; i < 3; i++ {
+		f, name, err := createUnique(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		names = append(names, filepath.Base(name))
+	}
+	want := []string{"channel_2024-03-09.ts", "channel_2024-03-09_1.ts", "channel_2024-03-09_2.ts"}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Errorf("Part %d is named %q, want %q", i, names[i], want[i])
+		}
+	}
+
+	// a converted part leaves only its sidecar behind
+	converted := filepath.Join(dir, "converted.ts")
+	if err := ioutil.WriteFile(SidecarPath(converted), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, name, err := createUnique(converted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if filepath.Base(name) != "converted_1.ts" {
+		t.Errorf("Part next to a sidecar is named %q, want %q", filepath.Base(name), "converted_1.ts")
+	}
+}
+
+func TestPartOffset(t *testing.T) {
+	p := Part{
+		Duration: 60 * time.Second,
+		Skipped: []Span{
+			{Offset: 10 * time.Second, Duration: 30 * time.Second},
+			{Offset: 20 * time.Second, Duration: 5 * time.Second},
+		},
+	}
+	if d := p.BroadcastDuration(); d != 95*time.Second {
+		t.Errorf("Broadcast duration is %s, want 1m35s", d)
+	}
+
+	tests := []struct {
+		broadcast time.Duration
+		want      time.Duration
+		ok        bool
+	}{
+		{5 * time.Second, 5 * time.Second, true},
+		{10 * time.Second, 0, false},
+		{39 * time.Second, 0, false},
+		{40 * time.Second, 10 * time.Second, true},
+		{52 * time.Second, 0, false},
+		{60 * time.Second, 25 * time.Second, true},
+	}
+
+	for _, tt := range tests {
+		offset, ok := p.PartOffset(tt.broadcast)
+		if ok != tt.ok || ok && offset != tt.want {
+			t.Errorf("PartOffset(%s) is %s, %v, want %s, %v", tt.broadcast, offset, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func segment(d time.Duration) *hls.SegmentData {
+	return &hls.SegmentData{Segment: hls.Segment{Duration: d}}
+}
+
+func TestPartWriter(t *testing.T) {
+	dir := t.TempDir()
+	var parts []Part
+	template := filepath.Join(dir, PartTemplate("{channel}.ts"))
+	w := NewPartWriter(Part{Channel: "somechannel", Title: "Day 1"}, func(number int, started time.Time, title string) string {
+		return Filename(template, twitchStream("somechannel", "", title), started, number)
+	}, 0, 10)
+	w.OnPart = func(p Part) {
+		parts = append(parts, p)
+	}
+
+	for _, data := range []string{"aaaa", "bbbb", "", "cccc", "dd"} {
+		if err := w.WriteSegment(segment(2*time.Second), []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+		if data == "bbbb" {
+			w.SetMetadata("Day 2", "")
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(parts) != 2 {
+		t.Fatalf("Got %d parts, want a split at 10 bytes", len(parts))
+	}
+	first, second := parts[0], parts[1]
+	if first.Number != 1 || first.Size != 8 || first.Duration != 4*time.Second {
+		t.Errorf("First part is %+v", first)
+	}
+	if len(first.Skipped) != 1 || first.Skipped[0] != (Span{Offset: 4 * time.Second, Duration: 2 * time.Second}) {
+		t.Errorf("First part skipped %+v, want the empty segment", first.Skipped)
+	}
+	if len(first.Changes) != 1 || first.Changes[0].Title != "Day 2" || first.Changes[0].Offset != 4*time.Second {
+		t.Errorf("First part changes are %+v", first.Changes)
+	}
+	if second.Number != 2 || second.Size != 6 || second.Title != "Day 2" || filepath.Base(second.Path) != "somechannel_002.ts" {
+		t.Errorf("Second part is %+v", second)
+	}
+
+	data, err := ioutil.ReadFile(SidecarPath(second.Path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sidecar Part
+	if err := json.Unmarshal(data, &sidecar); err != nil {
+		t.Fatal(err)
+	}
+	if sidecar.Path != second.Path || sidecar.Size != second.Size {
+		t.Errorf("Sidecar is %+v, want %+v", sidecar, second)
+	}
+}
+
+func TestMovePart(t *testing.T) {
+	dir := t.TempDir()
+	ts := filepath.Join(dir, "part.ts")
+	mp4 := filepath.Join(dir, "part.mp4")
+	if err := writeSidecar(Part{Path: ts, Size: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(mp4, make([]byte, 90), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := MovePart(ts, mp4); err != nil {
+		t.Fatal(err)
+	}
+	if path := partPath(ts); path != mp4 {
+		t.Errorf("Sidecar names %q, want %q", path, mp4)
+	}
+	data, err := ioutil.ReadFile(SidecarPath(mp4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p Part
+	if err := json.Unmarshal(data, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Size != 90 {
+		t.Errorf("Size is %d, want the converted size 90", p.Size)
+	}
+
+	if err := MovePart(filepath.Join(dir, "other.ts"), filepath.Join(dir, "other.mp4")); err != nil {
+		t.Errorf("Moving a part without a sidecar: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "other.json")); !os.IsNotExist(err) {
+		t.Error("Moving a part without a sidecar created one")
+	}
+}
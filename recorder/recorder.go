@@ -0,0 +1,338 @@
+package recorder
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hchagen/twitch-player/hls"
+	"github.com/hchagen/twitch-player/twitch"
+)
+
+// Recorder polls the channels of its rules and records live streams matching
+// one, until the stream ends, stops matching or reaches the rule's max duration.
+type Recorder struct {
+	// Log receives one line per started, finished or failed recording.
+	Log io.Writer
+
+	config   *Config
+	client   twitch.Client
+	http     *http.Client
+	manifest *Manifest
+
+	channelIds map[string]uint64
+	active     map[string]*recording
+	// finished keeps the stream per channel cut off at max duration, so it is
+	// not recorded again right away.
+	finished map[string]uint64
+
+	wg sync.WaitGroup
+}
+
+type recording struct {
+	rule    *Rule
+	stream  twitch.Stream
+	quality string
+	parts   *PartWriter
+
+	updates chan twitch.Stream
+	stop    chan string
+	done    chan struct{}
+	reason  string
+	err     error
+}
+
+func NewRecorder(config *Config, client twitch.Client, segmentClient *http.Client) *Recorder {
+	manifest := config.Manifest
+	if !filepath.IsAbs(manifest) {
+		manifest = filepath.Join(config.OutputDir, manifest)
+	}
+
+	return &Recorder{
+		Log:        os.Stdout,
+		config:     config,
+		client:     client,
+		http:       segmentClient,
+		manifest:   OpenManifest(manifest),
+		channelIds: make(map[string]uint64),
+		active:     make(map[string]*recording),
+		finished:   make(map[string]uint64),
+	}
+}
+
+// Run polls until done is closed, then stops and finishes all recordings.
+func (r *Recorder) Run(done <-chan struct{}) error {
+	ticker := time.NewTicker(r.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		r.poll()
+
+		select {
+		case <-done:
+			for _, rec := range r.active {
+				rec.stop <- ReasonStopped
+			}
+			r.wg.Wait()
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Recorder) logf(format string, args ...interface{}) {
+	fmt.Fprintf(r.Log, "%s %s\n", time.Now().Format("2006-01-02 15:04:05"), fmt.Sprintf(format, args...))
+}
+
+func (r *Recorder) poll() {
+	for channel, rec := range r.active {
+		select {
+		case <-rec.done:
+			if rec.reason == ReasonMaxDuration {
+				r.finished[channel] = rec.stream.Id
+			}
+			delete(r.active, channel)
+		default:
+		}
+	}
+
+	checked := make(map[string]bool)
+	for _, rule := range r.config.Rules {
+		if checked[rule.Channel] {
+			continue
+		}
+		checked[rule.Channel] = true
+
+		stream, err := r.liveStream(rule.Channel)
+		if err != nil {
+			r.logf("Checking %s: %s", rule.Channel, err.Error())
+			continue
+		}
+
+		rec := r.active[rule.Channel]
+		match := r.match(stream)
+		switch {
+		case rec != nil && (match == nil || stream.Id != rec.stream.Id):
+			rec.stop <- ReasonUnmatched
+			<-rec.done
+			delete(r.active, rule.Channel)
+		case rec != nil:
+			select {
+			case <-rec.updates:
+			default:
+			}
+			rec.updates <- stream
+		case rec == nil && match != nil && r.finished[rule.Channel] != stream.Id:
+			if err := r.start(match, stream); err != nil {
+				r.logf("Recording %s: %s", rule.Channel, err.Error())
+			}
+		}
+	}
+}
+
+// match returns the first rule matching the stream, if it is live.
+func (r *Recorder) match(stream twitch.Stream) *Rule {
+	if stream.Id == 0 {
+		return nil
+	}
+	for _, rule := range r.config.Rules {
+		if rule.Match(stream) {
+			return rule
+		}
+	}
+
+	return nil
+}
+
+func (r *Recorder) liveStream(channel string) (twitch.Stream, error) {
+	id, ok := r.channelIds[channel]
+	if !ok {
+		sr, err := r.client.GetChannelSearch(channel, 10)
+		if err != nil {
+			return twitch.Stream{}, err
+		}
+		for _, c := range sr.Channels {
+			if strings.EqualFold(c.Name, channel) {
+				id = c.Id
+			}
+		}
+		if id == 0 {
+			return twitch.Stream{}, fmt.Errorf("No channel named %s", channel)
+		}
+		r.channelIds[channel] = id
+	}
+
+	sd, err := r.client.GetStreamData(id)
+	if err != nil {
+		return twitch.Stream{}, err
+	}
+
+	return sd.Stream, nil
+}
+
+// variant picks the rule quality if available, or else the best one.
+func (r *Recorder) variant(rule *Rule, channel string) (twitch.StreamUrl, error) {
+	uris, err := r.client.GetStreamUrls(channel)
+	if err != nil {
+		return twitch.StreamUrl{}, err
+	}
+
+	var best twitch.StreamUrl
+	for _, uri := range uris {
+		if rule.Quality != "" && (strings.EqualFold(uri.Quality, rule.Quality) || strings.EqualFold(uri.Resolution, rule.Quality)) {
+			return uri, nil
+		}
+		if uri.Bandwidth > best.Bandwidth {
+			best = uri
+		}
+	}
+	if best.URI == "" {
+		return best, fmt.Errorf("No qualities available")
+	}
+
+	return best, nil
+}
+
+func (r *Recorder) start(rule *Rule, stream twitch.Stream) error {
+	uri, err := r.variant(rule, stream.Channel.Name)
+	if err != nil {
+		return err
+	}
+
+	channel := stream.Channel.Name
+	quality := uri.Quality
+	fetcher := hls.NewLiveFetcher(r.http, func() (string, error) {
+		uri, err := r.variant(&Rule{Quality: quality}, channel)
+		return uri.URI, err
+	})
+	if err := fetcher.Start(); err != nil {
+		return err
+	}
+
+	rec := &recording{
+		rule:    rule,
+		stream:  stream,
+		quality: quality,
+		updates: make(chan twitch.Stream, 1),
+		stop:    make(chan string, 1),
+		done:    make(chan struct{}),
+	}
+	rec.parts = NewPartWriter(Part{
+		Channel:  channel,
+		StreamId: stream.Id,
+		Quality:  quality,
+		Title:    stream.Channel.Status,
+		Game:     stream.Game,
+	}, func(number int, started time.Time, title string) string {
+		s := stream
+		s.Channel.Status = title
+		return filepath.Join(r.config.OutputDir, rule.Filename(s, started, number))
+	}, rule.SplitDuration, rule.SplitSize)
+	rec.parts.OnPart = func(p Part) {
+		r.finish(rec, p)
+	}
+	r.active[rule.Channel] = rec
+	delete(r.finished, rule.Channel)
+
+	r.logf("Recording %s (%s, %s)", channel, stream.Game, quality)
+
+	r.wg.Add(1)
+	go r.record(rec, fetcher)
+
+	return nil
+}
+
+func (r *Recorder) record(rec *recording, fetcher *hls.LiveFetcher) {
+	defer r.wg.Done()
+	defer close(rec.done)
+
+	var deadline <-chan time.Time
+	if rec.rule.MaxDuration > 0 {
+		deadline = time.After(rec.rule.MaxDuration)
+	}
+
+loop:
+	for {
+		select {
+		case s, ok := <-fetcher.Segments():
+			if !ok {
+				rec.reason, rec.err = ReasonEnded, fetcher.Err()
+				break loop
+			}
+			if err := rec.parts.WriteSegment(s, s.Data); err != nil {
+				rec.reason, rec.err = ReasonFailed, err
+				break loop
+			}
+		case stream := <-rec.updates:
+			rec.parts.SetMetadata(stream.Channel.Status, stream.Game)
+		case <-deadline:
+			rec.reason = ReasonMaxDuration
+			break loop
+		case rec.reason = <-rec.stop:
+			break loop
+		}
+	}
+	fetcher.Close()
+
+	if rec.parts.Part().Number == 0 {
+		r.logf("Recording %s ended without segments (%s)", rec.stream.Channel.Name, rec.reason)
+	}
+	if err := rec.parts.Close(); err != nil && rec.err == nil {
+		r.logf("Finishing %s: %s", rec.parts.Part().Path, err.Error())
+	}
+}
+
+// finish adds a completed part to the manifest, then applies the retention
+// and quota of its rule and the overall quota.
+func (r *Recorder) finish(rec *recording, p Part) {
+	reason := rec.reason
+	if reason == "" {
+		reason = ReasonSplit
+	}
+	e := Entry{
+		Channel:  p.Channel,
+		StreamId: p.StreamId,
+		Game:     p.Game,
+		Title:    p.Title,
+		Quality:  p.Quality,
+		Part:     p.Number,
+		Path:     p.Path,
+		Size:     p.Size,
+		Started:  p.Started,
+		Ended:    p.Ended,
+		Duration: p.Ended.Sub(p.Started),
+		Reason:   reason,
+	}
+	if rec.err != nil {
+		e.Error = rec.err.Error()
+		r.logf("Recording %s failed after %s: %s", e.Path, e.Duration.Truncate(time.Second), rec.err.Error())
+	} else {
+		r.logf("Finished %s after %s (%s, %s)", e.Path, e.Duration.Truncate(time.Second), e.Reason, Size(e.Size))
+	}
+
+	if err := r.manifest.Append(e); err != nil {
+		r.logf("Writing manifest: %s", err.Error())
+	}
+
+	r.prune(rec.rule.Channel, rec.rule.Retention, rec.rule.Quota)
+	r.prune("", 0, r.config.Quota)
+}
+
+func (r *Recorder) prune(channel string, retention time.Duration, quota Size) {
+	if retention <= 0 && quota <= 0 {
+		return
+	}
+
+	pruned, err := r.manifest.Prune(channel, retention, quota)
+	if err != nil {
+		r.logf("Pruning recordings: %s", err.Error())
+	}
+	for _, p := range pruned {
+		r.logf("Deleted %s (%s, ended %s)", p.Path, Size(p.Size), p.Ended.Local().Format("2006-01-02 15:04"))
+	}
+}
@@ -0,0 +1,177 @@
+package recorder
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/hchagen/twitch-player/twitch"
+)
+
+const (
+	DefaultInterval = time.Minute
+	DefaultOutput   = "{channel}_{date}_{time}.ts"
+	DefaultManifest = "recordings.jsonl"
+)
+
+// Config is read from a YAML rule file:
+//
+//	interval: 1m
+//	output_dir: /srv/recordings
+//	rules:
+//	  - channel: somechannel
+//	    game: "^Dota 2$"
+//	    title: "(?i)finals"
+//	    quality: 720p60
+//	    output: "{channel}/{date}_{title}.ts"
+//	    max_duration: 6h
+//	    split_duration: 1h
+//	    split_size: 4GiB
+//	    retention: 720h
+//	    quota: 200GiB
+//
+// The quota of a rule covers the parts of its channel, the top level quota
+// all recordings in the manifest.
+type Config struct {
+	Interval  time.Duration `yaml:"interval"`
+	OutputDir string        `yaml:"output_dir"`
+	Manifest  string        `yaml:"manifest"`
+	Quota     Size          `yaml:"quota"`
+	Rules     []*Rule       `yaml:"rules"`
+}
+
+type Rule struct {
+	Channel       string        `yaml:"channel"`
+	Game          string        `yaml:"game"`
+	Title         string        `yaml:"title"`
+	Quality       string        `yaml:"quality"`
+	Output        string        `yaml:"output"`
+	MaxDuration   time.Duration `yaml:"max_duration"`
+	SplitDuration time.Duration `yaml:"split_duration"`
+	SplitSize     Size          `yaml:"split_size"`
+	Retention     time.Duration `yaml:"retention"`
+	Quota         Size          `yaml:"quota"`
+
+	game  *regexp.Regexp
+	title *regexp.Regexp
+}
+
+// LoadConfig reads and validates a rule file, filling in defaults.
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var c Config
+	if err := yaml.UnmarshalStrict(data, &c); err != nil {
+		return nil, fmt.Errorf("Reading %s: %s", path, err.Error())
+	}
+
+	if c.Interval <= 0 {
+		c.Interval = DefaultInterval
+	}
+	if c.OutputDir == "" {
+		c.OutputDir = "."
+	}
+	if c.Manifest == "" {
+		c.Manifest = DefaultManifest
+	}
+	if len(c.Rules) == 0 {
+		return nil, fmt.Errorf("Reading %s: No rules", path)
+	}
+
+	for i, r := range c.Rules {
+		if err := r.compile(); err != nil {
+			return nil, fmt.Errorf("Reading %s: Rule %d: %s", path, i+1, err.Error())
+		}
+	}
+
+	return &c, nil
+}
+
+func (r *Rule) compile() (err error) {
+	if r.Channel == "" {
+		return fmt.Errorf("Missing channel")
+	}
+	r.Channel = strings.ToLower(r.Channel)
+	if r.Output == "" {
+		r.Output = DefaultOutput
+	}
+	if r.SplitDuration > 0 || r.SplitSize > 0 {
+		r.Output = PartTemplate(r.Output)
+	}
+
+	if r.Game != "" {
+		if r.game, err = regexp.Compile(r.Game); err != nil {
+			return err
+		}
+	}
+	if r.Title != "" {
+		if r.title, err = regexp.Compile(r.Title); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Match reports whether the live stream should be recorded.
+func (r *Rule) Match(stream twitch.Stream) bool {
+	if !strings.EqualFold(stream.Channel.Name, r.Channel) {
+		return false
+	}
+	if r.game != nil && !r.game.MatchString(stream.Game) {
+		return false
+	}
+	if r.title != nil && !r.title.MatchString(stream.Channel.Status) {
+		return false
+	}
+
+	return true
+}
+
+var unsafeFilenameChars = regexp.MustCompile(`[<>:"/\\|?*\x00-\x1f]+`)
+
+// PartTemplate adds the part number before the extension of an output
+// template without {part}, so split parts don't overwrite each other.
+func PartTemplate(template string) string {
+	if strings.Contains(template, "{part}") {
+		return template
+	}
+	ext := filepath.Ext(template)
+
+	return strings.TrimSuffix(template, ext) + "_{part}" + ext
+}
+
+// Filename expands the rule output template, see Filename.
+func (r *Rule) Filename(stream twitch.Stream, started time.Time, part int) string {
+	return Filename(r.Output, stream, started, part)
+}
+
+// Filename expands {channel}, {game}, {title}, {id}, {date}, {time} and
+// {part} in template, replacing characters not allowed in file names.
+func Filename(template string, stream twitch.Stream, started time.Time, part int) string {
+	clean := func(s string) string {
+		s = strings.TrimSpace(unsafeFilenameChars.ReplaceAllString(s, "_"))
+		if r := []rune(s); len(r) > 80 {
+			s = string(r[:80])
+		}
+		return s
+	}
+
+	return strings.NewReplacer(
+		"{channel}", clean(stream.Channel.Name),
+		"{game}", clean(stream.Game),
+		"{title}", clean(stream.Channel.Status),
+		"{id}", fmt.Sprint(stream.Id),
+		"{date}", started.Format("2006-01-02"),
+		"{time}", started.Format("15-04-05"),
+		"{part}", fmt.Sprintf("%03d", part),
+	).Replace(template)
+}
@@ -0,0 +1,177 @@
+package recorder
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hchagen/twitch-player/twitch"
+)
+
+func writeConfig(t *testing.T, text string) string {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	c, err := LoadConfig(writeConfig(t, `
+output_dir: /srv/recordings
+quota: 200GiB
+rules:
+  - channel: SomeChannel
+    game: "^Dota 2$"
+    title: "(?i)finals"
+    max_duration: 6h
+  - channel: other
+    output: "{channel}/{date}_{title}.ts"
+    split_duration: 1h
+    split_size: 4GiB
+    retention: 720h
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Interval != DefaultInterval {
+		t.Errorf("Interval is %s, want the default %s", c.Interval, DefaultInterval)
+	}
+	if c.Manifest != DefaultManifest {
+		t.Errorf("Manifest is %q, want the default %q", c.Manifest, DefaultManifest)
+	}
+	if c.Quota != 200<<30 {
+		t.Errorf("Quota is %d, want %d", c.Quota, Size(200<<30))
+	}
+	if len(c.Rules) != 2 {
+		t.Fatalf("Got %d rules, want 2", len(c.Rules))
+	}
+
+	first, second := c.Rules[0], c.Rules[1]
+	if first.Channel != "somechannel" {
+		t.Errorf("Channel is %q, want it lower cased", first.Channel)
+	}
+	if first.Output != DefaultOutput {
+		t.Errorf("Output is %q, want the default %q", first.Output, DefaultOutput)
+	}
+	if first.MaxDuration != 6*time.Hour {
+		t.Errorf("Max duration is %s, want 6h", first.MaxDuration)
+	}
+	if second.Output != "{channel}/{date}_{title}_{part}.ts" {
+		t.Errorf("Output of a split rule is %q, want a part number", second.Output)
+	}
+	if second.SplitSize != 4<<30 || second.SplitDuration != time.Hour || second.Retention != 720*time.Hour {
+		t.Errorf("Split rule is %+v", second)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"no rules", "interval: 1m\n", "No rules"},
+		{"missing channel", "rules:\n  - game: Dota 2\n", "Rule 1: Missing channel"},
+		{"bad regexp", "rules:\n  - channel: a\n  - channel: b\n    title: \"(\"\n", "Rule 2"},
+		{"bad size", "rules:\n  - channel: a\n    quota: 4 parsecs\n", "Invalid size unit"},
+		{"unknown field", "rules:\n  - channel: a\n    qualty: 720p\n", "qualty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadConfig(writeConfig(t, tt.text))
+			if err == nil {
+				t.Fatal("Loaded an invalid config")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Error is %q, want it to mention %q", err.Error(), tt.want)
+			}
+		})
+	}
+}
+
+func twitchStream(channel, game, title string) twitch.Stream {
+	s := twitch.Stream{Game: game}
+	s.Channel.Name = channel
+	s.Channel.Status = title
+
+	return s
+}
+
+func TestRuleMatch(t *testing.T) {
+	r := &Rule{Channel: "SomeChannel", Game: "^Dota 2$", Title: "(?i)finals"}
+	if err := r.compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		stream twitch.Stream
+		want   bool
+	}{
+		{"match", twitchStream("somechannel", "Dota 2", "Grand FINALS"), true},
+		{"channel case", twitchStream("SOMECHANNEL", "Dota 2", "finals day"), true},
+		{"other channel", twitchStream("other", "Dota 2", "finals"), false},
+		{"other game", twitchStream("somechannel", "Dota 2 Underlords", "finals"), false},
+		{"other title", twitchStream("somechannel", "Dota 2", "qualifiers"), false},
+	}
+
+	for _, tt := range tests {
+		if got := r.Match(tt.stream); got != tt.want {
+			t.Errorf("%s: Match is %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPartTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"{channel}.ts", "{channel}_{part}.ts"},
+		{"{channel}/{date}_{title}.mkv", "{channel}/{date}_{title}_{part}.mkv"},
+		{"{channel}_part{part}.ts", "{channel}_part{part}.ts"},
+		{"{channel}", "{channel}_{part}"},
+	}
+
+	for _, tt := range tests {
+		if got := PartTemplate(tt.template); got != tt.want {
+			t.Errorf("PartTemplate(%q) is %q, want %q", tt.template, got, tt.want)
+		}
+	}
+}
+
+func TestFilename(t *testing.T) {
+	var stream twitch.Stream
+	stream.Id = 42
+	stream.Game = "Dota 2"
+	stream.Channel.Name = "somechannel"
+	stream.Channel.Status = ` Finals: "A" vs B/C? `
+	started := time.Date(2024, 3, 9, 18, 5, 7, 0, time.UTC)
+
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{DefaultOutput, "somechannel_2024-03-09_18-05-07.ts"},
+		{"{channel}/{date}_{title}.ts", "somechannel/2024-03-09_Finals_ _A_ vs B_C_.ts"},
+		{"{id}_{game}_{part}.ts", "42_Dota 2_007.ts"},
+		{"{unknown}.ts", "{unknown}.ts"},
+	}
+
+	for _, tt := range tests {
+		if got := Filename(tt.template, stream, started, 7); got != tt.want {
+			t.Errorf("Filename(%q) is %q, want %q", tt.template, got, tt.want)
+		}
+	}
+
+	stream.Channel.Status = strings.Repeat("ä", 100)
+	if got := Filename("{title}", stream, started, 1); len([]rune(got)) != 80 {
+		t.Errorf("Long title is cut to %d characters, want 80", len([]rune(got)))
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+
+	"github.com/hchagen/twitch-player/chat"
+	"github.com/hchagen/twitch-player/recorder"
+	"github.com/hchagen/twitch-player/remux"
+)
+
+var remuxFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "remux",
+		Usage: "Convert to mp4 or mkv when done",
+	},
+	cli.BoolFlag{
+		Name:  "keep-ts",
+		Usage: "Keep the .ts file after converting",
+	},
+}
+
+func checkRemuxFlag(ctx *cli.Context) error {
+	if format := ctx.String("remux"); format != "" {
+		if _, err := remux.FormatOf("." + format); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// remuxRecording converts a finished .ts file if --remux is given and
+// returns the path of the result, which the recording's sidecar then names
+// unless the .ts is kept. The chat replay, if any, becomes a subtitle track
+// of mkv output.
+func remuxRecording(ctx *cli.Context, path string, replay *chat.Replay) (string, error) {
+	format := ctx.String("remux")
+	if format == "" {
+		return path, nil
+	}
+
+	out := strings.TrimSuffix(path, filepath.Ext(path)) + "." + format
+	if out == path {
+		return path, nil
+	}
+	var subtitles []remux.Subtitle
+	if replay != nil && format == remux.FormatMKV {
+		subtitles = chatSubtitles(ctx, replay)
+	}
+	if err := remux.FileWithSubtitles(path, out, subtitles); err != nil {
+		return path, fmt.Errorf("Converting %s: %s", path, err.Error())
+	}
+	if !ctx.Bool("keep-ts") {
+		if err := os.Remove(path); err != nil {
+			return out, err
+		}
+		if err := recorder.MovePart(path, out); err != nil {
+			return out, err
+		}
+	}
+
+	return out, nil
+}
+
+func onRemux(ctx *cli.Context) error {
+	if ctx.NArg() != 2 {
+		return fmt.Errorf("Please provide an input and an output file")
+	}
+
+	started := time.Now()
+	if err := remux.File(ctx.Args()[0], ctx.Args()[1]); err != nil {
+		return err
+	}
+	fmt.Printf("Saved %s in %s\n", ctx.Args()[1], time.Since(started).Truncate(time.Millisecond))
+
+	return nil
+}
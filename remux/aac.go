@@ -0,0 +1,73 @@
+package remux
+
+import (
+	"fmt"
+)
+
+// aacSamplesPerFrame is the number of samples in an AAC LC frame.
+const aacSamplesPerFrame = 1024
+
+var aacSampleRates = []int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+type adtsHeader struct {
+	objectType  int
+	rateIndex   int
+	channels    int
+	headerSize  int
+	frameLength int
+}
+
+func parseAdts(b []byte) (adtsHeader, error) {
+	if len(b) < 7 || b[0] != 0xff || b[1]&0xf0 != 0xf0 {
+		return adtsHeader{}, fmt.Errorf("Missing ADTS sync word")
+	}
+
+	h := adtsHeader{
+		objectType:  int(b[2]>>6) + 1,
+		rateIndex:   int(b[2] >> 2 & 0x0f),
+		channels:    int(b[2]&0x01)<<2 | int(b[3]>>6),
+		headerSize:  7,
+		frameLength: int(b[3]&0x03)<<11 | int(b[4])<<3 | int(b[5]>>5),
+	}
+	if b[1]&0x01 == 0 {
+		h.headerSize = 9
+	}
+	if h.rateIndex >= len(aacSampleRates) {
+		return adtsHeader{}, fmt.Errorf("Invalid AAC sample rate index %d", h.rateIndex)
+	}
+	if h.frameLength < h.headerSize {
+		return adtsHeader{}, fmt.Errorf("Invalid ADTS frame length %d", h.frameLength)
+	}
+
+	return h, nil
+}
+
+func (h adtsHeader) sampleRate() int {
+	return aacSampleRates[h.rateIndex]
+}
+
+// audioSpecificConfig is the esds decoder specific info and the Matroska
+// codec private data.
+func (h adtsHeader) audioSpecificConfig() []byte {
+	return []byte{
+		byte(h.objectType<<3 | h.rateIndex>>1),
+		byte(h.rateIndex&0x01<<7 | h.channels<<3),
+	}
+}
+
+// splitAdts returns the raw frames of a PES payload.
+func splitAdts(data []byte) ([]adtsHeader, [][]byte) {
+	var headers []adtsHeader
+	var frames [][]byte
+	for len(data) > 0 {
+		h, err := parseAdts(data)
+		if err != nil || h.frameLength > len(data) {
+			break
+		}
+		headers = append(headers, h)
+		frames = append(frames, data[h.headerSize:h.frameLength])
+		data = data[h.frameLength:]
+	}
+
+	return headers, frames
+}
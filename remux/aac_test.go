@@ -0,0 +1,87 @@
+package remux
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseAdts(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		want   adtsHeader
+		rate   int
+		err    bool
+	}{
+		{
+			name:   "LC 44.1kHz stereo",
+			header: []byte{0xff, 0xf1, 0x50, 0x80, 0x2e, 0x7f, 0xfc},
+			want:   adtsHeader{objectType: 2, rateIndex: 4, channels: 2, headerSize: 7, frameLength: 371},
+			rate:   44100,
+		},
+		{
+			name:   "LC 48kHz mono with CRC",
+			header: []byte{0xff, 0xf0, 0x4c, 0x40, 0x20, 0x1f, 0xfc, 0x12, 0x34},
+			want:   adtsHeader{objectType: 2, rateIndex: 3, channels: 1, headerSize: 9, frameLength: 256},
+			rate:   48000,
+		},
+		{
+			name:   "LC 96kHz stereo",
+			header: []byte{0xff, 0xf1, 0x40, 0x80, 0x10, 0x1f, 0xfc},
+			want:   adtsHeader{objectType: 2, rateIndex: 0, channels: 2, headerSize: 7, frameLength: 128},
+			rate:   96000,
+		},
+		{name: "no sync word", header: []byte{0xff, 0x01, 0x50, 0x80, 0x2e, 0x7f, 0xfc}, err: true},
+		{name: "short", header: []byte{0xff, 0xf1, 0x50, 0x80, 0x2e, 0x7f}, err: true},
+		{name: "reserved rate", header: []byte{0xff, 0xf1, 0x7c, 0x80, 0x2e, 0x7f, 0xfc}, err: true},
+		{name: "frame shorter than header", header: []byte{0xff, 0xf1, 0x50, 0x80, 0x00, 0xbf, 0xfc}, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := parseAdts(tt.header)
+			if tt.err {
+				if err == nil {
+					t.Errorf("Parsed %+v, want an error", h)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h != tt.want {
+				t.Errorf("Header is %+v, want %+v", h, tt.want)
+			}
+			if h.sampleRate() != tt.rate {
+				t.Errorf("Sample rate is %d, want %d", h.sampleRate(), tt.rate)
+			}
+		})
+	}
+}
+
+func TestAudioSpecificConfig(t *testing.T) {
+	h := adtsHeader{objectType: 2, rateIndex: 4, channels: 2}
+	if c := h.audioSpecificConfig(); !bytes.Equal(c, []byte{0x12, 0x10}) {
+		t.Errorf("Config is %x, want 1210", c)
+	}
+}
+
+func TestSplitAdts(t *testing.T) {
+	frame := func(payload ...byte) []byte {
+		n := 7 + len(payload)
+		return append([]byte{0xff, 0xf1, 0x50, 0x80, byte(n >> 3), byte(n<<5) | 0x1f, 0xfc}, payload...)
+	}
+
+	var data []byte
+	data = append(data, frame(0x21, 0x10)...)
+	data = append(data, frame(0x21)...)
+	data = append(data, frame(0x21, 0x10, 0x04)[:8]...)
+
+	headers, frames := splitAdts(data)
+	if len(headers) != 2 || len(frames) != 2 {
+		t.Fatalf("Got %d frames, want 2 without the cut off one", len(frames))
+	}
+	if !bytes.Equal(frames[0], []byte{0x21, 0x10}) || !bytes.Equal(frames[1], []byte{0x21}) {
+		t.Errorf("Frames are %x", frames)
+	}
+}
@@ -0,0 +1,227 @@
+package remux
+
+import (
+	"fmt"
+)
+
+const (
+	nalIdr = 5
+	nalSps = 7
+	nalPps = 8
+	nalAud = 9
+)
+
+// splitNals splits an Annex B byte stream on its start codes.
+func splitNals(data []byte) [][]byte {
+	var nals [][]byte
+	start := -1
+	for i := 0; i+2 < len(data); {
+		if data[i] != 0 || data[i+1] != 0 || data[i+2] != 1 {
+			i++
+			continue
+		}
+		if start >= 0 {
+			end := i
+			for end > start && data[end-1] == 0 {
+				end--
+			}
+			nals = append(nals, data[start:end])
+		}
+		i += 3
+		start = i
+	}
+	if start >= 0 && start < len(data) {
+		nals = append(nals, data[start:])
+	}
+
+	return nals
+}
+
+// avcSample converts an access unit to length prefixed NAL units without
+// access unit delimiters, as used by MP4 and Matroska.
+func avcSample(nals [][]byte) []byte {
+	size := 0
+	for _, nal := range nals {
+		size += 4 + len(nal)
+	}
+
+	sample := make([]byte, 0, size)
+	for _, nal := range nals {
+		if len(nal) == 0 || nal[0]&0x1f == nalAud {
+			continue
+		}
+		sample = appendUint32(sample, uint32(len(nal)))
+		sample = append(sample, nal...)
+	}
+
+	return sample
+}
+
+// avcConfig returns an AVCDecoderConfigurationRecord, the avcC box payload and
+// the Matroska codec private data.
+func avcConfig(sps, pps []byte) []byte {
+	c := []byte{1, sps[1], sps[2], sps[3], 0xff, 0xe1}
+	c = appendUint16(c, uint16(len(sps)))
+	c = append(c, sps...)
+	c = append(c, 1)
+	c = appendUint16(c, uint16(len(pps)))
+	c = append(c, pps...)
+
+	return c
+}
+
+type bitReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (b *bitReader) bit() uint {
+	if b.pos >= len(b.data)*8 {
+		b.err = fmt.Errorf("SPS too short")
+		return 0
+	}
+	v := uint(b.data[b.pos/8]>>(7-b.pos%8)) & 1
+	b.pos++
+
+	return v
+}
+
+func (b *bitReader) bits(n int) uint {
+	var v uint
+	for i := 0; i < n; i++ {
+		v = v<<1 | b.bit()
+	}
+
+	return v
+}
+
+func (b *bitReader) ue() uint {
+	zeros := 0
+	for b.bit() == 0 && b.err == nil && zeros < 32 {
+		zeros++
+	}
+
+	return 1<<uint(zeros) - 1 + b.bits(zeros)
+}
+
+func (b *bitReader) se() int {
+	v := b.ue()
+	if v&1 == 1 {
+		return int(v+1) / 2
+	}
+
+	return -int(v / 2)
+}
+
+// unescapeRbsp removes emulation prevention bytes.
+func unescapeRbsp(nal []byte) []byte {
+	out := make([]byte, 0, len(nal))
+	zeros := 0
+	for _, b := range nal {
+		if zeros >= 2 && b == 3 {
+			zeros = 0
+			continue
+		}
+		out = append(out, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+
+	return out
+}
+
+// spsSize reads the cropped picture size from a sequence parameter set.
+func spsSize(sps []byte) (width, height int, err error) {
+	if len(sps) < 4 {
+		return 0, 0, fmt.Errorf("SPS too short")
+	}
+	b := &bitReader{data: unescapeRbsp(sps[1:])}
+
+	profile := b.bits(8)
+	b.bits(16)
+	b.ue()
+
+	chroma := uint(1)
+	switch profile {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		chroma = b.ue()
+		if chroma == 3 {
+			b.bit()
+		}
+		b.ue()
+		b.ue()
+		b.bit()
+		if b.bit() == 1 {
+			lists := 8
+			if chroma == 3 {
+				lists = 12
+			}
+			for i := 0; i < lists; i++ {
+				if b.bit() == 0 {
+					continue
+				}
+				size := 16
+				if i >= 6 {
+					size = 64
+				}
+				last, next := 8, 8
+				for j := 0; j < size; j++ {
+					if next != 0 {
+						next = (last + b.se() + 256) % 256
+					}
+					if next != 0 {
+						last = next
+					}
+				}
+			}
+		}
+	}
+
+	b.ue()
+	switch b.ue() {
+	case 0:
+		b.ue()
+	case 1:
+		b.bit()
+		b.se()
+		b.se()
+		for n := b.ue(); n > 0 && b.err == nil; n-- {
+			b.se()
+		}
+	}
+	b.ue()
+	b.bit()
+
+	widthMbs := int(b.ue()) + 1
+	heightMaps := int(b.ue()) + 1
+	frameMbsOnly := int(b.bit())
+	if frameMbsOnly == 0 {
+		b.bit()
+	}
+	b.bit()
+
+	var left, right, top, bottom int
+	if b.bit() == 1 {
+		left, right, top, bottom = int(b.ue()), int(b.ue()), int(b.ue()), int(b.ue())
+	}
+	if b.err != nil {
+		return 0, 0, b.err
+	}
+
+	cropX, cropY := 1, 2-frameMbsOnly
+	switch chroma {
+	case 1:
+		cropX, cropY = 2, 2*(2-frameMbsOnly)
+	case 2:
+		cropX = 2
+	}
+
+	width = widthMbs*16 - (left+right)*cropX
+	height = (2-frameMbsOnly)*heightMaps*16 - (top+bottom)*cropY
+
+	return width, height, nil
+}
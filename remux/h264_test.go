@@ -0,0 +1,131 @@
+package remux
+
+import (
+	"bytes"
+	"testing"
+)
+
+// sps1080 is a High profile SPS of a 1920x1088 coded picture cropped to 1080
+// lines, with VUI and HRD parameters after the size.
+var sps1080 = []byte{
+	0x67, 0x64, 0x00, 0x28, 0xac, 0x2c, 0xa4, 0x01, 0xe0, 0x08, 0x9f, 0x97, 0xff, 0x00, 0x01, 0x00,
+	0x01, 0x52, 0x02, 0x02, 0x02, 0x80, 0x00, 0x01, 0xf4, 0x80, 0x00, 0x75, 0x30, 0x70, 0x10, 0x00,
+	0x16, 0xe3, 0x60, 0x00, 0x08, 0x95, 0x45, 0xf8, 0xc7, 0x07, 0x68, 0x58, 0xb4, 0x48,
+}
+
+// sps64 is a 64x64 High profile SPS with emulation prevention bytes.
+var sps64 = []byte{
+	0x67, 0x64, 0x00, 0x0a, 0xac, 0x72, 0x84, 0x44, 0x26, 0x84, 0x00, 0x00, 0x03, 0x00, 0x04, 0x00,
+	0x00, 0x03, 0x00, 0xca, 0x3c, 0x48, 0x96, 0x11, 0x80,
+}
+
+var pps = []byte{0x68, 0xe8, 0x43, 0x8f, 0x13, 0x21, 0x30}
+
+func TestSplitNals(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want [][]byte
+	}{
+		{"empty", nil, nil},
+		{"no start code", []byte{0x09, 0xf0}, nil},
+		{"three byte start codes", []byte{0, 0, 1, 0x09, 0xf0, 0, 0, 1, 0x65, 0x88}, [][]byte{{0x09, 0xf0}, {0x65, 0x88}}},
+		{"four byte start codes", []byte{0, 0, 0, 1, 0x67, 0x64, 0, 0, 0, 1, 0x68, 0xe8}, [][]byte{{0x67, 0x64}, {0x68, 0xe8}}},
+		{"trailing zeros", []byte{0, 0, 1, 0x65, 0x88, 0, 0, 0, 0, 0, 1, 0x41}, [][]byte{{0x65, 0x88}, {0x41}}},
+		{"garbage before the first", []byte{0xff, 0x00, 0, 0, 1, 0x41, 0x9a}, [][]byte{{0x41, 0x9a}}},
+		{"start code at the end", []byte{0, 0, 1, 0x41, 0, 0, 1}, [][]byte{{0x41}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitNals(tt.data)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Got %d NAL units %x, want %d", len(got), got, len(tt.want))
+			}
+			for i := range got {
+				if !bytes.Equal(got[i], tt.want[i]) {
+					t.Errorf("NAL unit %d is %x, want %x", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestUnescapeRbsp(t *testing.T) {
+	tests := []struct {
+		nal, want []byte
+	}{
+		{[]byte{0x67, 0x64}, []byte{0x67, 0x64}},
+		{[]byte{0x00, 0x00, 0x03, 0x01}, []byte{0x00, 0x00, 0x01}},
+		{[]byte{0x00, 0x00, 0x03, 0x00, 0x00, 0x03}, []byte{0x00, 0x00, 0x00, 0x00}},
+		{[]byte{0x00, 0x03, 0x00, 0x03}, []byte{0x00, 0x03, 0x00, 0x03}},
+		{[]byte{0x00, 0x00, 0x00, 0x03, 0x03}, []byte{0x00, 0x00, 0x00, 0x03}},
+	}
+
+	for _, tt := range tests {
+		if got := unescapeRbsp(tt.nal); !bytes.Equal(got, tt.want) {
+			t.Errorf("unescapeRbsp(%x) is %x, want %x", tt.nal, got, tt.want)
+		}
+	}
+}
+
+func TestSpsSize(t *testing.T) {
+	tests := []struct {
+		name          string
+		sps           []byte
+		width, height int
+	}{
+		{"1080p cropped", sps1080, 1920, 1080},
+		{"escaped", sps64, 64, 64},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			width, height, err := spsSize(tt.sps)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if width != tt.width || height != tt.height {
+				t.Errorf("Size is %dx%d, want %dx%d", width, height, tt.width, tt.height)
+			}
+		})
+	}
+
+	for _, n := range []int{0, 3, 8} {
+		if _, _, err := spsSize(sps1080[:n]); err == nil {
+			t.Errorf("SPS cut to %d bytes was accepted", n)
+		}
+	}
+}
+
+func TestAvcSample(t *testing.T) {
+	nals := [][]byte{{0x09, 0xf0}, sps64, pps, {0x65, 0x88, 0x84}}
+
+	got := avcSample(nals)
+	var want []byte
+	for _, nal := range nals[1:] {
+		want = appendUint32(want, uint32(len(nal)))
+		want = append(want, nal...)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Sample is %x, want %x", got, want)
+	}
+}
+
+func TestAvcConfig(t *testing.T) {
+	c := avcConfig(sps64, pps)
+
+	if c[0] != 1 || c[1] != 0x64 || c[2] != 0x00 || c[3] != 0x0a {
+		t.Errorf("Record starts %x, want version 1 and profile 64000a", c[:4])
+	}
+	if c[4] != 0xff || c[5] != 0xe1 {
+		t.Errorf("Length size and SPS count are %x, want ffe1", c[4:6])
+	}
+	if n := int(c[6])<<8 | int(c[7]); n != len(sps64) || !bytes.Equal(c[8:8+n], sps64) {
+		t.Errorf("SPS is %x", c[8:8+n])
+	}
+	rest := c[8+len(sps64):]
+	if rest[0] != 1 || int(rest[1])<<8|int(rest[2]) != len(pps) || !bytes.Equal(rest[3:], pps) {
+		t.Errorf("PPS part is %x", rest)
+	}
+}
@@ -0,0 +1,424 @@
+package remux
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"sort"
+)
+
+const (
+	mkvEbml               = 0x1a45dfa3
+	mkvEbmlVersion        = 0x4286
+	mkvEbmlReadVersion    = 0x42f7
+	mkvEbmlMaxIdLength    = 0x42f2
+	mkvEbmlMaxSizeLength  = 0x42f3
+	mkvDocType            = 0x4282
+	mkvDocTypeVersion     = 0x4287
+	mkvDocTypeReadVersion = 0x4285
+
+	mkvSegment        = 0x18538067
+	mkvSeekHead       = 0x114d9b74
+	mkvSeek           = 0x4dbb
+	mkvSeekId         = 0x53ab
+	mkvSeekPosition   = 0x53ac
+	mkvInfo           = 0x1549a966
+	mkvTimestampScale = 0x2ad7b1
+	mkvDuration       = 0x4489
+	mkvMuxingApp      = 0x4d80
+	mkvWritingApp     = 0x5741
+
+	mkvTracks            = 0x1654ae6b
+	mkvTrackEntry        = 0xae
+	mkvTrackNumber       = 0xd7
+	mkvTrackUid          = 0x73c5
+	mkvTrackType         = 0x83
+	mkvFlagLacing        = 0x9c
+	mkvCodecId           = 0x86
+	mkvCodecPrivate      = 0x63a2
+	mkvName              = 0x536e
+	mkvVideo             = 0xe0
+	mkvPixelWidth        = 0xb0
+	mkvPixelHeight       = 0xba
+	mkvAudio             = 0xe1
+	mkvSamplingFrequency = 0xb5
+	mkvChannels          = 0x9f
+
+	mkvCluster       = 0x1f43b675
+	mkvTimestamp     = 0xe7
+	mkvSimpleBlock   = 0xa3
+	mkvBlockGroup    = 0xa0
+	mkvBlock         = 0xa1
+	mkvBlockDuration = 0x9b
+
+	mkvCues               = 0x1c53bb6b
+	mkvCuePoint           = 0xbb
+	mkvCueTime            = 0xb3
+	mkvCueTrackPositions  = 0xb7
+	mkvCueTrack           = 0xf7
+	mkvCueClusterPosition = 0xf1
+
+	mkvVoid = 0xec
+
+	// mkvClusterDuration in milliseconds bounds clusters of audio only output
+	// and keeps block timestamps within 16 bits.
+	mkvClusterDuration = 5000
+	mkvMuxingAppName   = "twitch-player"
+)
+
+func ebmlId(id uint32) []byte {
+	switch {
+	case id > 0xffffff:
+		return []byte{byte(id >> 24), byte(id >> 16), byte(id >> 8), byte(id)}
+	case id > 0xffff:
+		return []byte{byte(id >> 16), byte(id >> 8), byte(id)}
+	case id > 0xff:
+		return []byte{byte(id >> 8), byte(id)}
+	}
+
+	return []byte{byte(id)}
+}
+
+func ebmlSize(size uint64) []byte {
+	n := 1
+	for n < 8 && size >= 1<<(7*uint(n))-1 {
+		n++
+	}
+
+	b := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		b[i] = byte(size)
+		size >>= 8
+	}
+	b[0] |= 0x80 >> uint(n-1)
+
+	return b
+}
+
+func element(id uint32, payload ...[]byte) []byte {
+	size := 0
+	for _, p := range payload {
+		size += len(p)
+	}
+
+	e := append(ebmlId(id), ebmlSize(uint64(size))...)
+	for _, p := range payload {
+		e = append(e, p...)
+	}
+
+	return e
+}
+
+func uintElement(id uint32, v uint64) []byte {
+	b := appendUint64(nil, v)
+	for len(b) > 1 && b[0] == 0 {
+		b = b[1:]
+	}
+
+	return element(id, b)
+}
+
+func floatElement(id uint32, v float64) []byte {
+	return element(id, appendUint64(nil, math.Float64bits(v)))
+}
+
+type mkvCue struct {
+	time     int64
+	position int64
+}
+
+// mkvMuxer writes Matroska with a cluster per video keyframe.
+type mkvMuxer struct {
+	w       io.Writer
+	written int64
+
+	segment  int64
+	info     int64
+	tracks   int64
+	duration int64
+	// durationAt is the file offset of the duration value.
+	durationAt int64
+
+	video int
+	// subtitles wait to be interleaved with the samples.
+	subtitles     []Subtitle
+	subtitleTrack int
+	cluster       []byte
+	time          int64
+	open          bool
+	cues          []mkvCue
+}
+
+func newMkvMuxer(w io.Writer, subtitles []Subtitle) *mkvMuxer {
+	subtitles = append([]Subtitle(nil), subtitles...)
+	sort.SliceStable(subtitles, func(i, j int) bool {
+		return subtitles[i].Start < subtitles[j].Start
+	})
+
+	return &mkvMuxer{
+		w:         w,
+		subtitles: subtitles,
+	}
+}
+
+func (m *mkvMuxer) write(b []byte) error {
+	n, err := m.w.Write(b)
+	m.written += int64(n)
+
+	return err
+}
+
+func seekEntry(id uint32, position int64) []byte {
+	return element(mkvSeek,
+		element(mkvSeekId, ebmlId(id)),
+		element(mkvSeekPosition, appendUint64(nil, uint64(position))),
+	)
+}
+
+// seekHeadElement lists Info, Tracks and, once written, Cues, padded to the
+// same size either way.
+func (m *mkvMuxer) seekHeadElement(cues int64) []byte {
+	entries := [][]byte{
+		seekEntry(mkvInfo, m.info),
+		seekEntry(mkvTracks, m.tracks),
+	}
+	if cues > 0 {
+		return element(mkvSeekHead, append(entries, seekEntry(mkvCues, cues))...)
+	}
+
+	void := len(seekEntry(mkvCues, 0))
+	return append(element(mkvSeekHead, entries...), element(mkvVoid, make([]byte, void-2))...)
+}
+
+func (m *mkvMuxer) writeHeader(tracks []*track) error {
+	header := element(mkvEbml,
+		uintElement(mkvEbmlVersion, 1),
+		uintElement(mkvEbmlReadVersion, 1),
+		uintElement(mkvEbmlMaxIdLength, 4),
+		uintElement(mkvEbmlMaxSizeLength, 8),
+		element(mkvDocType, []byte("matroska")),
+		uintElement(mkvDocTypeVersion, 4),
+		uintElement(mkvDocTypeReadVersion, 2),
+	)
+	// unknown size until close
+	header = append(header, ebmlId(mkvSegment)...)
+	header = append(header, 0x01, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+	if err := m.write(header); err != nil {
+		return err
+	}
+	m.segment = m.written
+
+	info := element(mkvInfo,
+		uintElement(mkvTimestampScale, 1000000),
+		element(mkvMuxingApp, []byte(mkvMuxingAppName)),
+		element(mkvWritingApp, []byte(mkvMuxingAppName)),
+		floatElement(mkvDuration, 0),
+	)
+
+	var entries [][]byte
+	for _, t := range tracks {
+		entry := [][]byte{
+			uintElement(mkvTrackNumber, uint64(t.id)),
+			uintElement(mkvTrackUid, uint64(t.id)),
+			uintElement(mkvFlagLacing, 0),
+			element(mkvCodecPrivate, t.codec),
+		}
+		if t.kind == trackVideo {
+			if m.video == 0 {
+				m.video = t.id
+			}
+			entry = append(entry,
+				uintElement(mkvTrackType, 1),
+				element(mkvCodecId, []byte("V_MPEG4/ISO/AVC")),
+				element(mkvVideo,
+					uintElement(mkvPixelWidth, uint64(t.width)),
+					uintElement(mkvPixelHeight, uint64(t.height)),
+				),
+			)
+		} else {
+			entry = append(entry,
+				uintElement(mkvTrackType, 2),
+				element(mkvCodecId, []byte("A_AAC")),
+				element(mkvAudio,
+					floatElement(mkvSamplingFrequency, float64(t.sampleRate)),
+					uintElement(mkvChannels, uint64(t.channels)),
+				),
+			)
+		}
+		entries = append(entries, element(mkvTrackEntry, entry...))
+	}
+	if len(m.subtitles) > 0 {
+		m.subtitleTrack = len(tracks) + 1
+		entries = append(entries, element(mkvTrackEntry,
+			uintElement(mkvTrackNumber, uint64(m.subtitleTrack)),
+			uintElement(mkvTrackUid, uint64(m.subtitleTrack)),
+			uintElement(mkvFlagLacing, 0),
+			uintElement(mkvTrackType, 0x11),
+			element(mkvCodecId, []byte("S_TEXT/UTF8")),
+			element(mkvName, []byte("Chat")),
+		))
+	}
+
+	seekHeadLen := len(m.seekHeadElement(0))
+	m.info = int64(seekHeadLen)
+	m.tracks = m.info + int64(len(info))
+	m.durationAt = m.segment + m.tracks - 8
+
+	if err := m.write(m.seekHeadElement(0)); err != nil {
+		return err
+	}
+	if err := m.write(info); err != nil {
+		return err
+	}
+
+	return m.write(element(mkvTracks, entries...))
+}
+
+func (m *mkvMuxer) writeSample(t *track, s sample) error {
+	ms := s.pts * 1000 / timescale
+	if err := m.writeSubtitles(ms); err != nil {
+		return err
+	}
+	if end := ms + 1; end > m.duration {
+		m.duration = end
+	}
+
+	if err := m.startCluster(ms, t.id == m.video && s.key); err != nil {
+		return err
+	}
+
+	flags := byte(0)
+	if s.key {
+		flags = 0x80
+	}
+	m.cluster = append(m.cluster, element(mkvSimpleBlock, m.blockHeader(t.id, ms, flags), s.data)...)
+
+	return nil
+}
+
+// startCluster flushes the current cluster at a video keyframe, or when the
+// block at ms would be too far from the start of the cluster.
+func (m *mkvMuxer) startCluster(ms int64, keyframe bool) error {
+	if m.open && !(keyframe && len(m.cluster) > 0) && ms-m.time < mkvClusterDuration*6 && (m.video != 0 || ms-m.time < mkvClusterDuration) {
+		return nil
+	}
+
+	if err := m.flush(); err != nil {
+		return err
+	}
+	m.open = true
+	m.time = ms
+	if keyframe || m.video == 0 {
+		m.cues = append(m.cues, mkvCue{time: ms, position: m.written - m.segment})
+	}
+
+	return nil
+}
+
+func (m *mkvMuxer) blockHeader(track int, ms int64, flags byte) []byte {
+	header := []byte{0x80 | byte(track), 0, 0, flags}
+	binary.BigEndian.PutUint16(header[1:], uint16(int16(ms-m.time)))
+
+	return header
+}
+
+// writeSubtitles adds the subtitles starting up to ms.
+func (m *mkvMuxer) writeSubtitles(ms int64) error {
+	for len(m.subtitles) > 0 {
+		sub := m.subtitles[0]
+		start := sub.Start.Milliseconds()
+		if start > ms {
+			return nil
+		}
+		m.subtitles = m.subtitles[1:]
+
+		if err := m.startCluster(start, false); err != nil {
+			return err
+		}
+		m.cluster = append(m.cluster, element(mkvBlockGroup,
+			element(mkvBlock, m.blockHeader(m.subtitleTrack, start, 0), []byte(sub.Text)),
+			uintElement(mkvBlockDuration, uint64((sub.End-sub.Start).Milliseconds())),
+		)...)
+	}
+
+	return nil
+}
+
+func (m *mkvMuxer) flush() error {
+	if !m.open {
+		return nil
+	}
+	cluster := element(mkvCluster, uintElement(mkvTimestamp, uint64(m.time)), m.cluster)
+	m.cluster = m.cluster[:0]
+	m.open = false
+
+	return m.write(cluster)
+}
+
+// close writes the last cluster and the cues, then fills in the segment size,
+// duration and seek head if the output is seekable.
+func (m *mkvMuxer) close() error {
+	// subtitles past the end of the video are dropped
+	if err := m.writeSubtitles(m.duration); err != nil {
+		return err
+	}
+	if err := m.flush(); err != nil {
+		return err
+	}
+	if m.segment == 0 {
+		return nil
+	}
+
+	cues := m.written - m.segment
+	var points [][]byte
+	for _, c := range m.cues {
+		track := m.video
+		if track == 0 {
+			track = 1
+		}
+		points = append(points, element(mkvCuePoint,
+			uintElement(mkvCueTime, uint64(c.time)),
+			element(mkvCueTrackPositions,
+				uintElement(mkvCueTrack, uint64(track)),
+				uintElement(mkvCueClusterPosition, uint64(c.position)),
+			),
+		))
+	}
+	if len(points) > 0 {
+		if err := m.write(element(mkvCues, points...)); err != nil {
+			return err
+		}
+	}
+
+	ws, ok := m.w.(io.WriteSeeker)
+	if !ok {
+		return nil
+	}
+
+	size := appendUint64(nil, uint64(m.written-m.segment))
+	size[0] = 0x01
+	patches := []struct {
+		at   int64
+		data []byte
+	}{
+		{m.segment - 8, size},
+		{m.durationAt, appendUint64(nil, math.Float64bits(float64(m.duration)))},
+	}
+	if len(points) > 0 {
+		patches = append(patches, struct {
+			at   int64
+			data []byte
+		}{m.segment, m.seekHeadElement(cues)})
+	}
+	for _, p := range patches {
+		if _, err := ws.Seek(p.at, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := ws.Write(p.data); err != nil {
+			return err
+		}
+	}
+	_, err := ws.Seek(0, io.SeekEnd)
+
+	return err
+}
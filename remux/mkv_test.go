@@ -0,0 +1,140 @@
+package remux
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// readVint reads an EBML variable size integer with its length marker
+// removed.
+func readVint(t *testing.T, b []byte) (uint64, int) {
+	if len(b) == 0 || b[0] == 0 {
+		t.Fatalf("Invalid variable size integer %x", b)
+	}
+	n := 1
+	for b[0]&(0x80>>uint(n-1)) == 0 {
+		n++
+	}
+	v := uint64(b[0] & (0xff >> uint(n)))
+	for _, c := range b[1:n] {
+		v = v<<8 | uint64(c)
+	}
+
+	return v, n
+}
+
+func TestEbmlSize(t *testing.T) {
+	tests := []struct {
+		size uint64
+		want []byte
+	}{
+		{0, []byte{0x80}},
+		{1, []byte{0x81}},
+		{126, []byte{0xfe}},
+		// all ones means unknown size
+		{127, []byte{0x40, 0x7f}},
+		{16382, []byte{0x7f, 0xfe}},
+		{16383, []byte{0x20, 0x3f, 0xff}},
+		{1 << 21, []byte{0x10, 0x20, 0x00, 0x00}},
+		{1<<56 - 2, []byte{0x01, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe}},
+	}
+
+	for _, tt := range tests {
+		if got := ebmlSize(tt.size); !bytes.Equal(got, tt.want) {
+			t.Errorf("ebmlSize(%d) is %x, want %x", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestEbmlId(t *testing.T) {
+	tests := []struct {
+		id   uint32
+		want []byte
+	}{
+		{mkvSimpleBlock, []byte{0xa3}},
+		{mkvDocType, []byte{0x42, 0x82}},
+		{mkvTimestampScale, []byte{0x2a, 0xd7, 0xb1}},
+		{mkvSegment, []byte{0x18, 0x53, 0x80, 0x67}},
+	}
+
+	for _, tt := range tests {
+		if got := ebmlId(tt.id); !bytes.Equal(got, tt.want) {
+			t.Errorf("ebmlId(%x) is %x, want %x", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestElement(t *testing.T) {
+	tests := []struct {
+		name string
+		e    []byte
+		want []byte
+	}{
+		{"empty", element(mkvVoid), []byte{0xec, 0x80}},
+		{"uint zero", uintElement(mkvTrackNumber, 0), []byte{0xd7, 0x81, 0x00}},
+		{"uint", uintElement(mkvTrackNumber, 1), []byte{0xd7, 0x81, 0x01}},
+		{"uint two bytes", uintElement(mkvTrackUid, 256), []byte{0x73, 0xc5, 0x82, 0x01, 0x00}},
+		{"float", floatElement(mkvDuration, 1), []byte{0x44, 0x89, 0x88, 0x3f, 0xf0, 0, 0, 0, 0, 0, 0}},
+		{"nested", element(mkvVideo, uintElement(mkvPixelWidth, 1920)), []byte{0xe0, 0x84, 0xb0, 0x82, 0x07, 0x80}},
+	}
+
+	for _, tt := range tests {
+		if !bytes.Equal(tt.e, tt.want) {
+			t.Errorf("%s element is %x, want %x", tt.name, tt.e, tt.want)
+		}
+	}
+
+	e := element(mkvCodecPrivate, make([]byte, 200))
+	if size, n := readVint(t, e[2:]); size != 200 || len(e) != 2+n+200 {
+		t.Errorf("Element of 200 bytes has size %d and length %d", size, len(e))
+	}
+}
+
+func TestMkvLayout(t *testing.T) {
+	w := &seekBuffer{}
+	m := newMkvMuxer(w, nil)
+	video := &track{id: 1, kind: trackVideo, codec: avcConfig(sps1080, pps), width: 1920, height: 1080}
+
+	if err := m.writeHeader([]*track{video}); err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 4; i++ {
+		s := sample{dts: i * 3000, pts: i * 3000, key: i%2 == 0, data: []byte{byte(i)}}
+		if err := m.writeSample(video, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(m.seekHeadElement(0)) != len(m.seekHeadElement(1000)) {
+		t.Errorf("Seek head is %d bytes without cues and %d with", len(m.seekHeadElement(0)), len(m.seekHeadElement(1000)))
+	}
+	if err := m.close(); err != nil {
+		t.Fatal(err)
+	}
+	b := w.Bytes()
+
+	header, n := readVint(t, b[4:])
+	segment := 4 + n + int(header)
+	if !bytes.Equal(b[segment:segment+4], ebmlId(mkvSegment)) {
+		t.Fatalf("No segment after the EBML header, got %x", b[segment:segment+4])
+	}
+	size, n := readVint(t, b[segment+4:])
+	if n != 8 || int(size) != len(b)-segment-4-n {
+		t.Errorf("Segment size is %d, want %d", size, len(b)-segment-4-n)
+	}
+
+	duration := math.Float64frombits(binary.BigEndian.Uint64(b[m.durationAt:]))
+	if duration != 101 || !bytes.Equal(b[m.durationAt-3:m.durationAt-1], ebmlId(mkvDuration)) {
+		t.Errorf("Duration is %v at %d, want 101", duration, m.durationAt)
+	}
+	if len(m.cues) != 2 {
+		t.Fatalf("Got %d cues, want one per keyframe", len(m.cues))
+	}
+	for _, c := range m.cues {
+		at := m.segment + c.position
+		if !bytes.Equal(b[at:at+4], ebmlId(mkvCluster)) {
+			t.Errorf("Cue at %d ms points to %x, not a cluster", c.time, b[at:at+4])
+		}
+	}
+}
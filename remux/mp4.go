@@ -0,0 +1,475 @@
+package remux
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+const (
+	// fragmentDuration splits audio only output, video fragments start at
+	// every keyframe.
+	fragmentDuration = 2 * timescale
+
+	sampleFlagsSync    = 0x02000000
+	sampleFlagsNonSync = 0x01010000
+)
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	return appendUint32(appendUint32(b, uint32(v>>32)), uint32(v))
+}
+
+func box(typ string, payload ...[]byte) []byte {
+	size := 8
+	for _, p := range payload {
+		size += len(p)
+	}
+
+	b := make([]byte, 0, size)
+	b = appendUint32(b, uint32(size))
+	b = append(b, typ...)
+	for _, p := range payload {
+		b = append(b, p...)
+	}
+
+	return b
+}
+
+func fullBox(typ string, version byte, flags uint32, payload ...[]byte) []byte {
+	header := appendUint32(nil, uint32(version)<<24|flags)
+	return box(typ, append([][]byte{header}, payload...)...)
+}
+
+var unityMatrix = []uint32{0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000}
+
+func matrix() []byte {
+	var b []byte
+	for _, v := range unityMatrix {
+		b = appendUint32(b, v)
+	}
+
+	return b
+}
+
+type mp4Track struct {
+	*track
+	samples []sample
+	// last waits for the next sample of the track to know its duration.
+	last *sample
+}
+
+type mp4Fragment struct {
+	time   uint64
+	offset uint64
+}
+
+// mp4Muxer writes fragmented MP4 with a fragment per video keyframe.
+type mp4Muxer struct {
+	w       io.Writer
+	written uint64
+
+	tracks []*mp4Track
+	byId   map[int]*mp4Track
+	// index is the track of the random access index, video if there is one.
+	index     *mp4Track
+	sequence  uint32
+	fragments []mp4Fragment
+	duration  int64
+	// mehd is the file offset of the fragment duration, patched at the end.
+	mehd uint64
+	// avc1 is the file offset of the video sample entry type, patched to
+	// avc3 at the end if the parameter sets changed.
+	avc1 uint64
+}
+
+func newMp4Muxer(w io.Writer) *mp4Muxer {
+	return &mp4Muxer{
+		w:    w,
+		byId: make(map[int]*mp4Track),
+	}
+}
+
+func (m *mp4Muxer) write(b []byte) error {
+	n, err := m.w.Write(b)
+	m.written += uint64(n)
+
+	return err
+}
+
+func (m *mp4Muxer) writeHeader(tracks []*track) error {
+	ftyp := box("ftyp", []byte("iso5"), appendUint32(nil, 512), []byte("iso5iso6mp41avc1"))
+
+	// without seeking there is no going back to signal changed parameter sets
+	_, seekable := m.w.(io.WriteSeeker)
+
+	var traks, trexs [][]byte
+	for _, t := range tracks {
+		mt := &mp4Track{track: t}
+		m.tracks = append(m.tracks, mt)
+		m.byId[t.id] = mt
+		if m.index == nil || (t.kind == trackVideo && m.index.kind != trackVideo) {
+			m.index = mt
+		}
+
+		traks = append(traks, trak(t, !seekable))
+		trexs = append(trexs, fullBox("trex", 0, 0,
+			appendUint32(nil, uint32(t.id)),
+			appendUint32(nil, 1),
+			make([]byte, 12),
+		))
+	}
+
+	var mvhd []byte
+	mvhd = appendUint32(mvhd, 0)
+	mvhd = appendUint32(mvhd, 0)
+	mvhd = appendUint32(mvhd, timescale)
+	mvhd = appendUint32(mvhd, 0)
+	mvhd = appendUint32(mvhd, 0x00010000)
+	mvhd = appendUint16(mvhd, 0x0100)
+	mvhd = append(mvhd, make([]byte, 10)...)
+	mvhd = append(mvhd, matrix()...)
+	mvhd = append(mvhd, make([]byte, 24)...)
+	mvhd = appendUint32(mvhd, uint32(len(tracks)+1))
+
+	mehd := fullBox("mehd", 1, 0, make([]byte, 8))
+	mvex := box("mvex", append([][]byte{mehd}, trexs...)...)
+	moov := box("moov", append(append([][]byte{fullBox("mvhd", 0, 0, mvhd)}, traks...), mvex)...)
+
+	// mehd is the first box in mvex, which is the last in moov
+	m.mehd = uint64(len(ftyp)+len(moov)-len(mvex)) + 8 + 12
+	if i := bytes.Index(moov, []byte("avc1")); seekable && i >= 0 {
+		m.avc1 = uint64(len(ftyp) + i)
+	}
+
+	if err := m.write(ftyp); err != nil {
+		return err
+	}
+
+	return m.write(moov)
+}
+
+func trak(t *track, avc3 bool) []byte {
+	var tkhd []byte
+	tkhd = appendUint32(tkhd, 0)
+	tkhd = appendUint32(tkhd, 0)
+	tkhd = appendUint32(tkhd, uint32(t.id))
+	tkhd = appendUint32(tkhd, 0)
+	tkhd = appendUint32(tkhd, 0)
+	tkhd = append(tkhd, make([]byte, 8)...)
+	tkhd = appendUint16(tkhd, 0)
+	tkhd = appendUint16(tkhd, 0)
+	if t.kind == trackAudio {
+		tkhd = appendUint16(tkhd, 0x0100)
+	} else {
+		tkhd = appendUint16(tkhd, 0)
+	}
+	tkhd = appendUint16(tkhd, 0)
+	tkhd = append(tkhd, matrix()...)
+	tkhd = appendUint32(tkhd, uint32(t.width)<<16)
+	tkhd = appendUint32(tkhd, uint32(t.height)<<16)
+
+	var mdhd []byte
+	mdhd = appendUint32(mdhd, 0)
+	mdhd = appendUint32(mdhd, 0)
+	mdhd = appendUint32(mdhd, timescale)
+	mdhd = appendUint32(mdhd, 0)
+	mdhd = appendUint16(mdhd, 0x55c4) // und
+	mdhd = appendUint16(mdhd, 0)
+
+	handler, name, header := "vide", "VideoHandler", fullBox("vmhd", 0, 1, make([]byte, 8))
+	if t.kind == trackAudio {
+		handler, name, header = "soun", "SoundHandler", fullBox("smhd", 0, 0, make([]byte, 4))
+	}
+	hdlr := fullBox("hdlr", 0, 0, make([]byte, 4), []byte(handler), make([]byte, 12), []byte(name), []byte{0})
+
+	dinf := box("dinf", fullBox("dref", 0, 0, appendUint32(nil, 1), fullBox("url ", 0, 1)))
+	stbl := box("stbl",
+		fullBox("stsd", 0, 0, appendUint32(nil, 1), sampleEntry(t, avc3)),
+		fullBox("stts", 0, 0, make([]byte, 4)),
+		fullBox("stsc", 0, 0, make([]byte, 4)),
+		fullBox("stsz", 0, 0, make([]byte, 8)),
+		fullBox("stco", 0, 0, make([]byte, 4)),
+	)
+
+	return box("trak",
+		fullBox("tkhd", 0, 3, tkhd),
+		box("mdia",
+			fullBox("mdhd", 0, 0, mdhd),
+			hdlr,
+			box("minf", header, dinf, stbl),
+		),
+	)
+}
+
+// sampleEntry is avc1 with the parameter sets in avcC, or avc3 where they
+// may also change in band.
+func sampleEntry(t *track, avc3 bool) []byte {
+	var e []byte
+	e = append(e, make([]byte, 6)...)
+	e = appendUint16(e, 1)
+
+	if t.kind == trackAudio {
+		e = append(e, make([]byte, 8)...)
+		e = appendUint16(e, uint16(t.channels))
+		e = appendUint16(e, 16)
+		e = appendUint32(e, 0)
+		if t.sampleRate <= 0xffff {
+			e = appendUint32(e, uint32(t.sampleRate)<<16)
+		} else {
+			// 16.16 fixed point cannot hold it, the esds config has the rate
+			e = appendUint32(e, 0)
+		}
+
+		return box("mp4a", e, esds(t.codec))
+	}
+
+	e = append(e, make([]byte, 16)...)
+	e = appendUint16(e, uint16(t.width))
+	e = appendUint16(e, uint16(t.height))
+	e = appendUint32(e, 0x00480000)
+	e = appendUint32(e, 0x00480000)
+	e = appendUint32(e, 0)
+	e = appendUint16(e, 1)
+	e = append(e, make([]byte, 32)...)
+	e = appendUint16(e, 0x0018)
+	e = appendUint16(e, 0xffff)
+
+	typ := "avc1"
+	if avc3 {
+		typ = "avc3"
+	}
+
+	return box(typ, e, box("avcC", t.codec))
+}
+
+func descriptor(tag byte, payload ...[]byte) []byte {
+	size := 0
+	for _, p := range payload {
+		size += len(p)
+	}
+
+	d := []byte{tag, byte(size)}
+	for _, p := range payload {
+		d = append(d, p...)
+	}
+
+	return d
+}
+
+func esds(config []byte) []byte {
+	return fullBox("esds", 0, 0,
+		descriptor(0x03, []byte{0, 0, 0},
+			descriptor(0x04, []byte{0x40, 0x15, 0, 0, 0}, make([]byte, 8),
+				descriptor(0x05, config),
+			),
+			descriptor(0x06, []byte{0x02}),
+		),
+	)
+}
+
+func (m *mp4Muxer) writeSample(t *track, s sample) error {
+	mt := m.byId[t.id]
+
+	if mt.last != nil {
+		mt.samples = append(mt.samples, *mt.last)
+	}
+	mt.last = &s
+	if s.pts > m.duration {
+		m.duration = s.pts
+	}
+
+	if t.kind == trackVideo && s.key && m.buffered() {
+		return m.fragment()
+	}
+
+	if len(m.tracks) == 1 && t.kind == trackAudio && len(mt.samples) > 0 && s.dts-mt.samples[0].dts >= fragmentDuration {
+		return m.fragment()
+	}
+
+	return nil
+}
+
+func (m *mp4Muxer) parametersChanged() bool {
+	for _, t := range m.tracks {
+		if t.parametersChanged {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *mp4Muxer) buffered() bool {
+	for _, t := range m.tracks {
+		if len(t.samples) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// duration of sample i, the last one repeats the one before.
+func (t *mp4Track) duration(i int) uint32 {
+	switch {
+	case i+1 < len(t.samples):
+		return uint32(t.samples[i+1].dts - t.samples[i].dts)
+	case t.last != nil:
+		return uint32(t.last.dts - t.samples[i].dts)
+	case i > 0:
+		return uint32(t.samples[i].dts - t.samples[i-1].dts)
+	}
+
+	return 0
+}
+
+func (m *mp4Muxer) moof(offsets []uint32) []byte {
+	trafs := [][]byte{fullBox("mfhd", 0, 0, appendUint32(nil, m.sequence))}
+	n := 0
+	for _, t := range m.tracks {
+		if len(t.samples) == 0 {
+			continue
+		}
+
+		trun := appendUint32(nil, uint32(len(t.samples)))
+		trun = appendUint32(trun, offsets[n])
+		for i, s := range t.samples {
+			flags := uint32(sampleFlagsSync)
+			if !s.key {
+				flags = sampleFlagsNonSync
+			}
+			trun = appendUint32(trun, t.duration(i))
+			trun = appendUint32(trun, uint32(len(s.data)))
+			trun = appendUint32(trun, flags)
+			trun = appendUint32(trun, uint32(int32(s.pts-s.dts)))
+		}
+
+		trafs = append(trafs, box("traf",
+			fullBox("tfhd", 0, 0x020000, appendUint32(nil, uint32(t.id))),
+			fullBox("tfdt", 1, 0, appendUint64(nil, uint64(t.samples[0].dts))),
+			fullBox("trun", 1, 0x000f01, trun),
+		))
+		n++
+	}
+
+	return box("moof", trafs...)
+}
+
+// fragment writes the complete samples of every track as one moof and mdat.
+func (m *mp4Muxer) fragment() error {
+	m.sequence++
+
+	var offsets []uint32
+	size := 0
+	for _, t := range m.tracks {
+		if len(t.samples) == 0 {
+			continue
+		}
+		offsets = append(offsets, 0)
+		for _, s := range t.samples {
+			size += len(s.data)
+		}
+	}
+
+	moofSize := uint32(len(m.moof(offsets)))
+	offset := moofSize + 8
+	n := 0
+	for _, t := range m.tracks {
+		if len(t.samples) == 0 {
+			continue
+		}
+		offsets[n] = offset
+		for _, s := range t.samples {
+			offset += uint32(len(s.data))
+		}
+		n++
+	}
+
+	if len(m.index.samples) > 0 {
+		m.fragments = append(m.fragments, mp4Fragment{time: uint64(m.index.samples[0].dts), offset: m.written})
+	}
+
+	if err := m.write(m.moof(offsets)); err != nil {
+		return err
+	}
+	if err := m.write(appendUint32([]byte{}, uint32(size+8))); err != nil {
+		return err
+	}
+	if err := m.write([]byte("mdat")); err != nil {
+		return err
+	}
+	for _, t := range m.tracks {
+		for _, s := range t.samples {
+			if err := m.write(s.data); err != nil {
+				return err
+			}
+		}
+		t.samples = t.samples[:0]
+	}
+
+	return nil
+}
+
+// close writes the last samples and a random access index, and fills in the
+// duration if the output is seekable.
+func (m *mp4Muxer) close() error {
+	for _, t := range m.tracks {
+		if t.last != nil {
+			t.samples = append(t.samples, *t.last)
+			t.last = nil
+		}
+	}
+	if m.buffered() {
+		if err := m.fragment(); err != nil {
+			return err
+		}
+	}
+	if len(m.tracks) == 0 {
+		return nil
+	}
+
+	tfra := appendUint32(nil, uint32(m.index.id))
+	tfra = appendUint32(tfra, 0)
+	tfra = appendUint32(tfra, uint32(len(m.fragments)))
+	for _, f := range m.fragments {
+		tfra = appendUint64(tfra, f.time)
+		tfra = appendUint64(tfra, f.offset)
+		tfra = append(tfra, 1, 1, 1)
+	}
+	tfraBox := fullBox("tfra", 1, 0, tfra)
+	mfra := box("mfra", tfraBox, fullBox("mfro", 0, 0, appendUint32(nil, uint32(8+len(tfraBox)+16))))
+	if err := m.write(mfra); err != nil {
+		return err
+	}
+
+	if ws, ok := m.w.(io.WriteSeeker); ok {
+		if m.avc1 > 0 && m.parametersChanged() {
+			if _, err := ws.Seek(int64(m.avc1), io.SeekStart); err != nil {
+				return err
+			}
+			if _, err := ws.Write([]byte("avc3")); err != nil {
+				return err
+			}
+		}
+		if _, err := ws.Seek(int64(m.mehd), io.SeekStart); err != nil {
+			return err
+		}
+		duration := make([]byte, 8)
+		binary.BigEndian.PutUint64(duration, uint64(m.duration))
+		if _, err := ws.Write(duration); err != nil {
+			return err
+		}
+		_, err := ws.Seek(0, io.SeekEnd)
+		return err
+	}
+
+	return nil
+}
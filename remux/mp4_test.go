@@ -0,0 +1,207 @@
+package remux
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+type mp4Box struct {
+	typ    string
+	offset int
+	data   []byte
+}
+
+// boxes splits b into boxes, failing on sizes that do not add up.
+func boxes(t *testing.T, b []byte, offset int) []mp4Box {
+	var list []mp4Box
+	for i := 0; i < len(b); {
+		if len(b)-i < 8 {
+			t.Fatalf("%d bytes left at %d, too short for a box", len(b)-i, offset+i)
+		}
+		size := int(binary.BigEndian.Uint32(b[i:]))
+		if size < 8 || i+size > len(b) {
+			t.Fatalf("Box %s at %d has size %d, %d bytes left", b[i+4:i+8], offset+i, size, len(b)-i)
+		}
+		list = append(list, mp4Box{typ: string(b[i+4 : i+8]), offset: offset + i, data: b[i : i+size]})
+		i += size
+	}
+
+	return list
+}
+
+func child(t *testing.T, parent mp4Box, header int, typ string) mp4Box {
+	for _, b := range boxes(t, parent.data[header:], parent.offset+header) {
+		if b.typ == typ {
+			return b
+		}
+	}
+	t.Fatalf("No %s in %s", typ, parent.typ)
+
+	return mp4Box{}
+}
+
+func mp4Tracks() (video, audio *track) {
+	video = &track{id: 1, kind: trackVideo, codec: avcConfig(sps1080, pps), width: 1920, height: 1080}
+	audio = &track{id: 2, kind: trackAudio, codec: []byte{0x12, 0x10}, sampleRate: 44100, channels: 2}
+
+	return video, audio
+}
+
+// writeMp4 muxes two fragments of interleaved video and audio.
+func writeMp4(t *testing.T, m *mp4Muxer, video, audio *track) {
+	if err := m.writeHeader([]*track{video, audio}); err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 6; i++ {
+		v := sample{dts: i * 3000, pts: i*3000 + 3000, key: i%3 == 0, data: bytes.Repeat([]byte{byte(0x10 + i)}, int(10+i))}
+		if err := m.writeSample(video, v); err != nil {
+			t.Fatal(err)
+		}
+		a := sample{dts: i * 2048, pts: i * 2048, key: true, data: bytes.Repeat([]byte{byte(0xa0 + i)}, 5)}
+		if err := m.writeSample(audio, a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMp4Layout(t *testing.T) {
+	w := &seekBuffer{}
+	m := newMp4Muxer(w)
+	video, audio := mp4Tracks()
+	writeMp4(t, m, video, audio)
+	b := w.Bytes()
+
+	var moofs []mp4Box
+	var mfra mp4Box
+	top := boxes(t, b, 0)
+	for i, box := range top {
+		switch box.typ {
+		case "moof":
+			moofs = append(moofs, box)
+			if i+1 == len(top) || top[i+1].typ != "mdat" {
+				t.Fatalf("moof at %d is not followed by mdat", box.offset)
+			}
+			mdat := top[i+1]
+
+			traf := 0
+			for _, tr := range boxes(t, box.data[8:], box.offset+8) {
+				if tr.typ != "traf" {
+					continue
+				}
+				trun := child(t, tr, 8, "trun")
+				count := binary.BigEndian.Uint32(trun.data[12:])
+				offset := int(binary.BigEndian.Uint32(trun.data[16:]))
+				if traf == 0 && offset != len(box.data)+8 {
+					t.Errorf("First data offset is %d, want the moof size %d plus 8", offset, len(box.data))
+				}
+				if box.offset+offset < mdat.offset+8 || box.offset+offset >= mdat.offset+len(mdat.data) {
+					t.Fatalf("Data offset %d points outside mdat", offset)
+				}
+
+				// the first sample size of each track, then its first byte
+				size := int(binary.BigEndian.Uint32(trun.data[24:]))
+				first := b[box.offset+offset]
+				if size == 5 && first&0xf0 != 0xa0 || size != 5 && first&0xf0 != 0x10 {
+					t.Errorf("Data offset %d of %d samples starts with %x", offset, count, first)
+				}
+				traf++
+			}
+			if traf != 2 {
+				t.Errorf("moof at %d has %d traf, want 2", box.offset, traf)
+			}
+		case "mfra":
+			mfra = box
+		}
+	}
+	if len(moofs) != 2 {
+		t.Fatalf("Got %d fragments, want one per keyframe", len(moofs))
+	}
+	if top[len(top)-1].typ != "mfra" {
+		t.Fatalf("Last box is %s, want mfra", top[len(top)-1].typ)
+	}
+
+	tfra := child(t, mfra, 8, "tfra")
+	if id := binary.BigEndian.Uint32(tfra.data[12:]); id != uint32(video.id) {
+		t.Errorf("Index is for track %d, want the video track", id)
+	}
+	if n := binary.BigEndian.Uint32(tfra.data[20:]); n != uint32(len(moofs)) {
+		t.Fatalf("Index has %d entries, want %d", n, len(moofs))
+	}
+	for i, moof := range moofs {
+		entry := tfra.data[24+i*19:]
+		if time := binary.BigEndian.Uint64(entry); time != uint64(i*3*3000) {
+			t.Errorf("Entry %d is at time %d, want %d", i, time, i*3*3000)
+		}
+		if offset := binary.BigEndian.Uint64(entry[8:]); offset != uint64(moof.offset) {
+			t.Errorf("Entry %d points to %d, want the moof at %d", i, offset, moof.offset)
+		}
+	}
+	mfro := child(t, mfra, 8, "mfro")
+	if size := binary.BigEndian.Uint32(mfro.data[12:]); size != uint32(len(mfra.data)) {
+		t.Errorf("mfro has size %d, want the mfra size %d", size, len(mfra.data))
+	}
+
+	moov := top[1]
+	mehd := child(t, child(t, moov, 8, "mvex"), 8, "mehd")
+	if uint64(mehd.offset+12) != m.mehd {
+		t.Errorf("Duration is patched at %d, want %d", m.mehd, mehd.offset+12)
+	}
+	if d := binary.BigEndian.Uint64(mehd.data[12:]); d != 18000 {
+		t.Errorf("Duration is %d, want 18000", d)
+	}
+}
+
+func sampleEntryType(t *testing.T, b []byte) string {
+	moov := boxes(t, b, 0)[1]
+	trak := child(t, moov, 8, "trak")
+	stbl := child(t, child(t, child(t, trak, 8, "mdia"), 8, "minf"), 8, "stbl")
+	stsd := child(t, stbl, 8, "stsd")
+
+	return boxes(t, stsd.data[16:], stsd.offset+16)[0].typ
+}
+
+func TestMp4ParametersChanged(t *testing.T) {
+	video, audio := mp4Tracks()
+	w := &seekBuffer{}
+	writeMp4(t, newMp4Muxer(w), video, audio)
+	if typ := sampleEntryType(t, w.Bytes()); typ != "avc1" {
+		t.Errorf("Sample entry is %s with unchanged parameter sets, want avc1", typ)
+	}
+
+	video, audio = mp4Tracks()
+	video.parametersChanged = true
+	w = &seekBuffer{}
+	writeMp4(t, newMp4Muxer(w), video, audio)
+	if typ := sampleEntryType(t, w.Bytes()); typ != "avc3" {
+		t.Errorf("Sample entry is %s with changed parameter sets, want avc3", typ)
+	}
+
+	video, audio = mp4Tracks()
+	var buf bytes.Buffer
+	writeMp4(t, newMp4Muxer(&buf), video, audio)
+	if typ := sampleEntryType(t, buf.Bytes()); typ != "avc3" {
+		t.Errorf("Sample entry is %s on output that cannot be patched, want avc3", typ)
+	}
+}
+
+func TestMp4AudioSampleRate(t *testing.T) {
+	tests := []struct {
+		rate int
+		want uint32
+	}{
+		{44100, 44100 << 16},
+		{48000, 48000 << 16},
+		{96000, 0},
+	}
+
+	for _, tt := range tests {
+		e := sampleEntry(&track{kind: trackAudio, codec: []byte{0x10, 0x10}, sampleRate: tt.rate, channels: 2}, false)
+		if rate := binary.BigEndian.Uint32(e[32:]); rate != tt.want {
+			t.Errorf("Rate field for %d Hz is %#x, want %#x", tt.rate, rate, tt.want)
+		}
+	}
+}
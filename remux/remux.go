@@ -0,0 +1,348 @@
+package remux
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	FormatMP4 = "mp4"
+	FormatMKV = "mkv"
+
+	// timescale is the MPEG-TS clock rate, kept for all output timestamps.
+	timescale = 90000
+
+	// maxTimestampGap is the largest forward jump taken as regular timing,
+	// larger jumps and any going back are discontinuities.
+	maxTimestampGap = 10 * timescale
+	// maxHeaderSamples bounds the samples buffered while waiting for the
+	// codec configuration of every track.
+	maxHeaderSamples = 2000
+)
+
+const (
+	trackVideo = iota
+	trackAudio
+)
+
+type track struct {
+	id   int
+	kind int
+	// codec is the avcC record or AudioSpecificConfig.
+	codec []byte
+	// parametersChanged is set when a keyframe brings other SPS or PPS
+	// than codec, e.g. after an encoder restart. The samples keep them in
+	// band, which MP4 signals as avc3 and Matroska players pick up.
+	parametersChanged bool
+	sps, pps          []byte
+
+	width, height int
+	sampleRate    int
+	channels      int
+
+	timeline timeline
+}
+
+// Subtitle is text shown from Start to End.
+type Subtitle struct {
+	Start time.Duration
+	End   time.Duration
+	Text  string
+}
+
+type sample struct {
+	dts, pts int64
+	key      bool
+	data     []byte
+}
+
+type muxer interface {
+	writeHeader(tracks []*track) error
+	writeSample(t *track, s sample) error
+	close() error
+}
+
+// timeline unwraps the 33 bit timestamps of a track and removes jumps, so
+// the output plays continuously across discontinuities.
+type timeline struct {
+	started bool
+	raw     int64
+	last    int64
+	step    int64
+}
+
+func wrapDelta(d int64) int64 {
+	d &= 1<<33 - 1
+	if d >= 1<<32 {
+		d -= 1 << 33
+	}
+
+	return d
+}
+
+func (t *timeline) fix(dts, pts int64) (int64, int64) {
+	offset := wrapDelta(pts - dts)
+	if !t.started {
+		t.started = true
+		t.raw, t.last = dts, dts
+
+		return dts, dts + offset
+	}
+
+	delta := wrapDelta(dts - t.raw)
+	if delta <= 0 || delta > maxTimestampGap {
+		delta = t.step
+	} else {
+		t.step = delta
+	}
+	t.raw = dts
+	t.last += delta
+
+	return t.last, t.last + offset
+}
+
+// FormatOf returns the output format for the extension of path.
+func FormatOf(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp4", ".m4v":
+		return FormatMP4, nil
+	case ".mkv":
+		return FormatMKV, nil
+	}
+
+	return "", fmt.Errorf("Unknown output format %s (.mp4 or .mkv)", filepath.Ext(path))
+}
+
+// File remuxes the MPEG-TS file in to out, picking the format from the
+// extension of out.
+func File(in, out string) error {
+	return FileWithSubtitles(in, out, nil)
+}
+
+// FileWithSubtitles is File adding a subtitle track to Matroska output.
+func FileWithSubtitles(in, out string, subtitles []Subtitle) error {
+	format, err := FormatOf(out)
+	if err != nil {
+		return err
+	}
+
+	r, err := os.Open(in)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	if err := RemuxWithSubtitles(r, w, format, subtitles); err != nil {
+		w.Close()
+		os.Remove(out)
+		return err
+	}
+
+	return w.Close()
+}
+
+// Remux converts MPEG-TS with H.264 video and AAC audio to fragmented MP4 or
+// Matroska. Timestamps start at zero and continue across discontinuities.
+// If w is seekable the duration and seek index are filled in at the end.
+func Remux(r io.Reader, w io.Writer, format string) error {
+	return RemuxWithSubtitles(r, w, format, nil)
+}
+
+// RemuxWithSubtitles is Remux adding a text track, which only Matroska
+// supports.
+func RemuxWithSubtitles(r io.Reader, w io.Writer, format string, subtitles []Subtitle) error {
+	var m muxer
+	switch {
+	case format == FormatMP4 && len(subtitles) > 0:
+		return fmt.Errorf("Subtitles need the mkv format")
+	case format == FormatMP4:
+		m = newMp4Muxer(w)
+	case format == FormatMKV:
+		m = newMkvMuxer(w, subtitles)
+	default:
+		return fmt.Errorf("Unknown output format %s (mp4 or mkv)", format)
+	}
+
+	rm := &remuxer{
+		muxer:  m,
+		tracks: make(map[uint16]*track),
+	}
+	d := newDemuxer(r, rm.pes)
+	rm.demuxer = d
+	if err := d.run(); err != nil {
+		return err
+	}
+	if !rm.started {
+		if err := rm.start(); err != nil {
+			return err
+		}
+	}
+
+	return m.close()
+}
+
+type remuxer struct {
+	muxer   muxer
+	demuxer *demuxer
+
+	tracks  map[uint16]*track
+	sps     []byte
+	pps     []byte
+	started bool
+	// pending holds the samples read before the header is written.
+	pending []pendingSample
+	base    int64
+}
+
+type pendingSample struct {
+	track  *track
+	sample sample
+}
+
+func (rm *remuxer) track(p pes) *track {
+	t, ok := rm.tracks[p.pid]
+	if !ok {
+		t = &track{kind: trackVideo}
+		if p.streamType == streamTypeAAC {
+			t.kind = trackAudio
+		}
+		rm.tracks[p.pid] = t
+	}
+
+	return t
+}
+
+func (rm *remuxer) pes(p pes) error {
+	t := rm.track(p)
+	dts, pts := t.timeline.fix(p.dts, p.pts)
+
+	if t.kind == trackAudio {
+		headers, frames := splitAdts(p.data)
+		for i, frame := range frames {
+			if t.codec == nil {
+				t.codec = headers[i].audioSpecificConfig()
+				t.sampleRate = headers[i].sampleRate()
+				t.channels = headers[i].channels
+			}
+			offset := int64(i) * aacSamplesPerFrame * timescale / int64(headers[i].sampleRate())
+			if err := rm.sample(t, sample{dts: dts + offset, pts: pts + offset, key: true, data: frame}); err != nil {
+				return err
+			}
+		}
+		if len(frames) > 0 && t.timeline.step == 0 {
+			t.timeline.step = int64(len(frames)) * aacSamplesPerFrame * timescale / int64(headers[0].sampleRate())
+		}
+
+		return nil
+	}
+
+	nals := splitNals(p.data)
+	key := false
+	for _, nal := range nals {
+		if len(nal) == 0 {
+			continue
+		}
+		switch nal[0] & 0x1f {
+		case nalSps:
+			rm.sps = nal
+		case nalPps:
+			rm.pps = nal
+		case nalIdr:
+			key = true
+		}
+	}
+	if t.codec == nil {
+		if !key || rm.sps == nil || rm.pps == nil {
+			return nil
+		}
+		width, height, err := spsSize(rm.sps)
+		if err != nil {
+			return err
+		}
+		t.codec = avcConfig(rm.sps, rm.pps)
+		t.sps, t.pps = rm.sps, rm.pps
+		t.width, t.height = width, height
+	} else if key && (!bytes.Equal(rm.sps, t.sps) || !bytes.Equal(rm.pps, t.pps)) {
+		t.parametersChanged = true
+	}
+
+	return rm.sample(t, sample{dts: dts, pts: pts, key: key, data: avcSample(nals)})
+}
+
+func (rm *remuxer) sample(t *track, s sample) error {
+	if rm.started {
+		if t.id == 0 {
+			// a track without configuration when the header was written
+			return nil
+		}
+		s.dts -= rm.base
+		s.pts -= rm.base
+		if s.dts < 0 {
+			return nil
+		}
+
+		return rm.muxer.writeSample(t, s)
+	}
+
+	rm.pending = append(rm.pending, pendingSample{t, s})
+	for _, pid := range rm.demuxer.pids {
+		if t, ok := rm.tracks[pid]; !ok || t.codec == nil {
+			if len(rm.pending) < maxHeaderSamples {
+				return nil
+			}
+		}
+	}
+
+	return rm.start()
+}
+
+// start writes the header for the configured tracks, then the samples read
+// so far.
+func (rm *remuxer) start() error {
+	rm.started = true
+
+	var tracks []*track
+	for _, pid := range rm.demuxer.pids {
+		if t, ok := rm.tracks[pid]; ok && t.codec != nil {
+			t.id = len(tracks) + 1
+			tracks = append(tracks, t)
+		}
+	}
+	if len(tracks) == 0 {
+		return fmt.Errorf("No H.264 or AAC stream found")
+	}
+
+	first := true
+	for _, p := range rm.pending {
+		if p.track.id != 0 && (first || p.sample.dts < rm.base) {
+			rm.base = p.sample.dts
+			first = false
+		}
+	}
+	if err := rm.muxer.writeHeader(tracks); err != nil {
+		return err
+	}
+
+	pending := rm.pending
+	rm.pending = nil
+	sort.SliceStable(pending, func(i, j int) bool {
+		return pending[i].sample.dts < pending[j].sample.dts
+	})
+	for _, p := range pending {
+		if err := rm.sample(p.track, p.sample); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
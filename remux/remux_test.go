@@ -0,0 +1,106 @@
+package remux
+
+import (
+	"io"
+	"testing"
+)
+
+// seekBuffer is an in-memory io.WriteSeeker.
+type seekBuffer struct {
+	data []byte
+	pos  int
+}
+
+func (b *seekBuffer) Write(p []byte) (int, error) {
+	if end := b.pos + len(p); end > len(b.data) {
+		b.data = append(b.data, make([]byte, end-len(b.data))...)
+	}
+	n := copy(b.data[b.pos:], p)
+	b.pos += n
+
+	return n, nil
+}
+
+func (b *seekBuffer) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+		b.pos = int(offset)
+	case io.SeekCurrent:
+		b.pos += int(offset)
+	case io.SeekEnd:
+		b.pos = len(b.data) + int(offset)
+	}
+
+	return int64(b.pos), nil
+}
+
+func (b *seekBuffer) Bytes() []byte {
+	return b.data
+}
+
+type fakeMuxer struct {
+	tracks  []*track
+	samples []sample
+}
+
+func (m *fakeMuxer) writeHeader(tracks []*track) error {
+	m.tracks = tracks
+	return nil
+}
+
+func (m *fakeMuxer) writeSample(t *track, s sample) error {
+	m.samples = append(m.samples, s)
+	return nil
+}
+
+func (m *fakeMuxer) close() error { return nil }
+
+func accessUnit(nals ...[]byte) []byte {
+	var data []byte
+	for _, nal := range nals {
+		data = append(data, 0, 0, 0, 1)
+		data = append(data, nal...)
+	}
+
+	return data
+}
+
+func TestParametersChanged(t *testing.T) {
+	m := &fakeMuxer{}
+	rm := &remuxer{
+		muxer:   m,
+		demuxer: &demuxer{pids: []uint16{0x100}},
+		tracks:  make(map[uint16]*track),
+	}
+	idr := []byte{0x65, 0x88, 0x84}
+	units := [][]byte{
+		accessUnit([]byte{0x09, 0xf0}, sps1080, pps, idr),
+		accessUnit([]byte{0x41, 0x9a}),
+		accessUnit(sps1080, pps, idr),
+	}
+	for i, data := range units {
+		if err := rm.pes(pes{pid: 0x100, streamType: streamTypeH264, pts: int64(i) * 3000, dts: int64(i) * 3000, data: data}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(m.tracks) != 1 || m.tracks[0].width != 1920 || m.tracks[0].height != 1080 {
+		t.Fatalf("Header has tracks %+v, want one 1920x1080 video track", m.tracks)
+	}
+	if m.tracks[0].parametersChanged {
+		t.Error("Repeated parameter sets were taken as a change")
+	}
+
+	if err := rm.pes(pes{pid: 0x100, streamType: streamTypeH264, pts: 9000, dts: 9000, data: accessUnit(sps64, pps, idr)}); err != nil {
+		t.Fatal(err)
+	}
+	if !m.tracks[0].parametersChanged {
+		t.Error("A new SPS was not noticed")
+	}
+	if len(m.samples) != 4 {
+		t.Fatalf("Wrote %d samples, want 4", len(m.samples))
+	}
+	if last := m.samples[3].data; len(last) < 4+len(sps64) || last[4] != 0x67 {
+		t.Errorf("Keyframe after the change does not start with its SPS in band: %x", last)
+	}
+}
@@ -0,0 +1,231 @@
+package remux
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+const (
+	tsPacketSize = 188
+	tsSyncByte   = 0x47
+
+	streamTypeAAC  = 0x0f
+	streamTypeH264 = 0x1b
+)
+
+// pes is a reassembled packetized elementary stream packet with 90kHz
+// timestamps, not yet unwrapped.
+type pes struct {
+	pid        uint16
+	streamType byte
+	pts, dts   int64
+	data       []byte
+}
+
+type pesBuffer struct {
+	streamType byte
+	data       []byte
+}
+
+// demuxer reads MPEG-TS packets, following the first program of the PAT.
+type demuxer struct {
+	r       *bufio.Reader
+	pmtPid  int
+	streams map[uint16]*pesBuffer
+	// pids lists the elementary streams in PMT order.
+	pids []uint16
+	// onPes is called for every complete packet of a known stream.
+	onPes func(p pes) error
+}
+
+func newDemuxer(r io.Reader, onPes func(p pes) error) *demuxer {
+	return &demuxer{
+		r:       bufio.NewReaderSize(r, 1<<16),
+		pmtPid:  -1,
+		streams: make(map[uint16]*pesBuffer),
+		onPes:   onPes,
+	}
+}
+
+// run demuxes until the end of the input, skipping garbage between packets.
+func (d *demuxer) run() error {
+	packet := make([]byte, tsPacketSize)
+	for {
+		b, err := d.r.ReadByte()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if b != tsSyncByte {
+			continue
+		}
+
+		packet[0] = b
+		if _, err := io.ReadFull(d.r, packet[1:]); err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if err := d.packet(packet); err != nil {
+			return err
+		}
+	}
+
+	for _, pid := range d.pids {
+		if err := d.flush(pid); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *demuxer) packet(p []byte) error {
+	if p[1]&0x80 != 0 {
+		// transport error indicator
+		return nil
+	}
+	start := p[1]&0x40 != 0
+	pid := uint16(p[1]&0x1f)<<8 | uint16(p[2])
+	control := (p[3] >> 4) & 0x03
+
+	payload := p[4:]
+	if control&0x02 != 0 {
+		n := int(p[4]) + 1
+		if n > len(payload) {
+			return nil
+		}
+		payload = payload[n:]
+	}
+	if control&0x01 == 0 || len(payload) == 0 {
+		return nil
+	}
+
+	switch {
+	case pid == 0:
+		if start {
+			d.parsePat(payload)
+		}
+	case int(pid) == d.pmtPid:
+		if start {
+			d.parsePmt(payload)
+		}
+	default:
+		s, ok := d.streams[pid]
+		if !ok {
+			return nil
+		}
+		if start {
+			if err := d.flush(pid); err != nil {
+				return err
+			}
+			s.data = append(s.data[:0], payload...)
+		} else if len(s.data) > 0 {
+			s.data = append(s.data, payload...)
+		}
+	}
+
+	return nil
+}
+
+// section skips the pointer field and returns the section up to its CRC.
+func section(payload []byte) []byte {
+	n := int(payload[0]) + 1
+	if n+3 > len(payload) {
+		return nil
+	}
+	s := payload[n:]
+	length := int(s[1]&0x0f)<<8 | int(s[2])
+	if length < 4 || 3+length > len(s) {
+		return nil
+	}
+
+	return s[:3+length-4]
+}
+
+func (d *demuxer) parsePat(payload []byte) {
+	s := section(payload)
+	if len(s) < 8 {
+		return
+	}
+	for i := 8; i+4 <= len(s); i += 4 {
+		program := int(s[i])<<8 | int(s[i+1])
+		if program != 0 {
+			d.pmtPid = int(s[i+2]&0x1f)<<8 | int(s[i+3])
+			return
+		}
+	}
+}
+
+func (d *demuxer) parsePmt(payload []byte) {
+	s := section(payload)
+	if len(s) < 12 {
+		return
+	}
+	infoLength := int(s[10]&0x0f)<<8 | int(s[11])
+	for i := 12 + infoLength; i+5 <= len(s); {
+		streamType := s[i]
+		pid := uint16(s[i+1]&0x1f)<<8 | uint16(s[i+2])
+		esLength := int(s[i+3]&0x0f)<<8 | int(s[i+4])
+		i += 5 + esLength
+
+		if streamType != streamTypeH264 && streamType != streamTypeAAC {
+			continue
+		}
+		if _, ok := d.streams[pid]; !ok {
+			d.streams[pid] = &pesBuffer{streamType: streamType}
+			d.pids = append(d.pids, pid)
+		}
+	}
+}
+
+func (d *demuxer) flush(pid uint16) error {
+	s := d.streams[pid]
+	if len(s.data) == 0 {
+		return nil
+	}
+	data := s.data
+	s.data = nil
+
+	p, err := parsePes(data)
+	if err != nil {
+		// drop broken packets, e.g. cut off at the start of a recording
+		return nil
+	}
+	p.pid = pid
+	p.streamType = s.streamType
+
+	return d.onPes(p)
+}
+
+func parsePes(data []byte) (pes, error) {
+	if len(data) < 9 || data[0] != 0 || data[1] != 0 || data[2] != 1 {
+		return pes{}, fmt.Errorf("Missing PES start code")
+	}
+
+	flags := data[7] >> 6
+	headerLength := int(data[8])
+	if 9+headerLength > len(data) || flags&0x02 == 0 || headerLength < 5 {
+		return pes{}, fmt.Errorf("Missing PES timestamp")
+	}
+	if flags == 0x03 && headerLength < 10 {
+		return pes{}, fmt.Errorf("Truncated PES decoding timestamp")
+	}
+
+	p := pes{
+		pts: readTimestamp(data[9:]),
+	}
+	p.dts = p.pts
+	if flags == 0x03 {
+		p.dts = readTimestamp(data[14:])
+	}
+	p.data = data[9+headerLength:]
+
+	return p, nil
+}
+
+func readTimestamp(b []byte) int64 {
+	return int64(b[0]>>1&0x07)<<30 | int64(b[1])<<22 | int64(b[2]>>1)<<15 | int64(b[3])<<7 | int64(b[4]>>1)
+}
@@ -0,0 +1,79 @@
+package remux
+
+import (
+	"bytes"
+	"testing"
+)
+
+// timestamp encodes a 33 bit PTS or DTS with its marker bits.
+func timestamp(prefix byte, ts int64) []byte {
+	return []byte{
+		prefix<<4 | byte(ts>>29)&0x0e | 1,
+		byte(ts >> 22),
+		byte(ts>>14)&0xfe | 1,
+		byte(ts >> 7),
+		byte(ts<<1) | 1,
+	}
+}
+
+func pesPacket(flags byte, header []byte, payload []byte) []byte {
+	p := []byte{0, 0, 1, 0xe0, 0, 0, 0x80, flags << 6, byte(len(header))}
+	p = append(p, header...)
+
+	return append(p, payload...)
+}
+
+func TestReadTimestamp(t *testing.T) {
+	if ts := readTimestamp([]byte{0x31, 0x00, 0x05, 0xbf, 0x21}); ts != 90000 {
+		t.Errorf("Timestamp is %d, want 90000", ts)
+	}
+
+	for _, want := range []int64{0, 1, 1<<32 - 1, 1 << 32, 0x123456789, 1<<33 - 1} {
+		if ts := readTimestamp(timestamp(2, want)); ts != want {
+			t.Errorf("Timestamp is %d, want %d", ts, want)
+		}
+	}
+}
+
+func TestParsePes(t *testing.T) {
+	payload := []byte{0, 0, 0, 1, 0x09, 0xf0}
+	pts := timestamp(3, 1<<32+3003)
+	dts := timestamp(1, 1<<32)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		pts, dts int64
+		err      bool
+	}{
+		{name: "PTS", data: pesPacket(2, timestamp(2, 90000), payload), pts: 90000, dts: 90000},
+		{name: "PTS and DTS", data: pesPacket(3, append(pts, dts...), payload), pts: 1<<32 + 3003, dts: 1 << 32},
+		{name: "stuffing", data: pesPacket(2, append(timestamp(2, 42), 0xff, 0xff), payload), pts: 42, dts: 42},
+		{name: "no start code", data: append([]byte{0, 1}, pesPacket(2, timestamp(2, 0), payload)[2:]...), err: true},
+		{name: "short", data: []byte{0, 0, 1, 0xe0, 0, 0, 0x80, 0x80}, err: true},
+		{name: "no PTS", data: pesPacket(0, nil, payload), err: true},
+		{name: "header past the end", data: pesPacket(2, timestamp(2, 0), nil)[:12], err: true},
+		{name: "DTS flag without DTS", data: pesPacket(3, timestamp(3, 0), payload), err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := parsePes(tt.data)
+			if tt.err {
+				if err == nil {
+					t.Errorf("Parsed PTS %d DTS %d, want an error", p.pts, p.dts)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.pts != tt.pts || p.dts != tt.dts {
+				t.Errorf("PTS %d DTS %d, want %d and %d", p.pts, p.dts, tt.pts, tt.dts)
+			}
+			if !bytes.Equal(p.data, payload) {
+				t.Errorf("Payload is %x, want %x", p.data, payload)
+			}
+		})
+	}
+}
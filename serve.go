@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli"
+
+	"github.com/hchagen/twitch-player/hls"
+	"github.com/hchagen/twitch-player/twitch"
+)
+
+var (
+	DefaultServeAddr   = ":8080"
+	DefaultServeWindow = 10
+)
+
+// streamResolver fetches a fresh access token and playlist for the quality on every call.
+func streamResolver(stream twitch.Stream, quality string) hls.Resolver {
+	resolve := variantResolver(stream)
+	return func() (string, error) {
+		return resolve(quality)
+	}
+}
+
+// variantResolver returns hls.ErrEnded once the stream is offline, which
+// Twitch only tells apart from other playlist errors through the API.
+func variantResolver(stream twitch.Stream) hls.VariantResolver {
+	return func(quality string) (string, error) {
+		uris, err := twitchClient().GetStreamUrls(stream.Channel.Name)
+		if err != nil {
+			if sd, serr := twitchClient().GetStreamData(stream.Channel.Id); serr == nil && sd.Stream.Id == 0 {
+				return "", hls.ErrEnded
+			}
+			return "", err
+		}
+		uri, err := findStreamUrl(uris, quality)
+		if err != nil {
+			return "", err
+		}
+
+		return uri.URI, nil
+	}
+}
+
+// newLiveFetcher sets up fetching the stream variant according to the
+// low-latency and adaptive flags, reporting the latency to out.
+func newLiveFetcher(ctx *cli.Context, stream twitch.Stream, uri twitch.StreamUrl, out io.Writer) (*hls.LiveFetcher, error) {
+	var fetcher *hls.LiveFetcher
+	if ctx.Bool("adaptive") {
+		a, err := newAdaptive(ctx, stream, uri)
+		if err != nil {
+			return nil, err
+		}
+		fetcher = hls.NewAdaptiveFetcher(segmentHttpClient, a)
+	} else {
+		fetcher = hls.NewLiveFetcher(segmentHttpClient, streamResolver(stream, uri.Quality))
+	}
+
+	if ctx.Bool("low-latency") {
+		fetcher.LowLatency = true
+		fetcher.OnSegment = latencyReporter(out)
+	}
+
+	return fetcher, nil
+}
+
+func printServeUrls(addr string) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return
+	}
+	if ip := net.ParseIP(host); host != "" && (ip == nil || !ip.IsUnspecified()) {
+		fmt.Printf("Serving on http://%s%s\n", addr, hls.MasterPlaylistPath)
+		return
+	}
+
+	addrs, _ := net.InterfaceAddrs()
+	for _, a := range addrs {
+		if ip, ok := a.(*net.IPNet); ok && ip.IP.To4() != nil {
+			fmt.Printf("Serving on http://%s%s\n", net.JoinHostPort(ip.IP.String(), port), hls.MasterPlaylistPath)
+		}
+	}
+}
+
+type relay struct {
+	fetcher  *hls.LiveFetcher
+	listener net.Listener
+	errs     chan error
+
+	mu     sync.Mutex
+	anchor time.Time
+}
+
+// startRelay serves the stream variant as HLS on addr until closed.
+func startRelay(ctx *cli.Context, stream twitch.Stream, uri twitch.StreamUrl, addr string, window int, out io.Writer) (*relay, error) {
+	fetcher, err := newLiveFetcher(ctx, stream, uri, out)
+	if err != nil {
+		return nil, err
+	}
+	if err := fetcher.Start(); err != nil {
+		return nil, err
+	}
+
+	server := hls.NewServer(hls.Variant{
+		Bandwidth:  uri.Bandwidth,
+		Resolution: uri.Resolution,
+		Name:       uri.Quality,
+	}, window)
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		fetcher.Close()
+		return nil, err
+	}
+
+	r := &relay{
+		fetcher:  fetcher,
+		listener: listener,
+		errs:     make(chan error, 2),
+	}
+	server.OnRequest = r.observe
+	go func() {
+		server.Feed(fetcher.Segments())
+		err := fetcher.Err()
+		if err == nil {
+			err = fmt.Errorf("Stream of %s ended", stream.Channel.Name)
+		}
+		r.errs <- err
+	}()
+	go func() {
+		r.errs <- http.Serve(listener, server)
+	}()
+
+	return r, nil
+}
+
+func (r *relay) Addr() string {
+	return r.listener.Addr().String()
+}
+
+// observe keeps the program date-time of the first segment requested, where
+// a single player starts playback.
+func (r *relay) observe(s hls.Segment) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.anchor.IsZero() {
+		r.anchor = s.ProgramDateTime
+	}
+}
+
+// Anchor is the program date-time at player position zero.
+func (r *relay) Anchor() (time.Time, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.anchor, !r.anchor.IsZero()
+}
+
+// Err yields when the stream ends or fails, or serving fails.
+func (r *relay) Err() <-chan error {
+	return r.errs
+}
+
+func (r *relay) Close() error {
+	r.listener.Close()
+	r.fetcher.Close()
+
+	return r.fetcher.Err()
+}
+
+func onServe(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("Please provide a channel name")
+	}
+
+	stream, uri, err := selectLiveStream(os.Stdout, ctx.Args()[0], ctx.String("quality"))
+	if err != nil {
+		return err
+	}
+
+	r, err := startRelay(ctx, stream, uri, ctx.String("addr"), ctx.Int("window"), os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Relaying %s %s (%s)...\n", stream.Channel.Name, uri.Resolution, uri.Quality)
+	printServeUrls(r.Addr())
+
+	signals := make(chan struct{})
+	go func() {
+		waitForSignal()
+		close(signals)
+	}()
+
+	select {
+	case err := <-r.Err():
+		r.Close()
+		return err
+	case <-signals:
+	}
+
+	return r.Close()
+}
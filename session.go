@@ -0,0 +1,456 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli"
+
+	"github.com/hchagen/twitch-player/hls"
+	"github.com/hchagen/twitch-player/mpris"
+	"github.com/hchagen/twitch-player/twitch"
+)
+
+// streamSession is the stream played by the stream command, which remote
+// controls can switch to another channel or quality.
+type streamSession struct {
+	ctx *cli.Context
+
+	mu      sync.Mutex
+	stream  twitch.Stream
+	uri     twitch.StreamUrl
+	uris    []twitch.StreamUrl
+	relay   *relay
+	chat    *chatOverlay
+	mpris   *mpris.Server
+	surf    *surfer
+	started bool
+	offline bool
+	notices int
+
+	outMu sync.Mutex
+	out   io.Writer
+
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+type streamStatus struct {
+	Channel    string    `json:"channel"`
+	Title      string    `json:"title"`
+	Game       string    `json:"game"`
+	Viewers    uint64    `json:"viewers"`
+	Started    time.Time `json:"started"`
+	Quality    string    `json:"quality"`
+	Resolution string    `json:"resolution"`
+	Qualities  []string  `json:"qualities"`
+	State      string    `json:"state"`
+	Offline    bool      `json:"offline,omitempty"`
+	Volume     int       `json:"volume"`
+	Muted      bool      `json:"muted"`
+	Fullscreen bool      `json:"fullscreen"`
+}
+
+func newStreamSession(ctx *cli.Context) *streamSession {
+	return &streamSession{
+		ctx:  ctx,
+		out:  os.Stdout,
+		done: make(chan struct{}),
+	}
+}
+
+// hasStatusLine reports whether the keyboard control shows the session status.
+func (s *streamSession) hasStatusLine() bool {
+	s.outMu.Lock()
+	defer s.outMu.Unlock()
+
+	_, ok := s.out.(*keyboardControl)
+
+	return ok
+}
+
+// SetOutput changes where the session prints, e.g. to keep the keyboard
+// control's status line intact.
+func (s *streamSession) SetOutput(w io.Writer) {
+	s.outMu.Lock()
+	s.out = w
+	s.outMu.Unlock()
+}
+
+func (s *streamSession) Write(p []byte) (int, error) {
+	s.outMu.Lock()
+	out := s.out
+	s.outMu.Unlock()
+
+	return out.Write(p)
+}
+
+// findLiveStream looks up a channel by its exact name without prompting,
+// picking the best quality if none is given.
+func findLiveStream(channelName, quality string) (twitch.Stream, []twitch.StreamUrl, twitch.StreamUrl, error) {
+	sr, err := twitchClient().GetChannelSearch(channelName, DefaultChannelResultLen)
+	if err != nil {
+		return twitch.Stream{}, nil, twitch.StreamUrl{}, err
+	}
+
+	var channel *twitch.Channel
+	for i, c := range sr.Channels {
+		if strings.EqualFold(c.Name, channelName) {
+			channel = &sr.Channels[i]
+			break
+		}
+	}
+	if channel == nil {
+		return twitch.Stream{}, nil, twitch.StreamUrl{}, fmt.Errorf("No channel named %s", channelName)
+	}
+
+	streamData, err := twitchClient().GetStreamData(channel.Id)
+	if err != nil {
+		return twitch.Stream{}, nil, twitch.StreamUrl{}, err
+	}
+	if streamData.Stream.Id == 0 {
+		return twitch.Stream{}, nil, twitch.StreamUrl{}, fmt.Errorf("No online stream found for channel %s", channelName)
+	}
+
+	uris, err := twitchClient().GetStreamUrls(streamData.Stream.Channel.Name)
+	if err != nil {
+		return twitch.Stream{}, nil, twitch.StreamUrl{}, err
+	}
+	uri, err := cappedStreamUrl(uris, quality)
+	if err != nil {
+		return twitch.Stream{}, nil, twitch.StreamUrl{}, err
+	}
+
+	return streamData.Stream, uris, uri, nil
+}
+
+// Play replaces the current stream, along with its relay and chat overlay.
+// The current ones keep running until the player switched successfully.
+func (s *streamSession) Play(stream twitch.Stream, uris []twitch.StreamUrl, uri twitch.StreamUrl) error {
+	source := uri
+	var r *relay
+	if s.ctx.Bool("low-latency") {
+		var err error
+		if r, err = startRelay(s.ctx, stream, uri, "127.0.0.1:0", DefaultLowLatencyWindow, s); err != nil {
+			return err
+		}
+		source.URI = "http://" + r.Addr() + hls.MasterPlaylistPath
+	}
+
+	var co *chatOverlay
+	if s.ctx.Bool("chat") {
+		var err error
+		if co, err = startChatOverlay(s.ctx, mediaPlayer(), stream.Channel.Name, s); err != nil {
+			if r != nil {
+				r.Close()
+			}
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	if err := s.load(stream, source); err != nil {
+		s.mu.Unlock()
+		if co != nil {
+			co.Close()
+		}
+		if r != nil {
+			r.Close()
+		}
+		return err
+	}
+	oldRelay, oldChat := s.relay, s.chat
+	s.relay, s.chat = r, co
+	s.stream, s.uris, s.uri, s.started, s.offline = stream, uris, uri, true, false
+	s.publishMetadata()
+	s.mu.Unlock()
+
+	if r != nil {
+		go s.watchRelay(r)
+	}
+	if !stream.Created.IsZero() {
+		fmt.Fprintf(s, "%s is live for %s\n", stream.Channel.DisplayName, formatUptime(time.Since(stream.Created)))
+	}
+
+	if oldChat != nil {
+		oldChat.Close()
+	}
+	if oldRelay != nil {
+		return oldRelay.Close()
+	}
+
+	return nil
+}
+
+// load starts the player on the first stream, or switches it to source.
+func (s *streamSession) load(stream twitch.Stream, source twitch.StreamUrl) error {
+	if !s.started {
+		return playStreamUrl(s.ctx, stream.Channel.Name, source)
+	}
+
+	fmt.Fprintf(s, "Switching to %s %s (%s)...\n", stream.Channel.Name, source.Resolution, source.Quality)
+	if err := mediaPlayer().LoadFromUrl(source.URI); err != nil {
+		return err
+	}
+
+	return mediaPlayer().Play()
+}
+
+// watchRelay reports the end of the low-latency relay, unless it was
+// replaced or closed meanwhile.
+func (s *streamSession) watchRelay(r *relay) {
+	err := <-r.Err()
+
+	s.mu.Lock()
+	current := s.relay == r
+	if current {
+		s.offline = true
+	}
+	s.mu.Unlock()
+
+	if current {
+		fmt.Fprintf(s, "Low latency relay stopped: %s\n", err.Error())
+	}
+}
+
+// SetSurfer enables Next and Previous.
+func (s *streamSession) SetSurfer(surf *surfer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.surf = surf
+	if s.mpris != nil {
+		s.mpris.SetNavigation(s.Next, s.Previous)
+	}
+}
+
+func (s *streamSession) surfer() (*surfer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.surf == nil {
+		return nil, fmt.Errorf("Not surfing, start the stream with --surf")
+	}
+
+	return s.surf, nil
+}
+
+func (s *streamSession) Next() error {
+	surf, err := s.surfer()
+	if err != nil {
+		return err
+	}
+
+	return surf.Next()
+}
+
+func (s *streamSession) Previous() error {
+	surf, err := s.surfer()
+	if err != nil {
+		return err
+	}
+
+	return surf.Previous()
+}
+
+// SetMpris publishes the stream to desktop media controls, which can also stop it.
+func (s *streamSession) SetMpris(m *mpris.Server) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m.OnStop = s.Stop
+	if s.surf != nil {
+		m.SetNavigation(s.Next, s.Previous)
+	}
+	s.mpris = m
+	s.publishMetadata()
+}
+
+func (s *streamSession) publishMetadata() {
+	if s.mpris == nil || !s.started {
+		return
+	}
+
+	s.mpris.SetMetadata(mpris.Metadata{
+		Id:     strconv.FormatUint(s.stream.Channel.Id, 10),
+		Title:  s.stream.Channel.Status,
+		Artist: s.stream.Channel.DisplayName,
+		Album:  s.stream.Game,
+		ArtUrl: s.stream.Channel.Logo,
+		Url:    s.stream.Channel.Url,
+	})
+}
+
+// SwitchChannel picks the quality remembered for the channel, or else the
+// current one, unless given.
+func (s *streamSession) SwitchChannel(channel, quality string) error {
+	if quality == "" {
+		if q, ok := qualityPrefs().Get(channel); ok {
+			quality = q
+		} else {
+			quality = s.Status().Quality
+		}
+	}
+
+	stream, uris, uri, err := findLiveStream(channel, quality)
+	if err != nil {
+		return err
+	}
+
+	return s.Play(stream, uris, uri)
+}
+
+// SwitchQuality re-uses the variants of the last fetched master playlist,
+// unless their access token has expired, and remembers the quality for the
+// channel.
+func (s *streamSession) SwitchQuality(quality string) error {
+	s.mu.Lock()
+	stream, uris := s.stream, s.uris
+	s.mu.Unlock()
+
+	uri, err := findStreamUrl(uris, quality)
+	if err != nil {
+		return err
+	}
+	if _, err := hls.FetchMediaPlaylist(segmentHttpClient, uri.URI); err != nil {
+		if _, ok := err.(hls.StatusError); !ok {
+			return err
+		}
+		if uris, err = twitchClient().GetStreamUrls(stream.Channel.Name); err != nil {
+			return err
+		}
+		if uri, err = findStreamUrl(uris, quality); err != nil {
+			return err
+		}
+	}
+
+	if err := s.Play(stream, uris, uri); err != nil {
+		return err
+	}
+
+	return qualityPrefs().Set(stream.Channel.Name, uri.Quality)
+}
+
+// Reload fetches a new master playlist and plays the current quality again.
+func (s *streamSession) Reload() error {
+	s.mu.Lock()
+	stream, quality := s.stream, s.uri.Quality
+	s.mu.Unlock()
+
+	uris, err := twitchClient().GetStreamUrls(stream.Channel.Name)
+	if err != nil {
+		return err
+	}
+	uri, err := findStreamUrl(uris, quality)
+	if err != nil {
+		return err
+	}
+
+	return s.Play(stream, uris, uri)
+}
+
+func (s *streamSession) Status() streamStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := streamStatus{
+		Channel:    s.stream.Channel.Name,
+		Title:      s.stream.Channel.Status,
+		Game:       s.stream.Game,
+		Viewers:    s.stream.Viewers,
+		Started:    s.stream.Created,
+		Quality:    s.uri.Quality,
+		Resolution: s.uri.Resolution,
+		Offline:    s.offline,
+	}
+	for _, uri := range s.uris {
+		status.Qualities = append(status.Qualities, uri.Quality)
+	}
+	if state, err := mediaPlayer().State(); err == nil {
+		status.State = string(state)
+	}
+	status.Volume, _ = mediaPlayer().Volume()
+	status.Muted, _ = mediaPlayer().IsMuted()
+	status.Fullscreen, _ = mediaPlayer().IsFullscreen()
+
+	return status
+}
+
+// Refresh updates the stream data, e.g. the viewer count and title, and marks
+// the session offline when the stream ends.
+func (s *streamSession) Refresh() error {
+	s.mu.Lock()
+	id, name := s.stream.Channel.Id, s.stream.Channel.Name
+	s.mu.Unlock()
+
+	streamData, err := twitchClient().GetStreamData(id)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if streamData.Stream.Id == 0 {
+		if s.stream.Channel.Id == id {
+			s.offline = true
+		}
+		return fmt.Errorf("Stream of %s went offline", name)
+	}
+	if s.stream.Channel.Id == id {
+		s.stream = streamData.Stream
+		s.publishMetadata()
+	}
+
+	return nil
+}
+
+func (s *streamSession) ToggleFullscreen() error {
+	fs, err := mediaPlayer().IsFullscreen()
+	if err != nil {
+		return err
+	}
+	if fs {
+		return mediaPlayer().ExitFullscreen()
+	}
+
+	return mediaPlayer().EnterFullscreen()
+}
+
+// Stop ends the session, as if the process was signalled.
+func (s *streamSession) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+func (s *streamSession) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *streamSession) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closeStream()
+}
+
+func (s *streamSession) closeStream() (res error) {
+	if s.chat != nil {
+		res = s.chat.Close()
+		s.chat = nil
+	}
+	if s.relay != nil {
+		if err := s.relay.Close(); err != nil {
+			res = err
+		}
+		s.relay = nil
+	}
+
+	return res
+}
@@ -2,70 +2,100 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"syscall"
 
 	"github.com/urfave/cli"
-)
 
-func onStream(ctx *cli.Context) error {
-	if ctx.NArg() != 1 {
-		return fmt.Errorf("Please provide a channel name")
-	}
-
-	channelName := ctx.Args()[0]
+	"github.com/hchagen/twitch-player/mpris"
+	"github.com/hchagen/twitch-player/twitch"
+)
 
+func selectChannel(out io.Writer, channelName string) (channel twitch.Channel, err error) {
 	sr, err := twitchClient().GetChannelSearch(channelName, DefaultChannelResultLen)
 	if err != nil {
-		return err
+		return channel, err
 	}
 
 	if len(sr.Channels) == 0 {
-		return fmt.Errorf("No channels found for %s", channelName)
+		return channel, fmt.Errorf("No channels found for %s", channelName)
 	}
 
 	var chanSelection int
 	if sr.Channels[0].Name != channelName {
-		fmt.Printf("No channels found for %s. Did you possibly mean...\n\n", ctx.Args()[0])
+		fmt.Fprintf(out, "No channels found for %s. Did you possibly mean...\n\n", channelName)
 		for i, c := range sr.Channels {
-			fmt.Printf("[%d - %s] %s (id %d)?\n", i, c.Name, c.DisplayName, c.Id)
+			fmt.Fprintf(out, "[%d - %s] %s (id %d)?\n", i, c.Name, c.DisplayName, c.Id)
 		}
-		chanSelection = getNumericInput(fmt.Sprintf("\nSelect stream channel: [0-%d]: ", len(sr.Channels)-1), len(sr.Channels)-1)
+		chanSelection = getNumericInput(out, fmt.Sprintf("\nSelect stream channel: [0-%d]: ", len(sr.Channels)-1), len(sr.Channels)-1)
 	}
 
-	channel := sr.Channels[chanSelection]
+	return sr.Channels[chanSelection], nil
+}
 
-	streamData, err := twitchClient().GetStreamData(channel.Id)
+// selectLiveStream resolves a channel to an online stream and a variant, prompting
+// for the quality unless given, on out.
+func selectLiveStream(out io.Writer, channelName, quality string) (twitch.Stream, twitch.StreamUrl, error) {
+	stream, _, uri, err := selectLiveStreamUrls(out, channelName, quality)
+	return stream, uri, err
+}
+
+// selectLiveStreamUrls is selectLiveStream, also returning all variants.
+func selectLiveStreamUrls(out io.Writer, channelName, quality string) (twitch.Stream, []twitch.StreamUrl, twitch.StreamUrl, error) {
+	channel, err := selectChannel(out, channelName)
 	if err != nil {
-		return err
+		return twitch.Stream{}, nil, twitch.StreamUrl{}, err
 	}
 
+	streamData, err := twitchClient().GetStreamData(channel.Id)
+	if err != nil {
+		return twitch.Stream{}, nil, twitch.StreamUrl{}, err
+	}
 	if streamData.Stream.Id == 0 {
-		return fmt.Errorf("No online stream found for channel %s", ctx.Args()[0])
+		return twitch.Stream{}, nil, twitch.StreamUrl{}, fmt.Errorf("No online stream found for channel %s", channelName)
 	}
 
 	uris, err := twitchClient().GetStreamUrls(streamData.Stream.Channel.Name)
 	if err != nil {
-		return err
+		return twitch.Stream{}, nil, twitch.StreamUrl{}, err
 	}
-	fmt.Printf("\n%s playing %s for %d viewers: %s\n\n",
+	fmt.Fprintf(out, "\n%s playing %s for %d viewers: %s\n\n",
 		streamData.Stream.Channel.DisplayName,
 		streamData.Stream.Game,
 		streamData.Stream.Viewers,
 		streamData.Stream.Channel.Status,
 	)
+
+	if quality != "" {
+		uri, err := findStreamUrl(uris, quality)
+		return streamData.Stream, uris, uri, err
+	}
+
+	return streamData.Stream, uris, selectStreamUrl(out, uris), nil
+}
+
+func selectStreamUrl(out io.Writer, uris []twitch.StreamUrl) twitch.StreamUrl {
 	for i, uri := range uris {
-		fmt.Printf("[%d]: %s (%s, %dkbps)\n", i, uri.Resolution, uri.Quality, uri.Bandwidth/1024)
+		if uri.Bandwidth == 0 {
+			fmt.Fprintf(out, "[%d]: %s (%s)\n", i, uri.Resolution, uri.Quality)
+			continue
+		}
+		fmt.Fprintf(out, "[%d]: %s (%s, %dkbps)\n", i, uri.Resolution, uri.Quality, uri.Bandwidth/1024)
 	}
 
-	streamSelection := getNumericInput(fmt.Sprintf("\nSelect stream format: [0-%d]: ", len(uris)-1), len(uris)-1)
+	streamSelection := getNumericInput(out, fmt.Sprintf("\nSelect stream format: [0-%d]: ", len(uris)-1), len(uris)-1)
 
-	fmt.Printf("Loading %s %s (%s)...\n", channel.Name, uris[streamSelection].Resolution, uris[streamSelection].Quality)
-	if err := mediaPlayer().LoadFromUrl(uris[streamSelection].URI); err != nil {
+	return uris[streamSelection]
+}
+
+func playStreamUrl(ctx *cli.Context, name string, uri twitch.StreamUrl) error {
+	fmt.Printf("Loading %s %s (%s)...\n", name, uri.Resolution, uri.Quality)
+	if err := mediaPlayer().LoadFromUrl(uri.URI); err != nil {
 		return err
 	}
-	fmt.Printf("Playing %s %s (%s)...\n", channel.Name, uris[streamSelection].Resolution, uris[streamSelection].Quality)
+	fmt.Printf("Playing %s %s (%s)...\n", name, uri.Resolution, uri.Quality)
 	if err := mediaPlayer().Play(); err != nil {
 		return err
 	}
@@ -76,7 +106,11 @@ func onStream(ctx *cli.Context) error {
 		}
 	}
 
-	sigchan := make(chan os.Signal)
+	return nil
+}
+
+func waitForSignal() {
+	sigchan := make(chan os.Signal, 1)
 	signal.Notify(sigchan, syscall.SIGABRT, syscall.SIGINT, syscall.SIGTERM)
 	sig := <-sigchan
 	switch sig {
@@ -87,6 +121,102 @@ func onStream(ctx *cli.Context) error {
 	case syscall.SIGTERM:
 		fmt.Println("Stream terminated!")
 	}
+}
+
+// playSelectedStream uses the quality given or remembered for the channel,
+// prompting for it otherwise.
+func playSelectedStream(ctx *cli.Context, session *streamSession, channel string) error {
+	quality := ctx.String("quality")
+	remembered := false
+	if quality == "" {
+		quality, remembered = qualityPrefs().Get(channel)
+	}
+
+	stream, uris, uri, err := selectLiveStreamUrls(os.Stdout, channel, quality)
+	if err != nil && remembered && len(uris) > 0 {
+		fmt.Printf("%s, please pick another\n", err.Error())
+		uri, err = selectStreamUrl(os.Stdout, uris), nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := qualityPrefs().Set(stream.Channel.Name, uri.Quality); err != nil {
+		return err
+	}
+
+	return session.Play(stream, uris, uri)
+}
+
+// signalled closes once waitForSignal returns.
+func signalled() <-chan struct{} {
+	signals := make(chan struct{})
+	go func() {
+		waitForSignal()
+		close(signals)
+	}()
+
+	return signals
+}
+
+func onStream(ctx *cli.Context) error {
+	session := newStreamSession(ctx)
+	defer session.Close()
+
+	if ctx.Bool("surf") {
+		if ctx.NArg() > 1 {
+			return fmt.Errorf("Please provide at most one channel name to start surfing at")
+		}
+		if err := startSurfing(ctx, session); err != nil {
+			return err
+		}
+	} else {
+		if ctx.NArg() != 1 {
+			return fmt.Errorf("Please provide a channel name")
+		}
+		if err := playSelectedStream(ctx, session, ctx.Args()[0]); err != nil {
+			return err
+		}
+	}
+
+	go session.watchMetadata(ctx.Duration("refresh-interval"))
+
+	if !ctx.Bool("no-mpris") {
+		m, err := mpris.NewSessionServer(mediaPlayer())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Media keys unavailable: %s\n", err.Error())
+		} else {
+			defer m.Close()
+			session.SetMpris(m)
+		}
+	}
+
+	if cs, err := startControlSocket(session); err != nil {
+		fmt.Fprintf(os.Stderr, "Control socket unavailable: %s\n", err.Error())
+	} else {
+		defer cs.Close()
+	}
+
+	if addr := ctx.String("control-addr"); addr != "" {
+		c, err := startControlServer(session, addr, ctx.String("control-token"))
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+	}
+
+	k, err := startKeyboardControl(session)
+	if err != nil {
+		return err
+	}
+	if k != nil {
+		defer k.Close()
+	}
+
+	signals := signalled()
+	select {
+	case <-signals:
+	case <-session.Done():
+	}
 
 	return nil
 }
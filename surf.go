@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli"
+
+	"github.com/hchagen/twitch-player/twitch"
+)
+
+var DefaultSurfPrefetchTtl = 5 * time.Minute
+
+var surfFlags = []cli.Flag{
+	cli.BoolFlag{
+		Name:  "surf",
+		Usage: "Flip through the live channels of --game or --favourites with next/previous",
+	},
+	cli.StringFlag{
+		Name:  "game,g",
+		Usage: "Game whose top channels to surf",
+	},
+	cli.BoolFlag{
+		Name:  "favourites",
+		Usage: "Surf the channels listed in favourites.txt in the config directory, one per line",
+	},
+}
+
+type surfEntry struct {
+	stream  twitch.Stream
+	uris    []twitch.StreamUrl
+	uri     twitch.StreamUrl
+	fetched time.Time
+}
+
+// surfer switches the session between channels, looking up the channel after
+// the one playing in the background so switching ahead is fast.
+type surfer struct {
+	session  *streamSession
+	channels []string
+	quality  string
+
+	mu         sync.Mutex
+	current    int
+	prefetched map[string]surfEntry
+}
+
+func readFavourites() ([]string, error) {
+	f, err := os.Open(configPath("favourites.txt"))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("No favourites yet, add channel names to %s", configPath("favourites.txt"))
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var channels []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			channels = append(channels, line)
+		}
+	}
+
+	return channels, scanner.Err()
+}
+
+func surfChannels(ctx *cli.Context) ([]string, error) {
+	if ctx.Bool("favourites") {
+		return readFavourites()
+	}
+	if ctx.String("game") == "" {
+		return nil, fmt.Errorf("Surfing needs --game or --favourites")
+	}
+
+	streams, err := twitchClient().GetStreamList(ctx.String("game"), DefaultStreamResultLen)
+	if err != nil {
+		return nil, err
+	}
+
+	channels := make([]string, 0, len(streams.Streams))
+	for _, s := range streams.Streams {
+		channels = append(channels, s.Channel.Name)
+	}
+
+	return channels, nil
+}
+
+// startSurfing plays the given channel, or the first live one of the list.
+func startSurfing(ctx *cli.Context, session *streamSession) error {
+	channels, err := surfChannels(ctx)
+	if err != nil {
+		return err
+	}
+	if len(channels) == 0 {
+		return fmt.Errorf("No channels to surf")
+	}
+
+	start := 0
+	if ctx.NArg() == 1 {
+		start = -1
+		for i, c := range channels {
+			if strings.EqualFold(c, ctx.Args()[0]) {
+				start = i
+				break
+			}
+		}
+		if start < 0 {
+			channels = append([]string{ctx.Args()[0]}, channels...)
+			start = 0
+		}
+	}
+
+	s := &surfer{
+		session:    session,
+		channels:   channels,
+		quality:    ctx.String("quality"),
+		current:    start - 1,
+		prefetched: make(map[string]surfEntry),
+	}
+	session.SetSurfer(s)
+
+	fmt.Fprintf(s.session, "Surfing %d channels, n for next and b for previous\n", len(channels))
+
+	return s.Next()
+}
+
+func (s *surfer) Next() error {
+	return s.step(1)
+}
+
+func (s *surfer) Previous() error {
+	return s.step(-1)
+}
+
+// step skips channels that are offline, going around the list at most once.
+func (s *surfer) step(dir int) error {
+	s.mu.Lock()
+	current := s.current
+	s.mu.Unlock()
+
+	n := len(s.channels)
+	for tries := 1; tries <= n; tries++ {
+		i := ((current+dir*tries)%n + n) % n
+		e, err := s.lookup(s.channels[i])
+		if err != nil {
+			fmt.Fprintf(s.session, "Skipping %s: %s\n", s.channels[i], err.Error())
+			continue
+		}
+
+		fmt.Fprintf(s.session, "[%d/%d] %s playing %s for %d viewers: %s\n", i+1, n,
+			e.stream.Channel.DisplayName, e.stream.Game, e.stream.Viewers, e.stream.Channel.Status)
+		if err := s.session.Play(e.stream, e.uris, e.uri); err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		s.current = i
+		s.mu.Unlock()
+
+		go s.prefetch(s.channels[((i+dir)%n+n)%n])
+
+		return nil
+	}
+
+	return fmt.Errorf("None of the %d channels are live", n)
+}
+
+func (s *surfer) qualityFor(channel string) string {
+	if s.quality != "" {
+		return s.quality
+	}
+	if q, ok := qualityPrefs().Get(channel); ok {
+		return q
+	}
+
+	return s.session.Status().Quality
+}
+
+func (s *surfer) lookup(channel string) (surfEntry, error) {
+	s.mu.Lock()
+	e, ok := s.prefetched[channel]
+	delete(s.prefetched, channel)
+	s.mu.Unlock()
+
+	if ok && time.Since(e.fetched) < DefaultSurfPrefetchTtl {
+		return e, nil
+	}
+
+	stream, uris, uri, err := findLiveStream(channel, s.qualityFor(channel))
+	if err != nil {
+		return surfEntry{}, err
+	}
+
+	return surfEntry{stream, uris, uri, time.Now()}, nil
+}
+
+func (s *surfer) prefetch(channel string) {
+	stream, uris, uri, err := findLiveStream(channel, s.qualityFor(channel))
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.prefetched[channel] = surfEntry{stream, uris, uri, time.Now()}
+	s.mu.Unlock()
+}
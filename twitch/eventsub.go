@@ -0,0 +1,485 @@
+package twitch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	EventSubWebSocketUrl    = "wss://eventsub.wss.twitch.tv/ws"
+	EventSubSubscriptionUrl = "https://api.twitch.tv/helix/eventsub/subscriptions"
+
+	EventSubStreamOnline  = "stream.online"
+	EventSubStreamOffline = "stream.offline"
+	EventSubChannelUpdate = "channel.update"
+	EventSubRevocation    = "revocation"
+
+	eventSubWelcome      = "session_welcome"
+	eventSubKeepalive    = "session_keepalive"
+	eventSubNotification = "notification"
+	eventSubReconnect    = "session_reconnect"
+
+	eventSubWelcomeTimeout   = 10 * time.Second
+	eventSubKeepaliveGrace   = 5 * time.Second
+	eventSubReconnectRetries = 5
+	eventSubDedupeWindow     = 10 * time.Minute
+)
+
+var errEventSubClosed = fmt.Errorf("EventSub client closed")
+
+var eventSubVersions = map[string]string{
+	EventSubStreamOnline:  "1",
+	EventSubStreamOffline: "1",
+	EventSubChannelUpdate: "2",
+}
+
+type EventSub interface {
+	Connect() error
+	Subscribe(subscriptionType string, broadcasterId uint64) error
+
+	Events() <-chan EventSubEvent
+	Err() error
+
+	Close() error
+}
+
+type eventSubKey struct {
+	subscriptionType string
+	broadcasterId    string
+}
+
+type eventSubClient struct {
+	*http.Client
+
+	clientId    string
+	accessToken string
+
+	webSocketUrl    string
+	subscriptionUrl string
+	dialer          *websocket.Dialer
+
+	mu            sync.Mutex
+	conn          *websocket.Conn
+	session       EventSubSession
+	subscriptions map[eventSubKey]string
+	seen          map[string]time.Time
+	running       bool
+	err           error
+
+	events    chan EventSubEvent
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewEventSubClient(clientId, accessToken string, httpTimeout time.Duration) (EventSub, error) {
+	return NewEventSubClientWithUrls(clientId, accessToken, EventSubWebSocketUrl, EventSubSubscriptionUrl, httpTimeout)
+}
+
+func NewEventSubClientWithUrls(clientId, accessToken, webSocketUrl, subscriptionUrl string, httpTimeout time.Duration) (EventSub, error) {
+	if accessToken == "" {
+		return nil, fmt.Errorf("EventSub requires a user access token")
+	}
+
+	return &eventSubClient{
+		Client:          newHttpClient(httpTimeout, nil),
+		clientId:        clientId,
+		accessToken:     accessToken,
+		webSocketUrl:    webSocketUrl,
+		subscriptionUrl: subscriptionUrl,
+		dialer: &websocket.Dialer{
+			HandshakeTimeout: httpTimeout,
+		},
+		subscriptions: make(map[eventSubKey]string),
+		seen:          make(map[string]time.Time),
+		events:        make(chan EventSubEvent, 16),
+		done:          make(chan struct{}),
+	}, nil
+}
+
+func (c *eventSubClient) Events() <-chan EventSubEvent {
+	return c.events
+}
+
+func (c *eventSubClient) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.err
+}
+
+func (c *eventSubClient) Connect() error {
+	c.mu.Lock()
+	if c.running {
+		c.mu.Unlock()
+		return fmt.Errorf("EventSub already connected")
+	}
+	c.running = true
+	c.mu.Unlock()
+
+	if err := c.connect(c.webSocketUrl); err != nil {
+		c.mu.Lock()
+		if c.isClosed() {
+			// Close saw us running and left the events to run
+			close(c.events)
+		} else {
+			c.running = false
+		}
+		c.mu.Unlock()
+		return err
+	}
+
+	go c.run()
+
+	return nil
+}
+
+func (c *eventSubClient) Subscribe(subscriptionType string, broadcasterId uint64) error {
+	if _, ok := eventSubVersions[subscriptionType]; !ok {
+		return fmt.Errorf("Unsupported EventSub subscription type %s", subscriptionType)
+	}
+
+	key := eventSubKey{
+		subscriptionType: subscriptionType,
+		broadcasterId:    strconv.FormatUint(broadcasterId, 10),
+	}
+
+	c.mu.Lock()
+	if _, ok := c.subscriptions[key]; ok {
+		c.mu.Unlock()
+		return nil
+	}
+	c.subscriptions[key] = ""
+	sessionId := c.session.Id
+	c.mu.Unlock()
+
+	if sessionId == "" {
+		return nil
+	}
+
+	if err := c.createSubscription(key, sessionId); err != nil {
+		c.mu.Lock()
+		delete(c.subscriptions, key)
+		c.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+func (c *eventSubClient) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if c.conn != nil {
+			c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+			err = c.conn.Close()
+		}
+		if !c.running {
+			close(c.events)
+		}
+	})
+
+	return err
+}
+
+func (c *eventSubClient) dial(url string) (*websocket.Conn, EventSubSession, error) {
+	var msg EventSubMessage
+
+	conn, _, err := c.dialer.Dial(url, nil)
+	if err != nil {
+		return nil, EventSubSession{}, err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(eventSubWelcomeTimeout))
+	if err := conn.ReadJSON(&msg); err != nil {
+		conn.Close()
+		return nil, EventSubSession{}, fmt.Errorf("Waiting for EventSub welcome: %s", err.Error())
+	}
+
+	if msg.Metadata.MessageType != eventSubWelcome || msg.Payload.Session == nil {
+		conn.Close()
+		return nil, EventSubSession{}, fmt.Errorf("Expected EventSub welcome, got %s", msg.Metadata.MessageType)
+	}
+
+	return conn, *msg.Payload.Session, nil
+}
+
+// connect opens a fresh session, which starts without any subscriptions.
+func (c *eventSubClient) connect(url string) error {
+	conn, session, err := c.dial(url)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	if c.isClosed() {
+		c.mu.Unlock()
+		conn.Close()
+		return errEventSubClosed
+	}
+	old := c.conn
+	c.conn = conn
+	c.session = session
+	keys := make([]eventSubKey, 0, len(c.subscriptions))
+	for key := range c.subscriptions {
+		c.subscriptions[key] = ""
+		keys = append(keys, key)
+	}
+	c.mu.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+
+	// a failed subscription is reported on its own, the others and the
+	// session stay up
+	for _, key := range keys {
+		if err := c.createSubscription(key, session.Id); err != nil {
+			c.mu.Lock()
+			delete(c.subscriptions, key)
+			c.mu.Unlock()
+			c.emit(EventSubEvent{
+				Type: EventSubRevocation,
+				Subscription: EventSubSubscription{
+					Type:      key.subscriptionType,
+					Version:   eventSubVersions[key.subscriptionType],
+					Condition: EventSubCondition{BroadcasterUserId: key.broadcasterId},
+				},
+				Timestamp: time.Now(),
+				Err:       err,
+			})
+		}
+	}
+
+	return nil
+}
+
+// migrate follows a session_reconnect, which keeps existing subscriptions.
+func (c *eventSubClient) migrate(url string) error {
+	conn, session, err := c.dial(url)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	if c.isClosed() {
+		c.mu.Unlock()
+		conn.Close()
+		return errEventSubClosed
+	}
+	old := c.conn
+	c.conn = conn
+	c.session = session
+	c.mu.Unlock()
+
+	return old.Close()
+}
+
+func (c *eventSubClient) reconnect() error {
+	var err error
+	for i := 0; i < eventSubReconnectRetries; i++ {
+		select {
+		case <-c.done:
+			return nil
+		case <-time.After(time.Duration(i) * time.Second):
+		}
+
+		if err = c.connect(c.webSocketUrl); err == nil || err == errEventSubClosed {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Reconnecting to EventSub: %s", err.Error())
+}
+
+func (c *eventSubClient) run() {
+	defer close(c.events)
+
+	for {
+		c.mu.Lock()
+		conn := c.conn
+		timeout := time.Duration(c.session.KeepaliveTimeout)*time.Second + eventSubKeepaliveGrace
+		c.mu.Unlock()
+
+		var msg EventSubMessage
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		err := conn.ReadJSON(&msg)
+
+		if c.isClosed() {
+			return
+		}
+
+		if err == nil {
+			err = c.handle(msg)
+		} else {
+			err = c.reconnect()
+		}
+
+		if err != nil {
+			c.mu.Lock()
+			c.err = err
+			c.mu.Unlock()
+			return
+		}
+	}
+}
+
+func (c *eventSubClient) handle(msg EventSubMessage) error {
+	switch msg.Metadata.MessageType {
+	case eventSubKeepalive:
+		return nil
+	case eventSubReconnect:
+		if msg.Payload.Session == nil || msg.Payload.Session.ReconnectUrl == "" {
+			return c.reconnect()
+		}
+		if err := c.migrate(msg.Payload.Session.ReconnectUrl); err != nil {
+			return c.reconnect()
+		}
+		return nil
+	case eventSubNotification:
+		if c.isDuplicate(msg.Metadata) || msg.Payload.Subscription == nil {
+			return nil
+		}
+		if ev, err := decodeEventSubEvent(msg); err == nil {
+			c.emit(ev)
+		}
+		return nil
+	case EventSubRevocation:
+		if msg.Payload.Subscription == nil {
+			return nil
+		}
+		c.mu.Lock()
+		delete(c.subscriptions, eventSubKey{
+			subscriptionType: msg.Payload.Subscription.Type,
+			broadcasterId:    msg.Payload.Subscription.Condition.BroadcasterUserId,
+		})
+		c.mu.Unlock()
+		c.emit(EventSubEvent{
+			Type:         EventSubRevocation,
+			Subscription: *msg.Payload.Subscription,
+			Timestamp:    msg.Metadata.MessageTimestamp,
+		})
+		return nil
+	}
+
+	return nil
+}
+
+func (c *eventSubClient) isClosed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *eventSubClient) emit(ev EventSubEvent) {
+	select {
+	case c.events <- ev:
+	case <-c.done:
+	}
+}
+
+func (c *eventSubClient) isDuplicate(meta EventSubMetadata) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.seen[meta.MessageId]; ok {
+		return true
+	}
+
+	now := time.Now()
+	for id, t := range c.seen {
+		if now.Sub(t) > eventSubDedupeWindow {
+			delete(c.seen, id)
+		}
+	}
+	c.seen[meta.MessageId] = now
+
+	return false
+}
+
+func (c *eventSubClient) createSubscription(key eventSubKey, sessionId string) error {
+	body, err := json.Marshal(EventSubSubscription{
+		Type:    key.subscriptionType,
+		Version: eventSubVersions[key.subscriptionType],
+		Condition: EventSubCondition{
+			BroadcasterUserId: key.broadcasterId,
+		},
+		Transport: EventSubTransport{
+			Method:    "websocket",
+			SessionId: sessionId,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", c.subscriptionUrl, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Client-ID", c.clientId)
+	req.Header.Add("Authorization", "Bearer "+c.accessToken)
+	req.Header.Add("Content-Type", "application/json")
+
+	res, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusAccepted {
+		return ErrUnmarshal(fmt.Sprintf("Subscribing to %s for %s", key.subscriptionType, key.broadcasterId), res)
+	}
+
+	var sr EventSubSubscriptionResult
+	if err := json.NewDecoder(res.Body).Decode(&sr); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	if _, ok := c.subscriptions[key]; ok && len(sr.Data) > 0 {
+		c.subscriptions[key] = sr.Data[0].Id
+	}
+	c.mu.Unlock()
+
+	return nil
+}
+
+func decodeEventSubEvent(msg EventSubMessage) (ev EventSubEvent, err error) {
+	ev = EventSubEvent{
+		Type:         msg.Payload.Subscription.Type,
+		Subscription: *msg.Payload.Subscription,
+		Timestamp:    msg.Metadata.MessageTimestamp,
+	}
+
+	switch ev.Type {
+	case EventSubStreamOnline:
+		ev.Online = &StreamOnlineEvent{}
+		err = json.Unmarshal(msg.Payload.Event, ev.Online)
+	case EventSubStreamOffline:
+		ev.Offline = &StreamOfflineEvent{}
+		err = json.Unmarshal(msg.Payload.Event, ev.Offline)
+	case EventSubChannelUpdate:
+		ev.Update = &ChannelUpdateEvent{}
+		err = json.Unmarshal(msg.Payload.Event, ev.Update)
+	}
+	if err != nil {
+		return ev, fmt.Errorf("Decoding %s event: %s", ev.Type, err.Error())
+	}
+
+	return ev, nil
+}
@@ -0,0 +1,403 @@
+package twitch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const testTimeout = 5 * time.Second
+
+// fakeEventSub serves the EventSub WebSocket and the subscription endpoint,
+// handing each WebSocket connection and subscription request to the test.
+type fakeEventSub struct {
+	*httptest.Server
+
+	conns         chan *websocket.Conn
+	subscriptions chan *http.Request
+	bodies        chan EventSubSubscription
+
+	mu sync.Mutex
+	// reject is a subscription type refused with 403 Forbidden.
+	reject string
+	nextId int
+}
+
+func newFakeEventSub(t *testing.T) *fakeEventSub {
+	s := &fakeEventSub{
+		conns:         make(chan *websocket.Conn, 4),
+		subscriptions: make(chan *http.Request, 4),
+		bodies:        make(chan EventSubSubscription, 4),
+	}
+
+	upgrader := websocket.Upgrader{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		s.conns <- conn
+	})
+	mux.HandleFunc("/subscriptions", func(w http.ResponseWriter, r *http.Request) {
+		var sub EventSubSubscription
+		if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s.mu.Lock()
+		status := http.StatusAccepted
+		if sub.Type == s.reject {
+			status = http.StatusForbidden
+		}
+		s.nextId++
+		sub.Id = fmt.Sprintf("sub-%d", s.nextId)
+		s.mu.Unlock()
+
+		s.subscriptions <- r
+		s.bodies <- sub
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if status != http.StatusAccepted {
+			fmt.Fprint(w, `{"error":"Forbidden","status":403,"message":"subscription missing proper authorization"}`)
+			return
+		}
+		sub.Status = "enabled"
+		json.NewEncoder(w).Encode(EventSubSubscriptionResult{Data: []EventSubSubscription{sub}})
+	})
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *fakeEventSub) webSocketUrl() string {
+	return "ws" + strings.TrimPrefix(s.URL, "http") + "/ws"
+}
+
+func (s *fakeEventSub) client(t *testing.T) EventSub {
+	client, err := NewEventSubClientWithUrls("client-id", "access-token", s.webSocketUrl(), s.URL+"/subscriptions", testTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		for range client.Events() {
+		}
+	})
+
+	return client
+}
+
+func (s *fakeEventSub) accept(t *testing.T) *websocket.Conn {
+	select {
+	case conn := <-s.conns:
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	case <-time.After(testTimeout):
+		t.Fatal("Timed out waiting for the client to connect")
+	}
+
+	return nil
+}
+
+// welcome accepts a connection and starts session id on it.
+func (s *fakeEventSub) welcome(t *testing.T, id string) *websocket.Conn {
+	conn := s.accept(t)
+	send(t, conn, "welcome-"+id, eventSubWelcome, EventSubPayload{
+		Session: &EventSubSession{
+			Id:               id,
+			Status:           "connected",
+			KeepaliveTimeout: 10,
+		},
+	})
+
+	return conn
+}
+
+func (s *fakeEventSub) subscription(t *testing.T) (*http.Request, EventSubSubscription) {
+	select {
+	case r := <-s.subscriptions:
+		return r, <-s.bodies
+	case <-time.After(testTimeout):
+		t.Fatal("Timed out waiting for a subscription request")
+	}
+
+	return nil, EventSubSubscription{}
+}
+
+func (s *fakeEventSub) noSubscription(t *testing.T) {
+	select {
+	case <-s.subscriptions:
+		sub := <-s.bodies
+		t.Errorf("Unexpected %s subscription for session %s", sub.Type, sub.Transport.SessionId)
+	default:
+	}
+}
+
+func send(t *testing.T, conn *websocket.Conn, id, messageType string, payload EventSubPayload) {
+	msg := EventSubMessage{
+		Metadata: EventSubMetadata{
+			MessageId:        id,
+			MessageType:      messageType,
+			MessageTimestamp: time.Now().UTC(),
+		},
+		Payload: payload,
+	}
+	if payload.Subscription != nil {
+		msg.Metadata.SubscriptionType = payload.Subscription.Type
+		msg.Metadata.SubscriptionVersion = payload.Subscription.Version
+	}
+
+	if err := conn.WriteJSON(msg); err != nil {
+		t.Fatalf("Writing %s: %s", messageType, err)
+	}
+}
+
+func notify(t *testing.T, conn *websocket.Conn, id, subscriptionType string, event interface{}) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send(t, conn, id, eventSubNotification, EventSubPayload{
+		Subscription: &EventSubSubscription{
+			Id:        "sub-1",
+			Status:    "enabled",
+			Type:      subscriptionType,
+			Version:   eventSubVersions[subscriptionType],
+			Condition: EventSubCondition{BroadcasterUserId: "1234"},
+		},
+		Event: data,
+	})
+}
+
+func receive(t *testing.T, client EventSub) EventSubEvent {
+	select {
+	case ev, ok := <-client.Events():
+		if !ok {
+			t.Fatalf("Events closed: %v", client.Err())
+		}
+		return ev
+	case <-time.After(testTimeout):
+		t.Fatal("Timed out waiting for an event")
+	}
+
+	return EventSubEvent{}
+}
+
+func connect(t *testing.T, client EventSub, s *fakeEventSub, sessionId string) *websocket.Conn {
+	errc := make(chan error, 1)
+	go func() { errc <- client.Connect() }()
+
+	conn := s.welcome(t, sessionId)
+	r, sub := s.subscription(t)
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Header.Get("Client-ID") != "client-id" || r.Header.Get("Authorization") != "Bearer access-token" {
+		t.Errorf("Subscribed with Client-ID %q and Authorization %q", r.Header.Get("Client-ID"), r.Header.Get("Authorization"))
+	}
+	if sub.Type != EventSubStreamOnline || sub.Version != "1" || sub.Condition.BroadcasterUserId != "1234" {
+		t.Errorf("Subscribed to %s v%s for %s", sub.Type, sub.Version, sub.Condition.BroadcasterUserId)
+	}
+	if sub.Transport.Method != "websocket" || sub.Transport.SessionId != sessionId {
+		t.Errorf("Subscribed over %s for session %q, want websocket for %q", sub.Transport.Method, sub.Transport.SessionId, sessionId)
+	}
+
+	return conn
+}
+
+func TestEventSubNotifications(t *testing.T) {
+	s := newFakeEventSub(t)
+	client := s.client(t)
+
+	if err := client.Subscribe(EventSubStreamOnline, 1234); err != nil {
+		t.Fatal(err)
+	}
+	s.noSubscription(t)
+
+	conn := connect(t, client, s, "session-1")
+
+	send(t, conn, "keepalive-1", eventSubKeepalive, EventSubPayload{})
+	notify(t, conn, "message-1", EventSubStreamOnline, StreamOnlineEvent{
+		Id:                   "stream-1",
+		BroadcasterUserId:    "1234",
+		BroadcasterUserLogin: "channel",
+		Type:                 "live",
+	})
+
+	ev := receive(t, client)
+	if ev.Type != EventSubStreamOnline || ev.Online == nil {
+		t.Fatalf("Got %s event, want %s", ev.Type, EventSubStreamOnline)
+	}
+	if ev.Online.BroadcasterUserLogin != "channel" || ev.Online.Id != "stream-1" {
+		t.Errorf("Online event is %+v", *ev.Online)
+	}
+
+	notify(t, conn, "message-1", EventSubStreamOnline, StreamOnlineEvent{BroadcasterUserId: "1234"})
+	notify(t, conn, "message-2", EventSubChannelUpdate, ChannelUpdateEvent{
+		BroadcasterUserId: "1234",
+		Title:             "New title",
+		CategoryName:      "Just Chatting",
+	})
+
+	ev = receive(t, client)
+	if ev.Type != EventSubChannelUpdate || ev.Update == nil {
+		t.Fatalf("Got %s event after a duplicate, want %s", ev.Type, EventSubChannelUpdate)
+	}
+	if ev.Update.Title != "New title" || ev.Update.CategoryName != "Just Chatting" {
+		t.Errorf("Update event is %+v", *ev.Update)
+	}
+	if err := client.Err(); err != nil {
+		t.Errorf("Client failed: %s", err)
+	}
+}
+
+func TestEventSubReconnect(t *testing.T) {
+	s := newFakeEventSub(t)
+	client := s.client(t)
+
+	client.Subscribe(EventSubStreamOnline, 1234)
+	conn := connect(t, client, s, "session-1")
+
+	send(t, conn, "reconnect-1", eventSubReconnect, EventSubPayload{
+		Session: &EventSubSession{
+			Id:           "session-1",
+			Status:       "reconnecting",
+			ReconnectUrl: s.webSocketUrl(),
+		},
+	})
+
+	next := s.welcome(t, "session-2")
+
+	conn.SetReadDeadline(time.Now().Add(testTimeout))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+
+	notify(t, next, "message-1", EventSubStreamOffline, StreamOfflineEvent{
+		BroadcasterUserId:    "1234",
+		BroadcasterUserLogin: "channel",
+	})
+	ev := receive(t, client)
+	if ev.Type != EventSubStreamOffline || ev.Offline == nil || ev.Offline.BroadcasterUserLogin != "channel" {
+		t.Errorf("Got %s event after migrating, want %s", ev.Type, EventSubStreamOffline)
+	}
+
+	s.noSubscription(t)
+}
+
+func TestEventSubRevocation(t *testing.T) {
+	s := newFakeEventSub(t)
+	client := s.client(t)
+
+	client.Subscribe(EventSubStreamOnline, 1234)
+	conn := connect(t, client, s, "session-1")
+
+	send(t, conn, "revocation-1", EventSubRevocation, EventSubPayload{
+		Subscription: &EventSubSubscription{
+			Id:        "sub-1",
+			Status:    "authorization_revoked",
+			Type:      EventSubStreamOnline,
+			Version:   "1",
+			Condition: EventSubCondition{BroadcasterUserId: "1234"},
+		},
+	})
+
+	ev := receive(t, client)
+	if ev.Type != EventSubRevocation || ev.Subscription.Status != "authorization_revoked" {
+		t.Fatalf("Got %s event with status %q, want a revocation", ev.Type, ev.Subscription.Status)
+	}
+
+	if err := client.Subscribe(EventSubStreamOnline, 1234); err != nil {
+		t.Fatal(err)
+	}
+	if _, sub := s.subscription(t); sub.Transport.SessionId != "session-1" {
+		t.Errorf("Resubscribed for session %q, want %q", sub.Transport.SessionId, "session-1")
+	}
+}
+
+func TestEventSubSubscriptionFailed(t *testing.T) {
+	s := newFakeEventSub(t)
+	s.reject = EventSubChannelUpdate
+	client := s.client(t)
+
+	client.Subscribe(EventSubStreamOnline, 1234)
+	client.Subscribe(EventSubChannelUpdate, 1234)
+
+	errc := make(chan error, 1)
+	go func() { errc <- client.Connect() }()
+
+	conn := s.welcome(t, "session-1")
+	s.subscription(t)
+	s.subscription(t)
+	if err := <-errc; err != nil {
+		t.Fatalf("Connect failed with a rejected subscription: %s", err)
+	}
+
+	ev := receive(t, client)
+	if ev.Type != EventSubRevocation || ev.Subscription.Type != EventSubChannelUpdate {
+		t.Fatalf("Got %s event for %s, want a revocation for %s", ev.Type, ev.Subscription.Type, EventSubChannelUpdate)
+	}
+	if ev.Err == nil || !strings.Contains(ev.Err.Error(), "proper authorization") {
+		t.Errorf("Revocation error is %v, want the subscription error", ev.Err)
+	}
+
+	notify(t, conn, "message-1", EventSubStreamOnline, StreamOnlineEvent{BroadcasterUserId: "1234", Id: "stream-1"})
+	if ev := receive(t, client); ev.Type != EventSubStreamOnline {
+		t.Errorf("Got %s event, want %s on the same session", ev.Type, EventSubStreamOnline)
+	}
+
+	s.mu.Lock()
+	s.reject = ""
+	s.mu.Unlock()
+	if err := client.Subscribe(EventSubChannelUpdate, 1234); err != nil {
+		t.Fatal(err)
+	}
+	if _, sub := s.subscription(t); sub.Type != EventSubChannelUpdate || sub.Transport.SessionId != "session-1" {
+		t.Errorf("Retried %s for session %q, want %s for %q", sub.Type, sub.Transport.SessionId, EventSubChannelUpdate, "session-1")
+	}
+	if err := client.Err(); err != nil {
+		t.Errorf("Client failed: %s", err)
+	}
+}
+
+func TestEventSubClosedWhileConnecting(t *testing.T) {
+	s := newFakeEventSub(t)
+	client := s.client(t)
+
+	errc := make(chan error, 1)
+	go func() { errc <- client.Connect() }()
+
+	conn := s.accept(t)
+	client.Close()
+	send(t, conn, "welcome-1", eventSubWelcome, EventSubPayload{
+		Session: &EventSubSession{Id: "session-1", Status: "connected", KeepaliveTimeout: 10},
+	})
+
+	if err := <-errc; err == nil {
+		t.Error("Connect succeeded after Close")
+	}
+	select {
+	case _, ok := <-client.Events():
+		if ok {
+			t.Error("Got an event after Close")
+		}
+	case <-time.After(testTimeout):
+		t.Error("Events were not closed")
+	}
+}
@@ -0,0 +1,118 @@
+package twitch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	GqlUrl = "https://gql.twitch.tv/gql"
+
+	// The GQL API only accepts the Twitch web player's client id.
+	GqlClientId = "kimne78kx3ncx6brgo4mv6wki5h1ko"
+
+	clipAccessTokenHash = "36b89d2507fce29e5ca551df756d27c1cfe079e2609642b4390aa4c35796eb11"
+	videoCommentsHash   = "b70a3591ff0f4e0313d126c6a1502d79a1c02baebb288227c582044aa76adf6a"
+)
+
+func (c *twitchClient) gqlQuery(action string, query GqlRequest, out interface{}) error {
+	body, err := json.Marshal(query)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", GqlUrl, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Client-ID", GqlClientId)
+	req.Header.Add("Content-Type", "application/json")
+
+	res, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return ErrUnmarshal(action, res)
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+func (c *twitchClient) getClipAccessToken(slug string) (ar ClipAccessTokenResult, err error) {
+	err = c.gqlQuery("Getting clip token", GqlRequest{
+		OperationName: "VideoAccessToken_Clip",
+		Variables: map[string]interface{}{
+			"slug": slug,
+		},
+		Extensions: GqlExtensions{
+			PersistedQuery: GqlPersistedQuery{
+				Version:    1,
+				Sha256Hash: clipAccessTokenHash,
+			},
+		},
+	}, &ar)
+	if err != nil {
+		return ar, err
+	}
+
+	if len(ar.Errors) > 0 {
+		return ar, fmt.Errorf("Getting clip token: %s", ar.Errors[0].Message)
+	}
+	if ar.Data.Clip == nil {
+		return ar, fmt.Errorf("Clip %s does not exist", slug)
+	}
+
+	return ar, nil
+}
+
+// GetVideoComments returns a page of chat replay comments, starting at offset
+// into the video or, if not empty, at the cursor of the previous page.
+func (c *twitchClient) GetVideoComments(videoId string, offset time.Duration, cursor string) (cr VideoCommentsResult, err error) {
+	variables := map[string]interface{}{
+		"videoID": strings.TrimPrefix(videoId, "v"),
+	}
+	if cursor != "" {
+		variables["cursor"] = cursor
+	} else {
+		variables["contentOffsetSeconds"] = int(offset.Seconds())
+	}
+
+	var res videoCommentsResponse
+	err = c.gqlQuery("Getting video comments", GqlRequest{
+		OperationName: "VideoCommentsByOffsetOrCursor",
+		Variables:     variables,
+		Extensions: GqlExtensions{
+			PersistedQuery: GqlPersistedQuery{
+				Version:    1,
+				Sha256Hash: videoCommentsHash,
+			},
+		},
+	}, &res)
+	if err != nil {
+		return cr, err
+	}
+
+	if len(res.Errors) > 0 {
+		return cr, fmt.Errorf("Getting video comments: %s", res.Errors[0].Message)
+	}
+	if res.Data.Video == nil {
+		return cr, fmt.Errorf("Video %s does not exist", videoId)
+	}
+
+	edges := res.Data.Video.Comments.Edges
+	for _, e := range edges {
+		cr.Comments = append(cr.Comments, e.Node)
+	}
+	if res.Data.Video.Comments.PageInfo.HasNextPage && len(edges) > 0 {
+		cr.Cursor = edges[len(edges)-1].Cursor
+	}
+
+	return cr, nil
+}
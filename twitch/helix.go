@@ -0,0 +1,208 @@
+package twitch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	HelixUsersUrl        = "https://api.twitch.tv/helix/users"
+	HelixBansUrl         = "https://api.twitch.tv/helix/moderation/bans"
+	HelixChatUrl         = "https://api.twitch.tv/helix/moderation/chat"
+	HelixChatSettingsUrl = "https://api.twitch.tv/helix/chat/settings"
+)
+
+type Moderator interface {
+	GetUsers(logins ...string) ([]User, error)
+
+	Timeout(broadcasterId, userId uint64, duration time.Duration, reason string) error
+	Ban(broadcasterId, userId uint64, reason string) error
+	Unban(broadcasterId, userId uint64) error
+	DeleteMessage(broadcasterId uint64, messageId string) error
+
+	SetSlowMode(broadcasterId uint64, wait time.Duration) error
+	SetSubscriberMode(broadcasterId uint64, enabled bool) error
+}
+
+type helixClient struct {
+	*http.Client
+
+	clientId    string
+	accessToken string
+
+	mu          sync.Mutex
+	moderatorId string
+}
+
+func NewModerator(clientId, accessToken string, httpTimeout time.Duration) (Moderator, error) {
+	if accessToken == "" {
+		return nil, fmt.Errorf("Moderation requires a user access token")
+	}
+
+	return &helixClient{
+		Client:      newHttpClient(httpTimeout, nil),
+		clientId:    clientId,
+		accessToken: accessToken,
+	}, nil
+}
+
+func (c *helixClient) do(action, method, uri string, query url.Values, body interface{}, expect int, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	if len(query) > 0 {
+		uri += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, uri, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Client-ID", c.clientId)
+	req.Header.Add("Authorization", "Bearer "+c.accessToken)
+	if body != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
+
+	res, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != expect {
+		return ErrUnmarshal(action, res)
+	}
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+func (c *helixClient) GetUsers(logins ...string) ([]User, error) {
+	var lr UserListResult
+
+	query := url.Values{}
+	for _, login := range logins {
+		query.Add("login", login)
+	}
+
+	return lr.Users, c.do("Getting users", "GET", HelixUsersUrl, query, nil, http.StatusOK, &lr)
+}
+
+func (c *helixClient) getModeratorId() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.moderatorId != "" {
+		return c.moderatorId, nil
+	}
+
+	users, err := c.GetUsers()
+	if err != nil {
+		return "", err
+	}
+	if len(users) == 0 {
+		return "", fmt.Errorf("Access token does not belong to a user")
+	}
+	c.moderatorId = users[0].Id
+
+	return c.moderatorId, nil
+}
+
+func (c *helixClient) moderationQuery(broadcasterId uint64) (url.Values, error) {
+	moderatorId, err := c.getModeratorId()
+	if err != nil {
+		return nil, err
+	}
+
+	return url.Values{
+		"broadcaster_id": {strconv.FormatUint(broadcasterId, 10)},
+		"moderator_id":   {moderatorId},
+	}, nil
+}
+
+func (c *helixClient) Timeout(broadcasterId, userId uint64, duration time.Duration, reason string) error {
+	if duration < time.Second {
+		return fmt.Errorf("Timeout must be at least one second")
+	}
+
+	return c.ban("Timing out user", broadcasterId, BanRequest{
+		UserId:   strconv.FormatUint(userId, 10),
+		Duration: uint64(duration / time.Second),
+		Reason:   reason,
+	})
+}
+
+func (c *helixClient) Ban(broadcasterId, userId uint64, reason string) error {
+	return c.ban("Banning user", broadcasterId, BanRequest{
+		UserId: strconv.FormatUint(userId, 10),
+		Reason: reason,
+	})
+}
+
+func (c *helixClient) ban(action string, broadcasterId uint64, ban BanRequest) error {
+	query, err := c.moderationQuery(broadcasterId)
+	if err != nil {
+		return err
+	}
+
+	return c.do(action, "POST", HelixBansUrl, query, map[string]BanRequest{"data": ban}, http.StatusOK, nil)
+}
+
+func (c *helixClient) Unban(broadcasterId, userId uint64) error {
+	query, err := c.moderationQuery(broadcasterId)
+	if err != nil {
+		return err
+	}
+	query.Set("user_id", strconv.FormatUint(userId, 10))
+
+	return c.do("Unbanning user", "DELETE", HelixBansUrl, query, nil, http.StatusNoContent, nil)
+}
+
+func (c *helixClient) DeleteMessage(broadcasterId uint64, messageId string) error {
+	query, err := c.moderationQuery(broadcasterId)
+	if err != nil {
+		return err
+	}
+	query.Set("message_id", messageId)
+
+	return c.do("Deleting message", "DELETE", HelixChatUrl, query, nil, http.StatusNoContent, nil)
+}
+
+func (c *helixClient) SetSlowMode(broadcasterId uint64, wait time.Duration) error {
+	enabled := wait > 0
+	settings := ChatSettings{SlowMode: &enabled}
+	if enabled {
+		seconds := uint64(wait / time.Second)
+		settings.SlowModeWait = &seconds
+	}
+
+	return c.updateChatSettings("Setting slow mode", broadcasterId, settings)
+}
+
+func (c *helixClient) SetSubscriberMode(broadcasterId uint64, enabled bool) error {
+	return c.updateChatSettings("Setting subscriber mode", broadcasterId, ChatSettings{SubscriberMode: &enabled})
+}
+
+func (c *helixClient) updateChatSettings(action string, broadcasterId uint64, settings ChatSettings) error {
+	query, err := c.moderationQuery(broadcasterId)
+	if err != nil {
+		return err
+	}
+
+	return c.do(action, "PATCH", HelixChatSettingsUrl, query, settings, http.StatusOK, nil)
+}
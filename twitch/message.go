@@ -1,7 +1,9 @@
 package twitch
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -124,3 +126,291 @@ type StreamUrl struct {
 	Resolution string
 	URI        string
 }
+
+type EventSubMetadata struct {
+	MessageId           string    `json:"message_id"`
+	MessageType         string    `json:"message_type"`
+	MessageTimestamp    time.Time `json:"message_timestamp"`
+	SubscriptionType    string    `json:"subscription_type,omitempty"`
+	SubscriptionVersion string    `json:"subscription_version,omitempty"`
+}
+
+type EventSubSession struct {
+	Id               string    `json:"id"`
+	Status           string    `json:"status"`
+	ConnectedAt      time.Time `json:"connected_at"`
+	KeepaliveTimeout uint64    `json:"keepalive_timeout_seconds"`
+	ReconnectUrl     string    `json:"reconnect_url"`
+}
+
+type EventSubCondition struct {
+	BroadcasterUserId string `json:"broadcaster_user_id"`
+}
+
+type EventSubTransport struct {
+	Method    string `json:"method"`
+	SessionId string `json:"session_id"`
+}
+
+type EventSubSubscription struct {
+	Id        string            `json:"id,omitempty"`
+	Status    string            `json:"status,omitempty"`
+	Type      string            `json:"type"`
+	Version   string            `json:"version"`
+	Cost      uint64            `json:"cost,omitempty"`
+	Condition EventSubCondition `json:"condition"`
+	Transport EventSubTransport `json:"transport"`
+	Created   time.Time         `json:"created_at,omitempty"`
+}
+
+type EventSubPayload struct {
+	Session      *EventSubSession      `json:"session,omitempty"`
+	Subscription *EventSubSubscription `json:"subscription,omitempty"`
+	Event        json.RawMessage       `json:"event,omitempty"`
+}
+
+type EventSubMessage struct {
+	Metadata EventSubMetadata `json:"metadata"`
+	Payload  EventSubPayload  `json:"payload"`
+}
+
+type EventSubSubscriptionResult struct {
+	Data []EventSubSubscription `json:"data"`
+}
+
+type StreamOnlineEvent struct {
+	Id                   string    `json:"id"`
+	BroadcasterUserId    string    `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string    `json:"broadcaster_user_login"`
+	BroadcasterUserName  string    `json:"broadcaster_user_name"`
+	Type                 string    `json:"type"`
+	Started              time.Time `json:"started_at"`
+}
+
+type StreamOfflineEvent struct {
+	BroadcasterUserId    string `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string `json:"broadcaster_user_login"`
+	BroadcasterUserName  string `json:"broadcaster_user_name"`
+}
+
+type ChannelUpdateEvent struct {
+	BroadcasterUserId    string   `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string   `json:"broadcaster_user_login"`
+	BroadcasterUserName  string   `json:"broadcaster_user_name"`
+	Title                string   `json:"title"`
+	Language             string   `json:"language"`
+	CategoryId           string   `json:"category_id"`
+	CategoryName         string   `json:"category_name"`
+	ContentLabels        []string `json:"content_classification_labels"`
+}
+
+type EventSubEvent struct {
+	Type         string
+	Subscription EventSubSubscription
+	Timestamp    time.Time
+
+	Online  *StreamOnlineEvent
+	Offline *StreamOfflineEvent
+	Update  *ChannelUpdateEvent
+	// Err is set on a revocation for a subscription request that failed.
+	Err error
+}
+
+type User struct {
+	Id              string    `json:"id"`
+	Login           string    `json:"login"`
+	DisplayName     string    `json:"display_name"`
+	Type            string    `json:"type"`
+	BroadcasterType string    `json:"broadcaster_type"`
+	Description     string    `json:"description"`
+	ProfileImage    string    `json:"profile_image_url"`
+	OfflineImage    string    `json:"offline_image_url"`
+	Created         time.Time `json:"created_at"`
+}
+
+type UserListResult struct {
+	Users []User `json:"data"`
+}
+
+type BanRequest struct {
+	UserId   string `json:"user_id"`
+	Duration uint64 `json:"duration,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+type ChatSettings struct {
+	SlowMode         *bool   `json:"slow_mode,omitempty"`
+	SlowModeWait     *uint64 `json:"slow_mode_wait_time,omitempty"`
+	SubscriberMode   *bool   `json:"subscriber_mode,omitempty"`
+	EmoteMode        *bool   `json:"emote_mode,omitempty"`
+	FollowerMode     *bool   `json:"follower_mode,omitempty"`
+	FollowerModeWait *uint64 `json:"follower_mode_duration,omitempty"`
+}
+
+type Video struct {
+	Id            string    `json:"_id"`
+	BroadcastId   uint64    `json:"broadcast_id"`
+	BroadcastType string    `json:"broadcast_type"`
+	Channel       Channel   `json:"channel"`
+	Created       time.Time `json:"created_at"`
+	Published     time.Time `json:"published_at"`
+	Description   string    `json:"description"`
+	Game          string    `json:"game"`
+	Language      string    `json:"language"`
+	Length        uint64    `json:"length"`
+	Status        string    `json:"status"`
+	Title         string    `json:"title"`
+	Url           string    `json:"url"`
+	Viewable      string    `json:"viewable"`
+	Views         uint64    `json:"views"`
+}
+
+type VideoListResult struct {
+	Total  uint64  `json:"_total"`
+	Videos []Video `json:"videos"`
+}
+
+type ClipUser struct {
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	ChannelUrl  string `json:"channel_url"`
+	Logo        string `json:"logo"`
+}
+
+type ClipVod struct {
+	Id     string `json:"id"`
+	Url    string `json:"url"`
+	Offset uint64 `json:"offset"`
+}
+
+type ClipThumbnails struct {
+	Medium string `json:"medium"`
+	Small  string `json:"small"`
+	Tiny   string `json:"tiny"`
+}
+
+type Clip struct {
+	Slug        string         `json:"slug"`
+	TrackingId  string         `json:"tracking_id"`
+	Url         string         `json:"url"`
+	EmbedUrl    string         `json:"embed_url"`
+	Broadcaster ClipUser       `json:"broadcaster"`
+	Curator     ClipUser       `json:"curator"`
+	Vod         *ClipVod       `json:"vod"`
+	BroadcastId string         `json:"broadcast_id"`
+	Game        string         `json:"game"`
+	Language    string         `json:"language"`
+	Title       string         `json:"title"`
+	Views       uint64         `json:"views"`
+	Duration    float64        `json:"duration"`
+	Created     time.Time      `json:"created_at"`
+	Thumbnails  ClipThumbnails `json:"thumbnails"`
+}
+
+type ClipListResult struct {
+	Clips  []Clip `json:"clips"`
+	Cursor string `json:"_cursor"`
+}
+
+type GqlRequest struct {
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+	Extensions    GqlExtensions          `json:"extensions"`
+}
+
+type GqlExtensions struct {
+	PersistedQuery GqlPersistedQuery `json:"persistedQuery"`
+}
+
+type GqlPersistedQuery struct {
+	Version    int    `json:"version"`
+	Sha256Hash string `json:"sha256Hash"`
+}
+
+type GqlError struct {
+	Message string `json:"message"`
+}
+
+type PlaybackAccessToken struct {
+	Signature string `json:"signature"`
+	Value     string `json:"value"`
+}
+
+type ClipVideoQuality struct {
+	FrameRate float64 `json:"frameRate"`
+	Quality   string  `json:"quality"`
+	SourceUrl string  `json:"sourceURL"`
+}
+
+type ClipAccessTokenResult struct {
+	Data struct {
+		Clip *struct {
+			PlaybackAccessToken PlaybackAccessToken `json:"playbackAccessToken"`
+			VideoQualities      []ClipVideoQuality  `json:"videoQualities"`
+		} `json:"clip"`
+	} `json:"data"`
+	Errors []GqlError `json:"errors"`
+}
+
+type VideoCommentBadge struct {
+	SetId   string `json:"setID"`
+	Version string `json:"version"`
+}
+
+type VideoCommentFragment struct {
+	Text string `json:"text"`
+}
+
+type VideoComment struct {
+	Id                   string    `json:"id"`
+	ContentOffsetSeconds int       `json:"contentOffsetSeconds"`
+	Created              time.Time `json:"createdAt"`
+	Commenter            *struct {
+		Id          string `json:"id"`
+		Login       string `json:"login"`
+		DisplayName string `json:"displayName"`
+	} `json:"commenter"`
+	Message struct {
+		Fragments  []VideoCommentFragment `json:"fragments"`
+		UserBadges []VideoCommentBadge    `json:"userBadges"`
+		UserColor  string                 `json:"userColor"`
+	} `json:"message"`
+}
+
+// Offset returns the position of the comment in the video.
+func (c VideoComment) Offset() time.Duration {
+	return time.Duration(c.ContentOffsetSeconds) * time.Second
+}
+
+func (c VideoComment) Text() string {
+	var b strings.Builder
+	for _, f := range c.Message.Fragments {
+		b.WriteString(f.Text)
+	}
+
+	return b.String()
+}
+
+type VideoCommentsResult struct {
+	Comments []VideoComment
+	// Cursor continues with the next page, it is empty after the last one.
+	Cursor string
+}
+
+type videoCommentsResponse struct {
+	Data struct {
+		Video *struct {
+			Comments struct {
+				Edges []struct {
+					Cursor string       `json:"cursor"`
+					Node   VideoComment `json:"node"`
+				} `json:"edges"`
+				PageInfo struct {
+					HasNextPage bool `json:"hasNextPage"`
+				} `json:"pageInfo"`
+			} `json:"comments"`
+		} `json:"video"`
+	} `json:"data"`
+	Errors []GqlError `json:"errors"`
+}
@@ -5,15 +5,19 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/grafov/m3u8"
 )
 
 const (
-	AccessTokenUrl = "https://api.twitch.tv/api/channels/%s/access_token"
+	AccessTokenUrl    = "https://api.twitch.tv/api/channels/%s/access_token"
+	VodAccessTokenUrl = "https://api.twitch.tv/api/vods/%s/access_token"
 
 	GetStreamUrl = "https://api.twitch.tv/kraken/streams/%d"
+	GetVideoUrl  = "https://api.twitch.tv/kraken/videos/%s"
+	GetClipUrl   = "https://api.twitch.tv/kraken/clips/%s"
 
 	SearchChannelUrl = "https://api.twitch.tv/kraken/search/channels?query=%s&limit=%d"
 	SearchGameUrl    = "https://api.twitch.tv/kraken/search/games?query=%s&type=suggest"
@@ -22,8 +26,20 @@ const (
 	ListGamesUrl       = "https://api.twitch.tv/kraken/games/top?limit=%d"
 	ListFeaturedUrl    = "https://api.twitch.tv/kraken/streams/featured?limit=%d"
 	ListGameStreamsUrl = "https://api.twitch.tv/kraken/streams/?game=%s&limit=%d"
+	ListVideosUrl      = "https://api.twitch.tv/kraken/channels/%d/videos?broadcast_type=%s&limit=%d&offset=%d"
+	ListClipsUrl       = "https://api.twitch.tv/kraken/clips/top?channel=%s&game=%s&period=%s&limit=%d&cursor=%s"
 
 	StreamGeneratorUrl = "https://usher.ttvnw.net/api/channel/hls/%s.m3u8?player=twitchweb&token=%s&sig=%s&allow_audio_only=true&allow_source=true&type=any&allow_spectre=false&p=%d"
+	VodGeneratorUrl    = "https://usher.ttvnw.net/vod/%s.m3u8?player=twitchweb&nauth=%s&nauthsig=%s&allow_audio_only=true&allow_source=true&type=any&allow_spectre=true&p=%d"
+
+	VideoTypeArchive   = "archive"
+	VideoTypeHighlight = "highlight"
+	VideoTypeUpload    = "upload"
+
+	ClipPeriodDay   = "day"
+	ClipPeriodWeek  = "week"
+	ClipPeriodMonth = "month"
+	ClipPeriodAll   = "all"
 
 	KrakenApiAcceptHeader = "application/vnd.twitchtv.v5+json"
 )
@@ -39,6 +55,15 @@ type Client interface {
 	GetGameList(num int) (GameListResult, error)
 	GetFeaturedList(num int) (FeaturedListResult, error)
 	GetStreamList(game string, num int) (StreamListResult, error)
+
+	GetVideo(videoId string) (Video, error)
+	GetVideoList(channelId uint64, videoType string, num, offset int) (VideoListResult, error)
+	GetVideoUrls(videoId string) ([]StreamUrl, error)
+	GetVideoComments(videoId string, offset time.Duration, cursor string) (VideoCommentsResult, error)
+
+	GetClip(slug string) (Clip, error)
+	GetClipList(channel, game, period string, num int, cursor string) (ClipListResult, error)
+	GetClipUrls(slug string) ([]StreamUrl, error)
 }
 
 type twitchClient struct {
@@ -59,7 +84,15 @@ func NewTwitchClient(clientId string, httpTimeout time.Duration) (Client, error)
 }
 
 func (c *twitchClient) getStreamToken(channel string) (tok Token, err error) {
-	req, err := http.NewRequest("GET", fmt.Sprintf(AccessTokenUrl, channel), nil)
+	return c.getAccessToken(fmt.Sprintf(AccessTokenUrl, channel))
+}
+
+func (c *twitchClient) getVodToken(videoId string) (tok Token, err error) {
+	return c.getAccessToken(fmt.Sprintf(VodAccessTokenUrl, videoId))
+}
+
+func (c *twitchClient) getAccessToken(tokenUrl string) (tok Token, err error) {
+	req, err := http.NewRequest("GET", tokenUrl, nil)
 	if err != nil {
 		return tok, err
 	}
@@ -79,7 +112,15 @@ func (c *twitchClient) getStreamToken(channel string) (tok Token, err error) {
 }
 
 func (c *twitchClient) getStreamUrls(channel string, tok Token) (*m3u8.MasterPlaylist, error) {
-	req, err := http.NewRequest("GET", fmt.Sprintf(StreamGeneratorUrl, channel, url.QueryEscape(tok.Token), tok.Signature, time.Now().UnixNano()), nil)
+	return c.getMasterPlaylist(fmt.Sprintf(StreamGeneratorUrl, channel, url.QueryEscape(tok.Token), tok.Signature, time.Now().UnixNano()))
+}
+
+func (c *twitchClient) getVodUrls(videoId string, tok Token) (*m3u8.MasterPlaylist, error) {
+	return c.getMasterPlaylist(fmt.Sprintf(VodGeneratorUrl, videoId, url.QueryEscape(tok.Token), tok.Signature, time.Now().UnixNano()))
+}
+
+func (c *twitchClient) getMasterPlaylist(playlistUrl string) (*m3u8.MasterPlaylist, error) {
+	req, err := http.NewRequest("GET", playlistUrl, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -264,6 +305,130 @@ func (c *twitchClient) GetStreamUrls(channel string) (streams []StreamUrl, err e
 		return streams, err
 	}
 
+	return variantUrls(pl), nil
+}
+
+func (c *twitchClient) GetVideo(videoId string) (v Video, err error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf(GetVideoUrl, url.PathEscape(videoId)), nil)
+	if err != nil {
+		return v, err
+	}
+	req.Header.Add("Accept", KrakenApiAcceptHeader)
+	req.Header.Add("Client-ID", c.clientId)
+
+	res, err := c.Do(req)
+	if err != nil {
+		return v, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return v, ErrUnmarshal("Getting video", res)
+	}
+
+	return v, json.NewDecoder(res.Body).Decode(&v)
+}
+
+func (c *twitchClient) GetVideoList(channelId uint64, videoType string, num, offset int) (lr VideoListResult, err error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf(ListVideosUrl, channelId, url.QueryEscape(videoType), num, offset), nil)
+	if err != nil {
+		return lr, err
+	}
+	req.Header.Add("Accept", KrakenApiAcceptHeader)
+	req.Header.Add("Client-ID", c.clientId)
+
+	res, err := c.Do(req)
+	if err != nil {
+		return lr, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return lr, ErrUnmarshal("Listing videos", res)
+	}
+
+	return lr, json.NewDecoder(res.Body).Decode(&lr)
+}
+
+func (c *twitchClient) GetVideoUrls(videoId string) (streams []StreamUrl, err error) {
+	videoId = strings.TrimPrefix(videoId, "v")
+
+	tok, err := c.getVodToken(videoId)
+	if err != nil {
+		return streams, err
+	}
+	pl, err := c.getVodUrls(videoId, tok)
+	if err != nil {
+		return streams, err
+	}
+
+	return variantUrls(pl), nil
+}
+
+func (c *twitchClient) GetClip(slug string) (clip Clip, err error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf(GetClipUrl, url.PathEscape(slug)), nil)
+	if err != nil {
+		return clip, err
+	}
+	req.Header.Add("Accept", KrakenApiAcceptHeader)
+	req.Header.Add("Client-ID", c.clientId)
+
+	res, err := c.Do(req)
+	if err != nil {
+		return clip, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return clip, ErrUnmarshal("Getting clip", res)
+	}
+
+	return clip, json.NewDecoder(res.Body).Decode(&clip)
+}
+
+func (c *twitchClient) GetClipList(channel, game, period string, num int, cursor string) (lr ClipListResult, err error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf(ListClipsUrl, url.QueryEscape(channel), url.QueryEscape(game), url.QueryEscape(period), num, url.QueryEscape(cursor)), nil)
+	if err != nil {
+		return lr, err
+	}
+	req.Header.Add("Accept", KrakenApiAcceptHeader)
+	req.Header.Add("Client-ID", c.clientId)
+
+	res, err := c.Do(req)
+	if err != nil {
+		return lr, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return lr, ErrUnmarshal("Listing clips", res)
+	}
+
+	return lr, json.NewDecoder(res.Body).Decode(&lr)
+}
+
+func (c *twitchClient) GetClipUrls(slug string) (streams []StreamUrl, err error) {
+	ar, err := c.getClipAccessToken(slug)
+	if err != nil {
+		return streams, err
+	}
+
+	tok := ar.Data.Clip.PlaybackAccessToken
+	for _, q := range ar.Data.Clip.VideoQualities {
+		streams = append(streams, StreamUrl{
+			Quality:    fmt.Sprintf("%sp%.0f", q.Quality, q.FrameRate),
+			Resolution: q.Quality + "p",
+			URI:        fmt.Sprintf("%s?sig=%s&token=%s", q.SourceUrl, url.QueryEscape(tok.Signature), url.QueryEscape(tok.Value)),
+		})
+	}
+	if len(streams) == 0 {
+		return streams, fmt.Errorf("No qualities available for clip %s", slug)
+	}
+
+	return streams, nil
+}
+
+func variantUrls(pl *m3u8.MasterPlaylist) (streams []StreamUrl) {
 	for _, variant := range pl.Variants {
 		streams = append(streams, StreamUrl{
 			Bandwidth:  variant.VariantParams.Bandwidth,
@@ -273,7 +438,7 @@ func (c *twitchClient) GetStreamUrls(channel string) (streams []StreamUrl, err e
 		})
 	}
 
-	return streams, nil
+	return streams
 }
 
 func ErrUnmarshal(action string, res *http.Response) error {
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/urfave/cli"
+
+	"github.com/hchagen/twitch-player/history"
+	"github.com/hchagen/twitch-player/twitch"
+)
+
+var (
+	DefaultResumeMargin     = 30 * time.Second
+	DefaultProgressInterval = 10 * time.Second
+)
+
+var videoTypes = map[string]string{
+	twitch.VideoTypeArchive:   twitch.VideoTypeArchive,
+	twitch.VideoTypeHighlight: twitch.VideoTypeHighlight,
+	twitch.VideoTypeUpload:    twitch.VideoTypeUpload,
+	"all":                     twitch.VideoTypeArchive + "," + twitch.VideoTypeHighlight + "," + twitch.VideoTypeUpload,
+}
+
+func selectVideo(channel twitch.Channel, videoType string, num, page int) (video twitch.Video, err error) {
+	broadcastType, ok := videoTypes[videoType]
+	if !ok {
+		return video, fmt.Errorf("Unknown video type %s (archive, highlight, upload or all)", videoType)
+	}
+
+	videos, err := twitchClient().GetVideoList(channel.Id, broadcastType, num, page*num)
+	if err != nil {
+		return video, err
+	}
+	if len(videos.Videos) == 0 {
+		return video, fmt.Errorf("No videos found for %s on page %d", channel.Name, page)
+	}
+
+	fmt.Printf("Listing %d videos (page %d, %d in total):\n\n", len(videos.Videos), page, videos.Total)
+	printVideos(videos.Videos)
+
+	selection := getNumericInput(os.Stdout, fmt.Sprintf("\nSelect video: [0-%d]: ", len(videos.Videos)-1), len(videos.Videos)-1)
+
+	return videos.Videos[selection], nil
+}
+
+func onVod(ctx *cli.Context) error {
+	var video twitch.Video
+	var err error
+	if id := ctx.String("id"); id != "" {
+		video, err = twitchClient().GetVideo(id)
+	} else {
+		if ctx.NArg() != 1 {
+			return fmt.Errorf("Please provide a channel name or a video id")
+		}
+		var channel twitch.Channel
+		if channel, err = selectChannel(os.Stdout, ctx.Args()[0]); err == nil {
+			video, err = selectVideo(channel, ctx.String("type"), ctx.Int("number"), ctx.Int("page"))
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	start := ctx.Duration("start")
+	if length := time.Duration(video.Length) * time.Second; start > length {
+		return fmt.Errorf("Start offset %s is past the end of the video (%s)", start, length)
+	}
+	if e, ok := watchHistory().Get(video.Id); ok && !ctx.IsSet("start") && e.Position > DefaultResumeMargin && e.Position < e.Length-DefaultResumeMargin {
+		if getYesNoInput(fmt.Sprintf("Resume %s from %s (%.0f%%)? [Y/n]: ", video.Id, e.Position.Truncate(time.Second), e.Progress()*100), true) {
+			start = e.Position.Truncate(time.Second)
+		}
+	}
+
+	uris, err := twitchClient().GetVideoUrls(video.Id)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\n%s - %s playing %s (%s): %s\n\n",
+		video.Channel.DisplayName,
+		video.Published.Local().Format("2006-01-02"),
+		video.Game,
+		time.Duration(video.Length)*time.Second,
+		video.Title,
+	)
+
+	if err := playStreamUrl(ctx, video.Id, selectStreamUrl(os.Stdout, uris)); err != nil {
+		return err
+	}
+	if start > 0 {
+		fmt.Printf("Seeking to %s...\n", start)
+		if err := mediaPlayer().Seek(start); err != nil {
+			return err
+		}
+	}
+
+	stop := trackVodProgress(video)
+	waitForSignal()
+
+	return stop()
+}
+
+// trackVodProgress records the playback position every DefaultProgressInterval
+// until the returned function is called, which records it a final time.
+func trackVodProgress(video twitch.Video) func() error {
+	record := func() error {
+		pos, err := mediaPlayer().Position()
+		if err != nil || pos <= 0 {
+			return err
+		}
+		length, err := mediaPlayer().Length()
+		if err != nil || length <= 0 {
+			length = time.Duration(video.Length) * time.Second
+		}
+
+		return watchHistory().Update(history.Entry{
+			VideoId:  video.Id,
+			Channel:  video.Channel.DisplayName,
+			Title:    video.Title,
+			Position: pos,
+			Length:   length,
+		})
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(DefaultProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := record(); err != nil {
+					fmt.Printf("Error saving watch progress: %s\n", err.Error())
+				}
+			}
+		}
+	}()
+
+	return func() error {
+		close(done)
+		<-stopped
+		return record()
+	}
+}
+
+func onHistory(ctx *cli.Context) error {
+	entries := watchHistory().List()
+	if n := ctx.Int("number"); len(entries) > n {
+		entries = entries[:n]
+	}
+
+	fmt.Printf("Listing %d watched videos:\n\n", len(entries))
+	printHistory(entries)
+	fmt.Println("")
+
+	return nil
+}